@@ -0,0 +1,55 @@
+package main
+
+import "fmt"
+
+func (app *application) showLimits(args []string) error {
+	fs := newFlagSet("limits show")
+	email := fs.String("email", "", "Email address of the user")
+	fs.Parse(args)
+
+	user, err := app.userByEmail(*email)
+	if err != nil {
+		return err
+	}
+
+	tier, err := app.models.RateLimits.GetTier(user.ID)
+	if err != nil {
+		return err
+	}
+
+	return app.printTier(tier)
+}
+
+// setLimits assigns a rate limiting tier to a user, or with no tier clears it
+// so that their permissions decide. Tiers are configured on the API server,
+// which treats one it doesn't know like no tier at all.
+func (app *application) setLimits(args []string) error {
+	fs := newFlagSet("limits set")
+	email := fs.String("email", "", "Email address of the user")
+	fs.Parse(args)
+
+	if fs.NArg() > 1 {
+		return fmt.Errorf("limits set: expected at most one tier")
+	}
+
+	user, err := app.userByEmail(*email)
+	if err != nil {
+		return err
+	}
+
+	err = app.models.RateLimits.SetTier(user.ID, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return app.printTier(fs.Arg(0))
+}
+
+func (app *application) printTier(tier string) error {
+	shown := tier
+	if shown == "" {
+		shown = "(from permissions)"
+	}
+
+	return app.print(map[string]any{"tier": tier}, []string{"TIER"}, [][]string{{shown}})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+	_ "github.com/lib/pq"
+)
+
+const usage = `usage: admin [flags] <command> [command flags]
+
+commands:
+  users list        [-search text] [-page n] [-page-size n]
+  users create      -name name -email email [-password pw] [-locale tag] [-activated] [-permissions codes]
+  users activate    -email email
+  users deactivate  -email email
+  permissions list  [-email email]
+  permissions grant -email email code...
+  permissions revoke -email email code...
+  limits show       -email email
+  limits set        -email email [tier]
+  tokens revoke     -email email [-scope scope]
+
+flags:
+`
+
+type command struct {
+	run  func(app *application, args []string) error
+	name string
+}
+
+var commands = []command{
+	{name: "users list", run: (*application).listUsers},
+	{name: "users create", run: (*application).createUser},
+	{name: "users activate", run: (*application).activateUser},
+	{name: "users deactivate", run: (*application).deactivateUser},
+	{name: "permissions list", run: (*application).listPermissions},
+	{name: "permissions grant", run: (*application).grantPermissions},
+	{name: "permissions revoke", run: (*application).revokePermissions},
+	{name: "limits show", run: (*application).showLimits},
+	{name: "limits set", run: (*application).setLimits},
+	{name: "tokens revoke", run: (*application).revokeTokens},
+}
+
+type application struct {
+	models data.Models
+	out    io.Writer
+	format string
+	jwtTTL time.Duration
+}
+
+func main() {
+	var (
+		dsn    string
+		format string
+		jwtTTL time.Duration
+	)
+
+	flag.StringVar(&dsn, "db-dsn", os.Getenv("GREENLIGHT_DB_DSN"), "PostgresSQL DSN (defaults to $GREENLIGHT_DB_DSN)")
+	flag.StringVar(&format, "format", "table", `output format. options: "table", "json"`)
+	flag.DurationVar(&jwtTTL, "jwt-ttl", 15*time.Minute, "The api's -jwt-ttl, how long the JWTs revoked by a command could still be valid")
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if format != "table" && format != "json" {
+		fatal(fmt.Errorf("invalid -format %q", format))
+	}
+
+	if jwtTTL <= 0 {
+		fatal(fmt.Errorf("invalid -jwt-ttl %s", jwtTTL))
+	}
+
+	args := flag.Args()
+	if len(args) < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == args[0]+" "+args[1] {
+			cmd = &commands[i]
+		}
+	}
+
+	if cmd == nil {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db, err := openDB(dsn)
+	if err != nil {
+		fatal(err)
+	}
+	defer db.Close()
+
+	app := &application{
+		models: data.NewModels(db),
+		out:    os.Stdout,
+		format: format,
+		jwtTTL: jwtTTL,
+	}
+
+	err = cmd.run(app, args[2:])
+	if err != nil {
+		db.Close()
+		fatal(err)
+	}
+}
+
+func openDB(dsn string) (*sql.DB, error) {
+	if dsn == "" {
+		return nil, errors.New("a database DSN is required, set -db-dsn or GREENLIGHT_DB_DSN")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "admin: %s\n", err)
+	os.Exit(1)
+}
+
+// print writes value as indented JSON, or as a table of the given header and
+// rows when the table format is selected.
+func (app *application) print(value any, header []string, rows [][]string) error {
+	if app.format == "json" {
+		enc := json.NewEncoder(app.out)
+		enc.SetIndent("", "\t")
+		return enc.Encode(value)
+	}
+
+	tw := tabwriter.NewWriter(app.out, 0, 8, 2, ' ', 0)
+
+	writeRow(tw, header)
+	for _, row := range rows {
+		writeRow(tw, row)
+	}
+
+	return tw.Flush()
+}
+
+func writeRow(w io.Writer, cells []string) {
+	for i, cell := range cells {
+		if i > 0 {
+			fmt.Fprint(w, "\t")
+		}
+		fmt.Fprint(w, cell)
+	}
+	fmt.Fprintln(w)
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ExitOnError)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+)
+
+func (app *application) listPermissions(args []string) error {
+	fs := newFlagSet("permissions list")
+	email := fs.String("email", "", "Show the permissions of this user instead of every permission")
+	fs.Parse(args)
+
+	var (
+		permissions data.Permissions
+		err         error
+	)
+
+	if *email == "" {
+		permissions, err = app.models.Permissions.GetAll()
+	} else {
+		user, uerr := app.userByEmail(*email)
+		if uerr != nil {
+			return uerr
+		}
+		permissions, err = app.models.Permissions.GetAllForUser(user.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	return app.printPermissions(permissions)
+}
+
+func (app *application) grantPermissions(args []string) error {
+	return app.changePermissions("permissions grant", args, app.models.Permissions.AddForUser)
+}
+
+func (app *application) revokePermissions(args []string) error {
+	return app.changePermissions("permissions revoke", args, func(userID int64, codes ...string) error {
+		return app.models.Transaction(func(models data.Models) error {
+			err := models.Permissions.RemoveForUser(userID, codes...)
+			if err != nil {
+				return err
+			}
+
+			// JWTs carry the permissions, so the old ones would still grant these
+			return app.revokeJWTs(models, userID)
+		})
+	})
+}
+
+func (app *application) changePermissions(name string, args []string, change func(int64, ...string) error) error {
+	fs := newFlagSet(name)
+	email := fs.String("email", "", "Email address of the user")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("%s: at least one permission code is required", name)
+	}
+
+	codes, err := app.knownPermissions(splitCodes(strings.Join(fs.Args(), ",")))
+	if err != nil {
+		return err
+	}
+
+	user, err := app.userByEmail(*email)
+	if err != nil {
+		return err
+	}
+
+	err = change(user.ID, codes...)
+	if err != nil {
+		return err
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	return app.printPermissions(permissions)
+}
+
+// knownPermissions rejects codes that don't exist, which would otherwise be
+// silently ignored by the permission model.
+func (app *application) knownPermissions(codes []string) ([]string, error) {
+	all, err := app.models.Permissions.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		if !all.Include(code) {
+			return nil, fmt.Errorf("unknown permission %q, expected one of %s", code, strings.Join(all, ", "))
+		}
+	}
+
+	return codes, nil
+}
+
+func (app *application) printPermissions(permissions data.Permissions) error {
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+
+	rows := make([][]string, len(permissions))
+	for i, code := range permissions {
+		rows[i] = []string{code}
+	}
+
+	return app.print(map[string]any{"permissions": permissions}, []string{"PERMISSION"}, rows)
+}
+
+func splitCodes(s string) []string {
+	var codes []string
+	for _, code := range strings.Split(s, ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			codes = append(codes, code)
+		}
+	}
+
+	return codes
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+	"github.com/PriyanshuSharma23/greenlight/internal/validator"
+)
+
+func (app *application) listUsers(args []string) error {
+	fs := newFlagSet("users list")
+
+	var (
+		search string
+		f      data.Filters
+	)
+
+	fs.StringVar(&search, "search", "", "Only show users whose name or email contains this text")
+	fs.IntVar(&f.Page, "page", 1, "Page number")
+	fs.IntVar(&f.PageSize, "page-size", 20, "Users per page")
+	fs.StringVar(&f.Sort, "sort", "id", "Sort column, prefix with - for descending")
+	fs.Parse(args)
+
+	f.SortSafelist = []string{"id", "name", "email", "created_at", "-id", "-name", "-email", "-created_at"}
+
+	v := validator.New()
+	if data.ValidateFilter(v, f); !v.Valid() {
+		return validationError(v)
+	}
+
+	users, metadata, err := app.models.Users.GetAll(search, f)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(users))
+	for i, u := range users {
+		rows[i] = []string{
+			strconv.FormatInt(u.ID, 10),
+			u.Name,
+			u.Email,
+			strconv.FormatBool(u.Activated),
+			u.CreatedAt.Format(time.RFC3339),
+		}
+	}
+
+	return app.print(
+		map[string]any{"users": users, "metadata": metadata},
+		[]string{"ID", "NAME", "EMAIL", "ACTIVATED", "CREATED"},
+		rows,
+	)
+}
+
+func (app *application) createUser(args []string) error {
+	fs := newFlagSet("users create")
+
+	var (
+		name, email, pw, perms, locale string
+		activated                      bool
+	)
+
+	fs.StringVar(&name, "name", "", "Name of the user")
+	fs.StringVar(&email, "email", "", "Email address of the user")
+	fs.StringVar(&pw, "password", "", "Password (read from the first line of stdin when omitted)")
+	fs.StringVar(&locale, "locale", "en", "Language for emails sent to the user")
+	fs.BoolVar(&activated, "activated", false, "Create the account already activated")
+	fs.StringVar(&perms, "permissions", "movies:read", "Comma separated permission codes to grant")
+	fs.Parse(args)
+
+	if pw == "" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return errors.New("no password given on -password or stdin")
+		}
+		pw = strings.TrimRight(line, "\r\n")
+	}
+
+	user := &data.User{
+		Name:      name,
+		Email:     email,
+		Locale:    locale,
+		Activated: activated,
+	}
+
+	err := user.Password.Set(pw)
+	if err != nil {
+		return err
+	}
+
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() {
+		return validationError(v)
+	}
+
+	codes, err := app.knownPermissions(splitCodes(perms))
+	if err != nil {
+		return err
+	}
+
+	err = app.models.Transaction(func(models data.Models) error {
+		err := models.Users.Insert(user)
+		if err != nil {
+			return err
+		}
+
+		if len(codes) == 0 {
+			return nil
+		}
+
+		return models.Permissions.AddForUser(user.ID, codes...)
+	})
+	if err != nil {
+		if errors.Is(err, data.ErrDuplicateEmail) {
+			return fmt.Errorf("a user with email %s already exists", email)
+		}
+		return err
+	}
+
+	return app.printUser(user)
+}
+
+func (app *application) activateUser(args []string) error {
+	return app.setActivated("users activate", args, true)
+}
+
+func (app *application) deactivateUser(args []string) error {
+	return app.setActivated("users deactivate", args, false)
+}
+
+func (app *application) setActivated(name string, args []string, activated bool) error {
+	fs := newFlagSet(name)
+	email := fs.String("email", "", "Email address of the user")
+	fs.Parse(args)
+
+	user, err := app.userByEmail(*email)
+	if err != nil {
+		return err
+	}
+
+	user.Activated = activated
+
+	err = app.models.Transaction(func(models data.Models) error {
+		err := models.Users.UpdateUser(user)
+		if err != nil {
+			return err
+		}
+
+		if activated {
+			return models.Tokens.DeleteAllForUser(user.ID, data.ScopeActivation)
+		}
+
+		err = models.Tokens.DeleteAllForUser(user.ID, data.ScopeAuthentication)
+		if err != nil {
+			return err
+		}
+
+		err = models.Tokens.DeleteAllForUser(user.ID, data.ScopeRefresh)
+		if err != nil {
+			return err
+		}
+
+		// JWTs carry the activation status, so the old ones would still pass
+		return app.revokeJWTs(models, user.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	return app.printUser(user)
+}
+
+func (app *application) userByEmail(email string) (*data.User, error) {
+	v := validator.New()
+	if data.ValidateEmail(v, email); !v.Valid() {
+		return nil, validationError(v)
+	}
+
+	user, err := app.models.Users.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRecordFound) {
+			return nil, fmt.Errorf("no user with email %s", email)
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (app *application) printUser(user *data.User) error {
+	return app.print(
+		map[string]any{"user": user},
+		[]string{"ID", "NAME", "EMAIL", "ACTIVATED", "CREATED"},
+		[][]string{{
+			strconv.FormatInt(user.ID, 10),
+			user.Name,
+			user.Email,
+			strconv.FormatBool(user.Activated),
+			user.CreatedAt.Format(time.RFC3339),
+		}},
+	)
+}
+
+func validationError(v *validator.Validator) error {
+	problems := make([]string, 0, len(v.Errors))
+	for key, message := range v.Errors {
+		problems = append(problems, key+" "+message)
+	}
+
+	return fmt.Errorf("invalid input: %s", strings.Join(problems, "; "))
+}
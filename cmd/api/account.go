@@ -0,0 +1,342 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+	"github.com/PriyanshuSharma23/greenlight/internal/validator"
+)
+
+// updateCurrentUserHandler changes the caller's profile. A new email address
+// isn't applied straight away: it is held as pending until confirmed with the
+// token sent to it, and the current address is told about the request.
+func (app *application) updateCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Name   *string `json:"name"`
+		Email  *string `json:"email"`
+		Locale *string `json:"locale"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+
+	if input.Locale != nil {
+		user.Locale = *input.Locale
+	}
+
+	v := validator.New()
+
+	// asking for the current address again cancels a pending change. An address
+	// that is taken is accepted like any other, so that this doesn't tell who
+	// is registered, and confirming it fails instead.
+	emailChanged := input.Email != nil && !strings.EqualFold(*input.Email, user.Email)
+	if emailChanged {
+		user.PendingEmail = *input.Email
+		data.ValidateEmail(v, user.PendingEmail)
+	} else if input.Email != nil {
+		user.PendingEmail = ""
+	}
+
+	if data.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Transaction(func(tx data.Models) error {
+		err := tx.Users.UpdateUser(user)
+		if err != nil {
+			return err
+		}
+
+		if input.Email == nil {
+			return nil
+		}
+
+		err = tx.Tokens.DeleteAllForUser(user.ID, data.ScopeEmailChange)
+		if err != nil || !emailChanged {
+			return err
+		}
+
+		token, err := tx.Tokens.New(user.ID, 24*time.Hour, data.ScopeEmailChange)
+		if err != nil {
+			return err
+		}
+
+		err = app.enqueueEmail(tx, user.PendingEmail, user.Locale, "email_change_confirm.tmpl", map[string]any{
+			"token": token.Plaintext,
+		})
+		if err != nil {
+			return err
+		}
+
+		return app.enqueueEmail(tx, user.Email, user.Locale, "email_change_notice.tmpl", map[string]any{
+			"newEmail": user.PendingEmail,
+		})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if emailChanged {
+		app.notifyOutbox()
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// confirmEmailChangeHandler swaps in the pending email address of the user
+// the token was issued to.
+func (app *application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidatePlaintextToken(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(input.TokenPlaintext, data.ScopeEmailChange)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			v.AddError("token", "invalid or expired token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.PendingEmail == "" {
+		v.AddError("token", "invalid or expired token")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user.Email, user.PendingEmail = user.PendingEmail, ""
+
+	err = app.models.Transaction(func(tx data.Models) error {
+		err := tx.Users.UpdateUser(user)
+		if err != nil {
+			return err
+		}
+
+		return tx.Tokens.DeleteAllForUser(user.ID, data.ScopeEmailChange)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateEmail):
+			// the address was taken by someone else after the change was
+			// requested, so this token can never succeed
+			err = app.models.Tokens.DeleteAllForUser(user.ID, data.ScopeEmailChange)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			v.AddError("email", "a user with this email already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user, "permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// changePasswordHandler sets a new password once the current one has been
+// given. Every session is revoked, so a fresh one is returned to keep the
+// caller signed in.
+func (app *application) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		Password        string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(validator.NotBlank(input.CurrentPassword), "current_password", "must be provided")
+	data.ValidatePasswordPlaintext(v, input.Password)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.confirmPassword(w, r, user, input.CurrentPassword, "current_password") {
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var env envelope
+
+	err = app.models.Transaction(func(tx data.Models) error {
+		err := tx.Users.UpdateUser(user)
+		if err != nil {
+			return err
+		}
+
+		for _, scope := range []string{data.ScopeAuthentication, data.ScopeRefresh} {
+			err = tx.Tokens.DeleteAllForUser(user.ID, scope)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = app.revokeUserJWTs(tx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		env, err = app.newSession(tx, r, user, nil)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeSession(w, r, http.StatusOK, env, app.contextUsesCookies(r))
+}
+
+func (app *application) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(validator.NotBlank(input.Password), "password", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.confirmPassword(w, r, user, input.Password, "password") {
+		return
+	}
+
+	err = app.revokeUserJWTs(app.models, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.Delete(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if app.contextUsesCookies(r) {
+		app.clearSessionCookies(w)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "account successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// confirmPassword checks plaintext against the user's password, writing a
+// validation error against field when it doesn't match. It reports whether
+// the handler may carry on.
+func (app *application) confirmPassword(w http.ResponseWriter, r *http.Request, user *data.User, plaintext, field string) bool {
+	matches, err := user.Password.Matches(plaintext)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if !matches {
+		v := validator.New()
+		v.AddError(field, "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	return true
+}
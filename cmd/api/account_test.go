@@ -0,0 +1,249 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const (
+	confirmEmailSubject = "Confirm your new Greenlight email address"
+	emailNoticeSubject  = "Your Greenlight email address is being changed"
+)
+
+// emailChangeToken reads the confirmation token out of the latest email
+// change request sent to email.
+func (h *testHarness) emailChangeToken(t *testing.T, email string) string {
+	t.Helper()
+
+	msg := h.mailbox.waitForSubject(t, email, confirmEmailSubject)
+
+	match := activationTokenRx.FindStringSubmatch(msg.PlainBody)
+	if match == nil {
+		t.Fatalf("no token in email to %s:\n%s", email, msg.PlainBody)
+	}
+
+	return match[1]
+}
+
+func TestUpdateCurrentUser(t *testing.T) {
+	h := newTestHarness(t)
+
+	token := h.newUser(t, "alice@example.com")
+
+	var res struct {
+		User struct {
+			Name   string
+			Email  string
+			Locale string
+		}
+	}
+
+	body := map[string]string{"name": "Alice Smith", "locale": "es"}
+	if code := h.do(t, http.MethodPatch, "/v1/users/me", token, body, &res); code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", code, http.StatusOK)
+	}
+
+	if res.User.Name != "Alice Smith" || res.User.Locale != "es" || res.User.Email != "alice@example.com" {
+		t.Errorf("got user %+v", res.User)
+	}
+
+	var errRes struct{ Error map[string]string }
+
+	body = map[string]string{"name": ""}
+	if code := h.do(t, http.MethodPatch, "/v1/users/me", token, body, &errRes); code != http.StatusUnprocessableEntity {
+		t.Errorf("blank name: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	if code := h.do(t, http.MethodPatch, "/v1/users/me", "", body, nil); code != http.StatusUnauthorized {
+		t.Errorf("anonymous: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	h := newTestHarness(t)
+
+	token := h.newUser(t, "alice@example.com")
+
+	var res struct {
+		User struct {
+			Email        string
+			PendingEmail string `json:"pending_email"`
+		}
+	}
+
+	body := map[string]string{"email": "alice@new.example.com"}
+	if code := h.do(t, http.MethodPatch, "/v1/users/me", token, body, &res); code != http.StatusOK {
+		t.Fatalf("request change: got status %d; want %d", code, http.StatusOK)
+	}
+
+	if res.User.Email != "alice@example.com" || res.User.PendingEmail != "alice@new.example.com" {
+		t.Errorf("got email %q pending %q", res.User.Email, res.User.PendingEmail)
+	}
+
+	notice := h.mailbox.waitForSubject(t, "alice@example.com", emailNoticeSubject)
+	if !strings.Contains(notice.PlainBody, "alice@new.example.com") {
+		t.Errorf("notice does not mention the new address:\n%s", notice.PlainBody)
+	}
+
+	// the old address keeps working until the change is confirmed
+	h.authenticate(t, "alice@example.com", "pa55word")
+
+	confirm := map[string]string{"token": h.emailChangeToken(t, "alice@new.example.com")}
+	res.User.PendingEmail = ""
+	if code := h.do(t, http.MethodPut, "/v1/users/email", "", confirm, &res); code != http.StatusOK {
+		t.Fatalf("confirm: got status %d; want %d", code, http.StatusOK)
+	}
+
+	if res.User.Email != "alice@new.example.com" || res.User.PendingEmail != "" {
+		t.Errorf("got email %q pending %q", res.User.Email, res.User.PendingEmail)
+	}
+
+	h.authenticate(t, "alice@new.example.com", "pa55word")
+
+	if code := h.do(t, http.MethodPut, "/v1/users/email", "", confirm, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("reused token: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestChangeEmailDuplicate(t *testing.T) {
+	h := newTestHarness(t)
+
+	token := h.newUser(t, "alice@example.com")
+	h.registerUser(t, "Bob", "bob@example.com", "pa55word")
+
+	var errRes struct{ Error map[string]string }
+
+	// a taken address looks like any other until it is confirmed
+	body := map[string]string{"email": "bob@example.com"}
+	if code := h.do(t, http.MethodPatch, "/v1/users/me", token, body, nil); code != http.StatusOK {
+		t.Fatalf("taken address: got status %d; want %d", code, http.StatusOK)
+	}
+
+	confirm := map[string]string{"token": h.emailChangeToken(t, "bob@example.com")}
+	if code := h.do(t, http.MethodPut, "/v1/users/email", "", confirm, &errRes); code != http.StatusUnprocessableEntity {
+		t.Fatalf("confirm taken address: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	if _, ok := errRes.Error["email"]; !ok {
+		t.Errorf("got errors %v; want key %q", errRes.Error, "email")
+	}
+
+	// carol registers between the request and its confirmation
+	body = map[string]string{"email": "carol@example.com"}
+	if code := h.do(t, http.MethodPatch, "/v1/users/me", token, body, nil); code != http.StatusOK {
+		t.Fatalf("request change: got status %d; want %d", code, http.StatusOK)
+	}
+
+	confirm = map[string]string{"token": h.emailChangeToken(t, "carol@example.com")}
+	h.registerUser(t, "Carol", "carol@example.com", "pa55word")
+
+	errRes.Error = nil
+	if code := h.do(t, http.MethodPut, "/v1/users/email", "", confirm, &errRes); code != http.StatusUnprocessableEntity {
+		t.Fatalf("confirm taken address: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	if _, ok := errRes.Error["email"]; !ok {
+		t.Errorf("got errors %v; want key %q", errRes.Error, "email")
+	}
+
+	h.authenticate(t, "alice@example.com", "pa55word")
+}
+
+func TestShowCurrentUser(t *testing.T) {
+	h := newTestHarness(t)
+
+	token := h.newUser(t, "alice@example.com", "movies:write")
+
+	var res struct {
+		User struct {
+			Email     string
+			Activated bool
+		}
+		Permissions []string
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/users/me", token, nil, &res); code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", code, http.StatusOK)
+	}
+
+	if res.User.Email != "alice@example.com" || !res.User.Activated {
+		t.Errorf("got user %+v", res.User)
+	}
+
+	if strings.Join(res.Permissions, ",") != "movies:read,movies:write" {
+		t.Errorf("got permissions %v", res.Permissions)
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/users/me", "", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("anonymous: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	h := newTestHarness(t)
+
+	token := h.newUser(t, "alice@example.com")
+	other := h.authenticate(t, "alice@example.com", "pa55word")
+
+	var errRes struct{ Error map[string]string }
+
+	body := map[string]string{"current_password": "wrong-password", "password": "n3wpa55word"}
+	if code := h.do(t, http.MethodPut, "/v1/users/me/password", token, body, &errRes); code != http.StatusUnprocessableEntity {
+		t.Fatalf("wrong current password: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	if _, ok := errRes.Error["current_password"]; !ok {
+		t.Errorf("got errors %v; want key %q", errRes.Error, "current_password")
+	}
+
+	var res struct {
+		AuthenticationToken struct{ Token string } `json:"authentication_token"`
+	}
+
+	body["current_password"] = "pa55word"
+	if code := h.do(t, http.MethodPut, "/v1/users/me/password", token, body, &res); code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", code, http.StatusOK)
+	}
+
+	// every existing session is signed out, the returned token replaces them
+	for _, old := range []string{token, other} {
+		if code := h.do(t, http.MethodGet, "/v1/users/me", old, nil, nil); code != http.StatusUnauthorized {
+			t.Errorf("old token: got status %d; want %d", code, http.StatusUnauthorized)
+		}
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/users/me", res.AuthenticationToken.Token, nil, nil); code != http.StatusOK {
+		t.Errorf("new token: got status %d; want %d", code, http.StatusOK)
+	}
+
+	login := map[string]string{"email": "alice@example.com", "password": "pa55word"}
+	if code := h.do(t, http.MethodPost, "/v1/tokens/authentication", "", login, nil); code != http.StatusUnauthorized {
+		t.Errorf("old password: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+
+	h.authenticate(t, "alice@example.com", "n3wpa55word")
+}
+
+func TestDeleteCurrentUser(t *testing.T) {
+	h := newTestHarness(t)
+
+	token := h.newUser(t, "alice@example.com")
+
+	body := map[string]string{"password": "wrong-password"}
+	if code := h.do(t, http.MethodDelete, "/v1/users/me", token, body, nil); code != http.StatusUnprocessableEntity {
+		t.Fatalf("wrong password: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	body["password"] = "pa55word"
+	if code := h.do(t, http.MethodDelete, "/v1/users/me", token, body, nil); code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", code, http.StatusOK)
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/users/me", token, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("deleted user's token: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+
+	// the address is free to register again
+	h.registerUser(t, "Alice", "alice@example.com", "pa55word")
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+)
+
+// createAPIKey creates a key for the user with the given token and returns it.
+func (h *testHarness) createAPIKey(t *testing.T, token string, body map[string]any) *data.APIKey {
+	t.Helper()
+
+	var res struct {
+		APIKey data.APIKey `json:"api_key"`
+	}
+
+	if code := h.do(t, http.MethodPost, "/v1/users/me/api-keys", token, body, &res); code != http.StatusCreated {
+		t.Fatalf("create api key: got status %d", code)
+	}
+
+	return &res.APIKey
+}
+
+// doWithAPIKey sends a request authenticated with key under the ApiKey scheme.
+func (h *testHarness) doWithAPIKey(t *testing.T, method, path, key string) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, h.server.URL+path, strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "ApiKey "+key)
+
+	res, err := h.server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	return res.StatusCode
+}
+
+func TestAPIKeys(t *testing.T) {
+	h := newTestHarness(t)
+
+	token := h.newUser(t, "alice@example.com", "movies:read", "movies:write")
+
+	key := h.createAPIKey(t, token, map[string]any{"name": "nightly import", "permissions": []string{"movies:read"}})
+
+	if !strings.HasPrefix(key.Plaintext, data.APIKeyPrefix) || !strings.HasPrefix(key.Plaintext, key.Prefix) {
+		t.Fatalf("got key %q with prefix %q", key.Plaintext, key.Prefix)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		wantCode int
+	}{
+		{"Granted permission", http.MethodGet, "/v1/movies", http.StatusOK},
+		{"Permission not granted", http.MethodPost, "/v1/movies", http.StatusForbidden},
+		{"Own profile", http.MethodGet, "/v1/users/me", http.StatusOK},
+		{"Manage api keys", http.MethodGet, "/v1/users/me/api-keys", http.StatusForbidden},
+		{"Change password", http.MethodPut, "/v1/users/me/password", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := h.doWithAPIKey(t, tt.method, tt.path, key.Plaintext); code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	// keys are recognised by their prefix when sent as bearer tokens too
+	if code := h.do(t, http.MethodGet, "/v1/movies", key.Plaintext, nil, nil); code != http.StatusOK {
+		t.Errorf("bearer scheme: got status %d; want %d", code, http.StatusOK)
+	}
+
+	var list struct {
+		APIKeys []map[string]any `json:"api_keys"`
+	}
+
+	h.do(t, http.MethodGet, "/v1/users/me/api-keys", token, nil, &list)
+	if len(list.APIKeys) != 1 {
+		t.Fatalf("got %d api keys; want 1", len(list.APIKeys))
+	}
+
+	listed := list.APIKeys[0]
+	if _, ok := listed["key"]; ok || listed["last_used_ip"] != "127.0.0.1" || listed["last_used_at"] == nil {
+		t.Errorf("got listed key %v", listed)
+	}
+
+	if code := h.do(t, http.MethodDelete, "/v1/users/me/api-keys/1", token, nil, nil); code != http.StatusOK {
+		t.Fatalf("delete: got status %d", code)
+	}
+
+	if code := h.doWithAPIKey(t, http.MethodGet, "/v1/movies", key.Plaintext); code != http.StatusUnauthorized {
+		t.Errorf("deleted key: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestAPIKeyValidation(t *testing.T) {
+	h := newTestHarness(t)
+
+	token := h.newUser(t, "alice@example.com", "movies:read")
+	other := h.newUser(t, "bob@example.com")
+
+	tests := []struct {
+		name    string
+		body    map[string]any
+		wantKey string
+	}{
+		{"Missing name", map[string]any{"permissions": []string{"movies:read"}}, "name"},
+		{"Permission not held", map[string]any{"name": "ci", "permissions": []string{"movies:write"}}, "permissions"},
+		{"Expiry in the past", map[string]any{"name": "ci", "expiry": time.Now().Add(-time.Hour)}, "expiry"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res struct{ Error map[string]string }
+
+			code := h.do(t, http.MethodPost, "/v1/users/me/api-keys", token, tt.body, &res)
+			if code != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d; want %d", code, http.StatusUnprocessableEntity)
+			}
+
+			if _, ok := res.Error[tt.wantKey]; !ok {
+				t.Errorf("got errors %v; want key %q", res.Error, tt.wantKey)
+			}
+		})
+	}
+
+	key := h.createAPIKey(t, token, map[string]any{"name": "ci"})
+
+	if code := h.do(t, http.MethodDelete, "/v1/users/me/api-keys/1", other, nil, nil); code != http.StatusNotFound {
+		t.Errorf("someone else's key: got status %d; want %d", code, http.StatusNotFound)
+	}
+
+	if code := h.doWithAPIKey(t, http.MethodGet, "/v1/movies", key.Plaintext+"X"); code != http.StatusUnauthorized {
+		t.Errorf("malformed key: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestAPIKeyRestrictions(t *testing.T) {
+	h := newTestHarness(t)
+	h.skipIfPostgres(t)
+
+	token := h.newUser(t, "alice@example.com", "movies:read")
+
+	expiring := h.createAPIKey(t, token, map[string]any{
+		"name":        "temporary",
+		"permissions": []string{"movies:read"},
+		"expiry":      h.clock.Now().Add(time.Hour),
+	})
+	lasting := h.createAPIKey(t, token, map[string]any{"name": "lasting", "permissions": []string{"movies:read"}})
+
+	h.clock.Advance(2 * time.Hour)
+
+	if code := h.doWithAPIKey(t, http.MethodGet, "/v1/movies", expiring.Plaintext); code != http.StatusUnauthorized {
+		t.Errorf("expired key: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+
+	if code := h.doWithAPIKey(t, http.MethodGet, "/v1/movies", lasting.Plaintext); code != http.StatusOK {
+		t.Errorf("unexpired key: got status %d; want %d", code, http.StatusOK)
+	}
+
+	// a key never has more permissions than its owner currently does
+	user, err := h.app.models.Users.GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = h.app.models.Permissions.RemoveForUser(user.ID, "movies:read")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := h.doWithAPIKey(t, http.MethodGet, "/v1/movies", lasting.Plaintext); code != http.StatusForbidden {
+		t.Errorf("owner lost permission: got status %d; want %d", code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,586 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/PriyanshuSharma23/greenlight/internal/cors"
+	"github.com/PriyanshuSharma23/greenlight/internal/jsonlogger"
+	"github.com/PriyanshuSharma23/greenlight/internal/validator"
+	"gopkg.in/yaml.v3"
+)
+
+const envPrefix = "GREENLIGHT_"
+
+type config struct {
+	env  string
+	cors struct {
+		trustedOrigins []string
+		methods        []string
+		allowedHeaders []string
+		exposedHeaders []string
+		credentials    bool
+		maxAge         time.Duration
+		routes         []string
+	}
+	smtp struct {
+		host     string
+		username string
+		password string
+		sender   string
+		port     int
+		retries  int
+	}
+	mail struct {
+		transport string
+		dir       string
+	}
+	outbox struct {
+		workers       int
+		maxAttempts   int
+		pollInterval  time.Duration
+		backoffBase   time.Duration
+		backoffMax    time.Duration
+		deadRetention time.Duration
+	}
+	jobs struct {
+		workers      int
+		queueSize    int
+		maxAttempts  int
+		timeout      time.Duration
+		pollInterval time.Duration
+		drainTimeout time.Duration
+		backoffBase  time.Duration
+		backoffMax   time.Duration
+	}
+	exports struct {
+		ttl time.Duration
+	}
+	login struct {
+		maxFailures   int
+		maxIPFailures int
+		window        time.Duration
+		lockout       time.Duration
+		delayBase     time.Duration
+		delayMax      time.Duration
+	}
+	twoFactor struct {
+		issuer     string
+		pendingTTL time.Duration
+	}
+	auth struct {
+		mode       string
+		tokenTTL   time.Duration
+		refreshTTL time.Duration
+	}
+	cookies struct {
+		enabled  bool
+		secure   bool
+		sameSite string
+	}
+	jwt struct {
+		keys           []string
+		signingKey     string
+		issuer         string
+		ttl            time.Duration
+		revocationSync time.Duration
+	}
+	oidc struct {
+		providers    []string
+		redirectBase string
+		stateTTL     time.Duration
+	}
+	db struct {
+		dsn          string
+		maxIdleTime  string
+		maxIdleConns int
+		maxOpenConns int
+	}
+	limter struct {
+		rps              float64
+		burst            int
+		credentialsRPS   float64
+		credentialsBurst int
+		enabled          bool
+		tiers            []string
+		permissionTiers  []string
+		routes           []string
+	}
+	migrate struct {
+		onStart bool
+	}
+	health struct {
+		timeout          time.Duration
+		cacheTTL         time.Duration
+		migrationVersion int
+		checkSMTP        bool
+		drainDelay       time.Duration
+	}
+	logLevel       string
+	configFile     string
+	port           int
+	displayVersion bool
+	printConfig    bool
+}
+
+// secretFlags are never printed in full by -print-config.
+var secretFlags = map[string]bool{
+	"db-dsn":         true,
+	"smtp-username":  true,
+	"smtp-password":  true,
+	"jwt-keys":       true,
+	"oidc-providers": true,
+}
+
+// commandLineFlags are only read from the command line. -config has to be known
+// before the file is read, and the others are actions rather than settings;
+// GREENLIGHT_VERSION in particular is commonly set to a version number.
+var commandLineFlags = map[string]bool{
+	"config":       true,
+	"version":      true,
+	"print-config": true,
+}
+
+// loadConfig builds the configuration in layers: flag defaults, then the
+// config file, then GREENLIGHT_* environment variables, then the flags given
+// on the command line. Each layer only overrides the settings it mentions.
+func loadConfig(args []string) (config, *flag.FlagSet, error) {
+	var cfg config
+
+	fs := flag.NewFlagSet("api", flag.ExitOnError)
+
+	fs.StringVar(&cfg.configFile, "config", "", "Path to a JSON, YAML or TOML configuration file")
+
+	fs.StringVar(&cfg.logLevel, "log-level", "info", `minimum level of log messages. options: "info", "error", "fatal", "off"`)
+	fs.StringVar(&cfg.env, "env", "development", `set environment of application. options: "production", "staging", "development"`)
+	fs.IntVar(&cfg.port, "port", 4000, "default port of server")
+
+	fs.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgresSQL DSN")
+
+	fs.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgresSQL max idle connecitons")
+	fs.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgresSQL max open connecitons")
+	fs.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgresSQL max connection idle time")
+
+	fs.BoolVar(&cfg.migrate.onStart, "migrate-on-start", false, "Apply pending database migrations before starting the server")
+
+	fs.Float64Var(&cfg.limter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second.")
+	fs.IntVar(&cfg.limter.burst, "limiter-burst", 4, "Rate limiter maximum burst.")
+	fs.Float64Var(&cfg.limter.credentialsRPS, "limiter-credentials-rps", 20, "Requests per second an IP may make with credentials before they are authenticated")
+	fs.IntVar(&cfg.limter.credentialsBurst, "limiter-credentials-burst", 40, "Burst of requests an IP may make with credentials before they are authenticated")
+	fs.BoolVar(&cfg.limter.enabled, "limiter-enabled", true, "Enable rate limiter")
+
+	cfg.limter.tiers = []string{"auth:0.2:5", "writer:10:20"}
+	cfg.limter.permissionTiers = []string{"movies:write=writer"}
+	cfg.limter.routes = []string{"POST:/v1/tokens/*=auth"}
+
+	fs.Var(fieldsValue{&cfg.limter.tiers}, "limiter-tiers", `Rate limit tiers as "name:rps:burst", with rps "inf" for no limit (space separated)`)
+	fs.Var(fieldsValue{&cfg.limter.permissionTiers}, "limiter-permission-tiers", `Tiers for users with a permission as "permission=tier" (space separated)`)
+	fs.Var(fieldsValue{&cfg.limter.routes}, "limiter-routes", `Extra limits on routes as "[METHOD:]/path=tier", with a trailing * matching a prefix (space separated)`)
+
+	fs.StringVar(&cfg.smtp.host, "smtp-host", "localhost", "SMTP host")
+	fs.IntVar(&cfg.smtp.port, "smtp-port", 2525, "SMTP port")
+	fs.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	fs.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	fs.StringVar(&cfg.smtp.sender, "smtp-sender", "Greenlight <no-reply@greenlight.local>", "SMTP sender")
+	fs.IntVar(&cfg.smtp.retries, "smtp-retires", 3, "SMTP number of retries for failed email delivery")
+
+	fs.StringVar(&cfg.mail.transport, "mail-transport", "smtp", `how email is delivered. options: "smtp", "file", "log", "memory"`)
+	fs.StringVar(&cfg.mail.dir, "mail-dir", "./tmp/mail", `directory for .eml files when -mail-transport is "file"`)
+
+	fs.IntVar(&cfg.outbox.workers, "outbox-workers", 2, "Number of workers delivering queued email")
+	fs.IntVar(&cfg.outbox.maxAttempts, "outbox-max-attempts", 8, "Delivery attempts before an email is moved to the dead letter state")
+	fs.DurationVar(&cfg.outbox.pollInterval, "outbox-poll-interval", 5*time.Second, "How often idle workers check the outbox for due email")
+	fs.DurationVar(&cfg.outbox.backoffBase, "outbox-backoff-base", 10*time.Second, "Delay before the first retry of a failed email, doubled on each attempt")
+	fs.DurationVar(&cfg.outbox.backoffMax, "outbox-backoff-max", time.Hour, "Maximum delay between retries of a failed email")
+	fs.DurationVar(&cfg.outbox.deadRetention, "outbox-dead-retention", 72*time.Hour, "How long a dead email, and the tokens in it, is kept so that it can be retried")
+
+	fs.IntVar(&cfg.jobs.workers, "jobs-workers", 4, "Number of workers running background jobs")
+	fs.IntVar(&cfg.jobs.queueSize, "jobs-queue-size", 100, "Maximum number of in-process jobs waiting for a worker")
+	fs.IntVar(&cfg.jobs.maxAttempts, "jobs-max-attempts", 5, "Attempts before a durable job is given up on")
+	fs.DurationVar(&cfg.jobs.timeout, "jobs-timeout", time.Minute, "Default time limit for a single job")
+	fs.DurationVar(&cfg.jobs.pollInterval, "jobs-poll-interval", 5*time.Second, "How often idle workers check the database for due jobs")
+	fs.DurationVar(&cfg.jobs.drainTimeout, "jobs-drain-timeout", 30*time.Second, "How long shutdown waits for running jobs before cancelling them")
+	fs.DurationVar(&cfg.jobs.backoffBase, "jobs-backoff-base", 10*time.Second, "Delay before the first retry of a failed durable job, doubled on each attempt")
+	fs.DurationVar(&cfg.jobs.backoffMax, "jobs-backoff-max", time.Hour, "Maximum delay between retries of a failed durable job")
+
+	fs.DurationVar(&cfg.exports.ttl, "export-ttl", 24*time.Hour, "How long a personal data export can be downloaded")
+
+	fs.IntVar(&cfg.login.maxFailures, "login-max-failures", 5, "Failed logins for one email before it is locked out")
+	fs.IntVar(&cfg.login.maxIPFailures, "login-max-ip-failures", 50, "Failed logins from one IP address before it is locked out")
+	fs.DurationVar(&cfg.login.window, "login-failure-window", 15*time.Minute, "How long a failed login counts towards a lockout")
+	fs.DurationVar(&cfg.login.lockout, "login-lockout", 15*time.Minute, "How long logins are refused once locked out")
+	fs.DurationVar(&cfg.login.delayBase, "login-delay-base", 250*time.Millisecond, "Delay added to the response of a failed login, doubled on each further failure")
+	fs.DurationVar(&cfg.login.delayMax, "login-delay-max", 4*time.Second, "Maximum delay added to the response of a failed login")
+
+	fs.StringVar(&cfg.twoFactor.issuer, "2fa-issuer", "Greenlight", "Issuer name shown in authenticator apps")
+	fs.DurationVar(&cfg.twoFactor.pendingTTL, "2fa-pending-ttl", 5*time.Minute, "How long after a correct password the second factor can be entered")
+
+	fs.StringVar(&cfg.auth.mode, "auth-mode", "token", `how authentication tokens are issued. options: "token" (opaque, checked against the database), "jwt" (signed, checked without it)`)
+	fs.DurationVar(&cfg.auth.tokenTTL, "auth-token-ttl", 24*time.Hour, "How long an authentication token is valid in the token auth mode")
+	fs.DurationVar(&cfg.auth.refreshTTL, "auth-refresh-ttl", 30*24*time.Hour, "How long a refresh token is valid. Each refresh issues a new one")
+
+	fs.BoolVar(&cfg.cookies.enabled, "session-cookies", false, "Let browser clients keep their session in HttpOnly cookies, with CSRF protection")
+	fs.BoolVar(&cfg.cookies.secure, "session-cookie-secure", true, "Only send session cookies over HTTPS")
+	fs.StringVar(&cfg.cookies.sameSite, "session-cookie-samesite", "lax", `SameSite attribute of session cookies. options: "strict", "lax", "none"`)
+
+	fs.Var(fieldsValue{&cfg.jwt.keys}, "jwt-keys", `JWT keys as "id:HS256:base64-secret" or "id:EdDSA:base64-seed" (space separated)`)
+	fs.StringVar(&cfg.jwt.signingKey, "jwt-signing-key", "", "ID of the key new JWTs are signed with, the first of -jwt-keys by default")
+	fs.StringVar(&cfg.jwt.issuer, "jwt-issuer", "greenlight", "Issuer written to and expected in JWTs")
+	fs.DurationVar(&cfg.jwt.ttl, "jwt-ttl", 15*time.Minute, "How long a JWT is valid")
+	fs.DurationVar(&cfg.jwt.revocationSync, "jwt-revocation-sync", 10*time.Second, "How often the list of revoked JWTs is reloaded from the database")
+
+	fs.Var(fieldsValue{&cfg.oidc.providers}, "oidc-providers", `OpenID Connect providers as "name,issuer,client-id,client-secret" (space separated)`)
+	fs.StringVar(&cfg.oidc.redirectBase, "oidc-redirect-base", "http://localhost:4000", "Public base URL of the API that providers redirect back to")
+	fs.DurationVar(&cfg.oidc.stateTTL, "oidc-state-ttl", 10*time.Minute, "How long a sign-in with a provider may take")
+
+	fs.DurationVar(&cfg.health.timeout, "health-timeout", 2*time.Second, "Timeout for each readiness check")
+	fs.DurationVar(&cfg.health.cacheTTL, "health-cache-ttl", time.Second, "How long readiness results are reused between probes")
+	fs.IntVar(&cfg.health.migrationVersion, "health-migration-version", latestMigration(), "Minimum schema migration version required to report ready")
+	fs.BoolVar(&cfg.health.checkSMTP, "health-check-smtp", false, "Dial the SMTP relay as part of the readiness check")
+	fs.DurationVar(&cfg.health.drainDelay, "health-drain-delay", 15*time.Second, "How long shutdown keeps serving while reporting draining before it stops accepting connections; at least the readiness probe interval plus -health-cache-ttl")
+
+	cfg.cors.methods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+	cfg.cors.allowedHeaders = []string{"Authorization", "Content-Type"}
+
+	fs.Var(fieldsValue{&cfg.cors.trustedOrigins}, "cors-trusted-origins", `Trusted CORS origins, exact, with wildcards like "https://*.example.com", as "regexp:..." or "*" (space separated)`)
+	fs.Var(fieldsValue{&cfg.cors.methods}, "cors-allowed-methods", "Methods trusted origins may use (space separated)")
+	fs.Var(fieldsValue{&cfg.cors.allowedHeaders}, "cors-allowed-headers", "Request headers trusted origins may send (space separated)")
+	fs.Var(fieldsValue{&cfg.cors.exposedHeaders}, "cors-exposed-headers", "Response headers trusted origins may read (space separated)")
+	fs.BoolVar(&cfg.cors.credentials, "cors-credentials", false, "Let trusted origins send cookies. Always on with -session-cookies")
+	fs.DurationVar(&cfg.cors.maxAge, "cors-max-age", 10*time.Minute, "How long browsers may cache a preflight response")
+	fs.Var(fieldsValue{&cfg.cors.routes}, "cors-routes", `Per-route overrides as "/path/*;origins=a,b;credentials=false;max-age=1h" (space separated)`)
+
+	fs.BoolVar(&cfg.displayVersion, "version", false, "Display current version of the application")
+	fs.BoolVar(&cfg.printConfig, "print-config", false, "Print the effective configuration with secrets redacted and exit")
+
+	// Parse the command line first so we know where the config file lives and
+	// which settings must not be overridden by the file or the environment.
+	err := fs.Parse(args)
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	if !explicit["config"] {
+		cfg.configFile = os.Getenv(envName("config"))
+	}
+
+	if cfg.configFile != "" {
+		values, err := readConfigFile(cfg.configFile)
+		if err != nil {
+			return cfg, nil, err
+		}
+
+		for name, value := range values {
+			if fs.Lookup(name) == nil || commandLineFlags[name] {
+				return cfg, nil, fmt.Errorf("config file %s: unknown setting %q", cfg.configFile, name)
+			}
+
+			if explicit[name] {
+				continue
+			}
+
+			err = fs.Set(name, value)
+			if err != nil {
+				return cfg, nil, fmt.Errorf("config file %s: invalid value for %q: %w", cfg.configFile, name, err)
+			}
+		}
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || explicit[f.Name] || commandLineFlags[f.Name] {
+			return
+		}
+
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("environment variable %s: %w", envName(f.Name), setErr)
+		}
+	})
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	return cfg, fs, nil
+}
+
+// fieldsValue is a flag.Value holding a space separated list, which unlike
+// flag.Func can report its current value back for -print-config.
+type fieldsValue struct{ dst *[]string }
+
+func (f fieldsValue) String() string {
+	if f.dst == nil {
+		return ""
+	}
+	return strings.Join(*f.dst, " ")
+}
+
+func (f fieldsValue) Set(s string) error {
+	*f.dst = strings.Fields(s)
+	return nil
+}
+
+// latestMigration is the newest migration embedded in the binary, which is the
+// schema version the server expects by default.
+func latestMigration() int {
+	m, err := newMigrator(nil, nil)
+	if err != nil {
+		return 0
+	}
+
+	return int(m.Latest())
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// readConfigFile decodes the file according to its extension and flattens it
+// into flag names, so {"db": {"dsn": "..."}} becomes "db-dsn".
+func readConfigFile(path string) (map[string]string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := make(map[string]any)
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(raw, &doc)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, &doc)
+	case ".toml":
+		err = toml.Unmarshal(raw, &doc)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format, use .json, .yaml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	flattenConfig("", doc, values)
+
+	return values, nil
+}
+
+func flattenConfig(prefix string, doc map[string]any, values map[string]string) {
+	for key, value := range doc {
+		name := strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+		if prefix != "" {
+			name = prefix + "-" + name
+		}
+
+		switch value := value.(type) {
+		case map[string]any:
+			flattenConfig(name, value, values)
+		case []any:
+			items := make([]string, len(value))
+			for i := range value {
+				items[i] = configValue(value[i])
+			}
+			values[name] = strings.Join(items, " ")
+		default:
+			values[name] = configValue(value)
+		}
+	}
+}
+
+func configValue(value any) string {
+	switch value := value.(type) {
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func validateConfig(v *validator.Validator, cfg config) {
+	v.Check(validator.In(cfg.env, "development", "staging", "production"), "env", `must be one of "development", "staging" or "production"`)
+	v.Check(cfg.port > 0 && cfg.port <= 65535, "port", "must be a valid TCP port")
+
+	_, err := jsonlogger.ParseLevel(cfg.logLevel)
+	v.Check(err == nil, "log-level", `must be one of "info", "error", "fatal" or "off"`)
+
+	v.Check(validator.NotBlank(cfg.db.dsn), "db-dsn", "must be provided")
+	v.Check(validator.Min(cfg.db.maxOpenConns, 1), "db-max-open-conns", "must be greater than or equal to 1")
+	v.Check(validator.Min(cfg.db.maxIdleConns, 0), "db-max-idle-conns", "must not be negative")
+
+	_, err = time.ParseDuration(cfg.db.maxIdleTime)
+	v.Check(err == nil, "db-max-idle-time", "must be a valid duration")
+
+	if cfg.limter.enabled {
+		v.Check(cfg.limter.rps > 0, "limiter-rps", "must be greater than 0")
+		v.Check(validator.Min(cfg.limter.burst, 1), "limiter-burst", "must be greater than or equal to 1")
+		v.Check(cfg.limter.credentialsRPS > 0, "limiter-credentials-rps", "must be greater than 0")
+		v.Check(validator.Min(cfg.limter.credentialsBurst, 1), "limiter-credentials-burst", "must be greater than or equal to 1")
+
+		_, err = newLimiterPolicy(cfg)
+		v.Check(err == nil, "limiter-tiers", fmt.Sprint(err))
+	}
+
+	v.Check(validator.In(cfg.mail.transport, "smtp", "file", "log", "memory"), "mail-transport", `must be one of "smtp", "file", "log" or "memory"`)
+
+	if cfg.mail.transport == "smtp" {
+		v.Check(validator.NotBlank(cfg.smtp.host), "smtp-host", "must be provided")
+		v.Check(cfg.smtp.port > 0 && cfg.smtp.port <= 65535, "smtp-port", "must be a valid TCP port")
+	}
+
+	if cfg.mail.transport == "file" {
+		v.Check(validator.NotBlank(cfg.mail.dir), "mail-dir", "must be provided")
+	}
+
+	v.Check(validator.NotBlank(cfg.smtp.sender), "smtp-sender", "must be provided")
+	v.Check(validator.Min(cfg.smtp.retries, 1), "smtp-retires", "must be greater than or equal to 1")
+
+	v.Check(validator.Min(cfg.outbox.workers, 1), "outbox-workers", "must be greater than or equal to 1")
+	v.Check(validator.Min(cfg.outbox.maxAttempts, 1), "outbox-max-attempts", "must be greater than or equal to 1")
+	v.Check(cfg.outbox.pollInterval > 0, "outbox-poll-interval", "must be greater than 0")
+	v.Check(cfg.outbox.backoffBase > 0, "outbox-backoff-base", "must be greater than 0")
+	v.Check(cfg.outbox.backoffMax >= cfg.outbox.backoffBase, "outbox-backoff-max", "must not be less than outbox-backoff-base")
+	v.Check(cfg.outbox.deadRetention > 0, "outbox-dead-retention", "must be greater than 0")
+
+	v.Check(validator.Min(cfg.jobs.workers, 1), "jobs-workers", "must be greater than or equal to 1")
+	v.Check(validator.Min(cfg.jobs.queueSize, 0), "jobs-queue-size", "must not be negative")
+	v.Check(validator.Min(cfg.jobs.maxAttempts, 1), "jobs-max-attempts", "must be greater than or equal to 1")
+	v.Check(cfg.jobs.timeout > 0, "jobs-timeout", "must be greater than 0")
+	v.Check(cfg.jobs.pollInterval > 0, "jobs-poll-interval", "must be greater than 0")
+	v.Check(cfg.jobs.drainTimeout > 0, "jobs-drain-timeout", "must be greater than 0")
+	v.Check(cfg.jobs.backoffBase > 0, "jobs-backoff-base", "must be greater than 0")
+	v.Check(cfg.jobs.backoffMax >= cfg.jobs.backoffBase, "jobs-backoff-max", "must not be less than jobs-backoff-base")
+
+	v.Check(cfg.exports.ttl > 0, "export-ttl", "must be greater than 0")
+
+	v.Check(validator.Min(cfg.login.maxFailures, 1), "login-max-failures", "must be greater than or equal to 1")
+	v.Check(validator.Min(cfg.login.maxIPFailures, 1), "login-max-ip-failures", "must be greater than or equal to 1")
+	v.Check(cfg.login.window > 0, "login-failure-window", "must be greater than 0")
+	v.Check(cfg.login.lockout > 0, "login-lockout", "must be greater than 0")
+	v.Check(cfg.login.delayBase >= 0, "login-delay-base", "must not be negative")
+	v.Check(cfg.login.delayMax >= cfg.login.delayBase, "login-delay-max", "must not be less than login-delay-base")
+
+	v.Check(validator.NotBlank(cfg.twoFactor.issuer), "2fa-issuer", "must be provided")
+	v.Check(!strings.Contains(cfg.twoFactor.issuer, ":"), "2fa-issuer", "must not contain a colon")
+	v.Check(cfg.twoFactor.pendingTTL > 0, "2fa-pending-ttl", "must be greater than 0")
+
+	v.Check(validator.In(cfg.auth.mode, "token", "jwt"), "auth-mode", `must be one of "token" or "jwt"`)
+	v.Check(cfg.auth.tokenTTL > 0, "auth-token-ttl", "must be greater than 0")
+	v.Check(cfg.auth.refreshTTL > 0, "auth-refresh-ttl", "must be greater than 0")
+
+	if cfg.cookies.enabled {
+		v.Check(validator.In(cfg.cookies.sameSite, "strict", "lax", "none"), "session-cookie-samesite", `must be one of "strict", "lax" or "none"`)
+		v.Check(cfg.cookies.sameSite != "none" || cfg.cookies.secure, "session-cookie-samesite", `must not be "none" unless session-cookie-secure is set`)
+	}
+
+	if cfg.auth.mode == "jwt" {
+		_, err = newJWTKeySet(cfg)
+		v.Check(err == nil, "jwt-keys", fmt.Sprint(err))
+		v.Check(validator.NotBlank(cfg.jwt.issuer), "jwt-issuer", "must be provided")
+		v.Check(cfg.jwt.ttl > 0, "jwt-ttl", "must be greater than 0")
+		v.Check(cfg.jwt.revocationSync > 0, "jwt-revocation-sync", "must be greater than 0")
+	}
+
+	if len(cfg.oidc.providers) > 0 {
+		_, err = newOIDCProviders(cfg)
+		v.Check(err == nil, "oidc-providers", fmt.Sprint(err))
+
+		u, err := url.Parse(cfg.oidc.redirectBase)
+		v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "oidc-redirect-base", "must be an absolute http or https URL")
+		v.Check(cfg.oidc.stateTTL > 0, "oidc-state-ttl", "must be greater than 0")
+	}
+
+	v.Check(cfg.health.timeout > 0, "health-timeout", "must be greater than 0")
+	v.Check(cfg.health.cacheTTL >= 0, "health-cache-ttl", "must not be negative")
+	v.Check(cfg.health.drainDelay >= 0, "health-drain-delay", "must not be negative")
+	v.Check(validator.Min(cfg.health.migrationVersion, 0), "health-migration-version", "must not be negative")
+
+	_, err = cors.New(corsPolicy(cfg))
+	v.Check(err == nil, "cors-trusted-origins", fmt.Sprint(err))
+
+	if err == nil {
+		_, err = newCORS(cfg)
+		v.Check(err == nil, "cors-routes", fmt.Sprint(err))
+	}
+}
+
+func configError(v *validator.Validator) error {
+	keys := make([]string, 0, len(v.Errors))
+	for key := range v.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	problems := make([]string, len(keys))
+	for i, key := range keys {
+		problems[i] = fmt.Sprintf("%s %s", key, v.Errors[key])
+	}
+
+	return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+}
+
+var dsnPasswordRx = regexp.MustCompile(`password=\S+`)
+
+// configSettings returns the effective value of every setting keyed by flag
+// name.
+func configSettings(fs *flag.FlagSet) map[string]string {
+	settings := make(map[string]string)
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "version" || f.Name == "print-config" {
+			return
+		}
+
+		settings[f.Name] = f.Value.String()
+	})
+
+	return settings
+}
+
+func writeConfig(w io.Writer, fs *flag.FlagSet) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+
+	settings := configSettings(fs)
+	for name, value := range settings {
+		settings[name] = redact(name, value)
+	}
+
+	return enc.Encode(settings)
+}
+
+func redact(name, value string) string {
+	if !secretFlags[name] || value == "" {
+		return value
+	}
+
+	if name == "db-dsn" {
+		if u, err := url.Parse(value); err == nil && u.Scheme != "" {
+			return u.Redacted()
+		}
+		return dsnPasswordRx.ReplaceAllString(value, "password=xxxxx")
+	}
+
+	return "xxxxx"
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigCommandLineOnly(t *testing.T) {
+	t.Setenv("GREENLIGHT_VERSION", "1.2.3")
+	t.Setenv("GREENLIGHT_PRINT_CONFIG", "true")
+
+	cfg, _, err := loadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.displayVersion || cfg.printConfig {
+		t.Errorf("got -version %t and -print-config %t from the environment", cfg.displayVersion, cfg.printConfig)
+	}
+
+	cfg, _, err = loadConfig([]string{"-version"})
+	if err != nil || !cfg.displayVersion {
+		t.Errorf("command line: got -version %t and error %v", cfg.displayVersion, err)
+	}
+
+	for _, name := range []string{"version", "print-config"} {
+		path := filepath.Join(t.TempDir(), "config.json")
+
+		err := os.WriteFile(path, []byte(`{"`+name+`": true}`), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := loadConfig([]string{"-config", path}); err == nil {
+			t.Errorf("config file setting %s: got no error", name)
+		}
+	}
+}
@@ -9,7 +9,14 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey   = contextKey("user")
+	apiKeyContextKey = contextKey("apiKey")
+	claimsContextKey = contextKey("claims")
+	cookieContextKey = contextKey("cookie")
+	csrfContextKey   = contextKey("csrf")
+	limitContextKey  = contextKey("limit")
+)
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -24,3 +31,67 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 
 	return user
 }
+
+// contextSetAPIKey records that the request was authenticated with key rather
+// than an authentication token.
+func (app *application) contextSetAPIKey(r *http.Request, key *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// contextGetAPIKey returns the API key the request was authenticated with, or
+// nil if it wasn't.
+func (app *application) contextGetAPIKey(r *http.Request) *data.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return key
+}
+
+// contextSetClaims records that the request was authenticated with a JWT
+// carrying claims.
+func (app *application) contextSetClaims(r *http.Request, claims *authClaims) *http.Request {
+	ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+	return r.WithContext(ctx)
+}
+
+// contextGetClaims returns the claims of the JWT the request was
+// authenticated with, or nil if it wasn't.
+func (app *application) contextGetClaims(r *http.Request) *authClaims {
+	claims, _ := r.Context().Value(claimsContextKey).(*authClaims)
+	return claims
+}
+
+// contextSetUsesCookies records that the request was authenticated with the
+// session cookie rather than the Authorization header.
+func (app *application) contextSetUsesCookies(r *http.Request) *http.Request {
+	ctx := context.WithValue(r.Context(), cookieContextKey, true)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextUsesCookies(r *http.Request) bool {
+	uses, _ := r.Context().Value(cookieContextKey).(bool)
+	return uses
+}
+
+// contextSetCSRFFailed records that the request came with a valid session
+// cookie but without its CSRF token, so it was treated as anonymous.
+func (app *application) contextSetCSRFFailed(r *http.Request) *http.Request {
+	ctx := context.WithValue(r.Context(), csrfContextKey, true)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextCSRFFailed(r *http.Request) bool {
+	failed, _ := r.Context().Value(csrfContextKey).(bool)
+	return failed
+}
+
+// contextSetLimiterCharge records the request with credentials taken from the
+// client IP's rate limit, to be given back if it turns out to be from a user.
+func (app *application) contextSetLimiterCharge(r *http.Request, charge *limiterCharge) *http.Request {
+	ctx := context.WithValue(r.Context(), limitContextKey, charge)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetLimiterCharge(r *http.Request) *limiterCharge {
+	charge, _ := r.Context().Value(limitContextKey).(*limiterCharge)
+	return charge
+}
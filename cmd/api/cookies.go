@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+)
+
+// Browser clients can keep their session in cookies that scripts can't read.
+// Since browsers attach cookies to requests from other sites too, requests
+// authenticated by cookie that change anything must also send the CSRF token
+// in a header. Other sites can't learn it: it is a cookie on the API's own
+// domain and is otherwise only in response bodies, which CORS keeps from
+// untrusted origins.
+const (
+	sessionCookie = "greenlight_session"
+	refreshCookie = "greenlight_refresh"
+	csrfCookie    = "greenlight_csrf"
+	csrfHeader    = "X-CSRF-Token"
+)
+
+// writeSession sends the tokens newSession issued, as the body or, when the
+// client asked for cookies and they are enabled, as cookies. The body then
+// only carries the expiry and the CSRF token.
+func (app *application) writeSession(w http.ResponseWriter, r *http.Request, status int, env envelope, useCookies bool) {
+	if !useCookies || !app.config().cookies.enabled {
+		err := app.writeJSON(w, status, env, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	token := env["authentication_token"].(*data.Token)
+	refresh := env["refresh_token"].(*data.Token)
+
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	csrf := base64.RawURLEncoding.EncodeToString(b)
+
+	http.SetCookie(w, app.sessionCookie(sessionCookie, token.Plaintext, "/", token.Expiry, true))
+	http.SetCookie(w, app.sessionCookie(refreshCookie, refresh.Plaintext, "/v1/tokens/", refresh.Expiry, true))
+	http.SetCookie(w, app.sessionCookie(csrfCookie, csrf, "/", refresh.Expiry, false))
+
+	env = envelope{"session": envelope{"expiry": token.Expiry, "refresh_expiry": refresh.Expiry, "csrf_token": csrf}}
+
+	err = app.writeJSON(w, status, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// clearSessionCookies makes the browser forget its session.
+func (app *application) clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, app.sessionCookie(sessionCookie, "", "/", time.Time{}, true))
+	http.SetCookie(w, app.sessionCookie(refreshCookie, "", "/v1/tokens/", time.Time{}, true))
+	http.SetCookie(w, app.sessionCookie(csrfCookie, "", "/", time.Time{}, false))
+}
+
+// sessionCookie builds a cookie that lasts until expiry, or deletes it when
+// expiry is zero.
+func (app *application) sessionCookie(name, value, path string, expiry time.Time, httpOnly bool) *http.Cookie {
+	cfg := app.config().cookies
+
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   -1,
+		HttpOnly: httpOnly,
+		Secure:   cfg.secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	if !expiry.IsZero() {
+		cookie.MaxAge = int(time.Until(expiry).Seconds())
+	}
+
+	switch cfg.sameSite {
+	case "strict":
+		cookie.SameSite = http.SameSiteStrictMode
+	case "none":
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+
+	return cookie
+}
+
+// cookieValue returns the named cookie when session cookies are enabled.
+func (app *application) cookieValue(r *http.Request, name string) string {
+	if !app.config().cookies.enabled {
+		return ""
+	}
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+
+	return cookie.Value
+}
+
+// validCSRF reports whether a request may act on the cookies it carries:
+// reading is always safe, anything else needs the CSRF cookie echoed back.
+func (app *application) validCSRF(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	cookie := app.cookieValue(r, csrfCookie)
+	header := r.Header.Get(csrfHeader)
+
+	return cookie != "" && subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
+
+// requestToken returns the authentication token the request was made with,
+// from the Authorization header or the session cookie.
+func (app *application) requestToken(r *http.Request) string {
+	if app.contextUsesCookies(r) {
+		return app.cookieValue(r, sessionCookie)
+	}
+
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"testing"
+)
+
+// useCookies enables session cookies, without Secure since the test server
+// speaks plain HTTP.
+func (h *testHarness) useCookies(t *testing.T) {
+	t.Helper()
+
+	cfg := *h.app.config()
+	cfg.cookies.enabled = true
+	cfg.cookies.secure = false
+	h.app.cfg.Store(&cfg)
+}
+
+// browser is a client that keeps cookies like a browser does.
+type browser struct {
+	h      *testHarness
+	client *http.Client
+}
+
+func (h *testHarness) newBrowser(t *testing.T) *browser {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &browser{h: h, client: &http.Client{Jar: jar}}
+}
+
+func (b *browser) do(t *testing.T, method, path, csrf string, body, dst any) int {
+	t.Helper()
+
+	var r io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequest(method, b.h.server.URL+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if csrf != "" {
+		req.Header.Set(csrfHeader, csrf)
+	}
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if dst != nil {
+		err = json.NewDecoder(res.Body).Decode(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return res.StatusCode
+}
+
+type cookieSession struct {
+	AuthenticationToken any `json:"authentication_token"`
+	Session             struct {
+		CSRFToken string `json:"csrf_token"`
+	} `json:"session"`
+}
+
+func (b *browser) login(t *testing.T, email, password string) string {
+	t.Helper()
+
+	var res cookieSession
+
+	body := map[string]any{"email": email, "password": password, "cookie": true}
+	if code := b.do(t, http.MethodPost, "/v1/tokens/authentication", "", body, &res); code != http.StatusCreated {
+		t.Fatalf("login: got status %d; want %d", code, http.StatusCreated)
+	}
+
+	if res.AuthenticationToken != nil || res.Session.CSRFToken == "" {
+		t.Fatalf("login: got response %+v", res)
+	}
+
+	return res.Session.CSRFToken
+}
+
+func TestCookieSession(t *testing.T) {
+	h := newTestHarness(t)
+	h.useCookies(t)
+
+	h.newUser(t, "alice@example.com")
+
+	b := h.newBrowser(t)
+	csrf := b.login(t, "alice@example.com", "pa55word")
+
+	u, _ := url.Parse(h.server.URL + "/v1/tokens/refresh")
+	for _, c := range b.client.Jar.Cookies(u) {
+		if c.Name == csrfCookie && c.Value != csrf {
+			t.Errorf("got CSRF cookie %q; want %q", c.Value, csrf)
+		}
+	}
+
+	if code := b.do(t, http.MethodGet, "/v1/users/me", "", nil, nil); code != http.StatusOK {
+		t.Errorf("show current user: got status %d; want %d", code, http.StatusOK)
+	}
+
+	body := map[string]string{"name": "Alice"}
+
+	if code := b.do(t, http.MethodPatch, "/v1/users/me", "", body, nil); code != http.StatusForbidden {
+		t.Errorf("update without CSRF token: got status %d; want %d", code, http.StatusForbidden)
+	}
+
+	if code := b.do(t, http.MethodPatch, "/v1/users/me", "wrong", body, nil); code != http.StatusForbidden {
+		t.Errorf("update with wrong CSRF token: got status %d; want %d", code, http.StatusForbidden)
+	}
+
+	if code := b.do(t, http.MethodPatch, "/v1/users/me", csrf, body, nil); code != http.StatusOK {
+		t.Errorf("update with CSRF token: got status %d; want %d", code, http.StatusOK)
+	}
+
+	// the refresh cookie is enough to refresh, which hands out a new CSRF token
+	var res cookieSession
+
+	if code := b.do(t, http.MethodPost, "/v1/tokens/refresh", "", nil, &res); code != http.StatusCreated || res.Session.CSRFToken == "" {
+		t.Fatalf("refresh: got status %d and response %+v", code, res)
+	}
+
+	if code := b.do(t, http.MethodPatch, "/v1/users/me", csrf, body, nil); code != http.StatusForbidden {
+		t.Errorf("update with old CSRF token: got status %d; want %d", code, http.StatusForbidden)
+	}
+
+	csrf = res.Session.CSRFToken
+
+	if code := b.do(t, http.MethodDelete, "/v1/tokens/authentication", csrf, nil, nil); code != http.StatusOK {
+		t.Fatalf("logout: got status %d; want %d", code, http.StatusOK)
+	}
+
+	if code := b.do(t, http.MethodGet, "/v1/users/me", "", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("after logout: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+
+	if code := b.do(t, http.MethodPost, "/v1/tokens/refresh", "", nil, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("refresh after logout: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestStaleCookie(t *testing.T) {
+	h := newTestHarness(t)
+	h.useCookies(t)
+
+	h.newUser(t, "alice@example.com")
+
+	b := h.newBrowser(t)
+	b.login(t, "alice@example.com", "pa55word")
+
+	user, err := h.app.models.Users.GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the session ends elsewhere, but the browser still has the cookie
+	err = h.app.models.Tokens.DeleteAllForUser(user.ID, "authentication")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := b.do(t, http.MethodGet, "/v1/users/me", "", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("show current user: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+
+	b.login(t, "alice@example.com", "pa55word")
+}
+
+func TestCookiesDisabled(t *testing.T) {
+	h := newTestHarness(t)
+
+	h.newUser(t, "alice@example.com")
+
+	var res struct {
+		AuthenticationToken struct{ Token string } `json:"authentication_token"`
+	}
+
+	body := map[string]any{"email": "alice@example.com", "password": "pa55word", "cookie": true}
+	if code := h.do(t, http.MethodPost, "/v1/tokens/authentication", "", body, &res); code != http.StatusCreated || res.AuthenticationToken.Token == "" {
+		t.Errorf("login: got status %d and token %q", code, res.AuthenticationToken.Token)
+	}
+}
+
+func TestCookieCORS(t *testing.T) {
+	h := newTestHarness(t)
+	h.useCookies(t)
+
+	cfg := *h.app.config()
+	cfg.cors.trustedOrigins = []string{"http://localhost:9000"}
+	h.app.cfg.Store(&cfg)
+
+	req, err := http.NewRequest(http.MethodOptions, h.server.URL+"/v1/users/me", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Origin", "http://localhost:9000")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+
+	res, err := h.server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if got := res.Header.Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("got Access-Control-Allow-Credentials %q; want %q", got, "true")
+	}
+
+	if got := res.Header.Get("Access-Control-Allow-Headers"); !bytes.Contains([]byte(got), []byte(csrfHeader)) {
+		t.Errorf("got Access-Control-Allow-Headers %q; want it to include %s", got, csrfHeader)
+	}
+}
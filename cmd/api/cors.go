@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/cors"
+)
+
+// corsPolicy is the base CORS policy from the configuration. Session cookies
+// need credentials and the CSRF header, so they are added whenever those are
+// enabled.
+func corsPolicy(cfg config) cors.Policy {
+	p := cors.Policy{
+		Origins:        cfg.cors.trustedOrigins,
+		Methods:        cfg.cors.methods,
+		AllowedHeaders: cfg.cors.allowedHeaders,
+		ExposedHeaders: cfg.cors.exposedHeaders,
+		Credentials:    cfg.cors.credentials || cfg.cookies.enabled,
+		MaxAge:         cfg.cors.maxAge,
+	}
+
+	if cfg.cookies.enabled {
+		p.AllowedHeaders = append(p.AllowedHeaders[:len(p.AllowedHeaders):len(p.AllowedHeaders)], csrfHeader)
+	}
+
+	return p
+}
+
+// newCORS builds the CORS policy engine, with the -cors-routes overrides
+// applied on top of the base policy.
+func newCORS(cfg config) (*cors.Engine, error) {
+	base := corsPolicy(cfg)
+
+	routes := make([]cors.Route, len(cfg.cors.routes))
+
+	for i, spec := range cfg.cors.routes {
+		route, err := cors.ParseRoute(spec, base)
+		if err != nil {
+			return nil, err
+		}
+		routes[i] = route
+	}
+
+	return cors.New(base, routes...)
+}
+
+// corsCache keeps the engine built from the current configuration, and
+// rebuilds it when the configuration is replaced.
+type corsCache struct {
+	mu  sync.Mutex
+	cfg *config
+	e   *cors.Engine
+}
+
+func (c *corsCache) engine(cfg *config) (*cors.Engine, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cfg == cfg {
+		return c.e, nil
+	}
+
+	e, err := newCORS(*cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c.cfg, c.e = cfg, e
+
+	return e, nil
+}
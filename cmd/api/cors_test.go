@@ -0,0 +1,169 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// The example pages in cmd/examples/cors are served from localhost:9000 and
+// call the API on localhost:4000. These tests make the requests a browser
+// makes for them.
+
+const exampleOrigin = "http://localhost:9000"
+
+func (h *testHarness) corsRequest(t *testing.T, method, path string, header map[string]string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, h.server.URL+path, strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Origin", exampleOrigin)
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+
+	res, err := h.server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	return res
+}
+
+func (h *testHarness) setCORS(t *testing.T, origins []string, routes ...string) {
+	t.Helper()
+
+	cfg := *h.app.config()
+	cfg.cors.trustedOrigins = origins
+	cfg.cors.routes = routes
+
+	if _, err := newCORS(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	h.app.cfg.Store(&cfg)
+}
+
+// TestCORSSimpleExample is cmd/examples/cors/simple: a plain GET, which needs
+// no preflight.
+func TestCORSSimpleExample(t *testing.T) {
+	tests := []struct {
+		name    string
+		origins []string
+		want    string
+	}{
+		{"Not trusted", nil, ""},
+		{"Exact origin", []string{exampleOrigin}, exampleOrigin},
+		{"Wildcard port", []string{"http://localhost:*"}, exampleOrigin},
+		{"Regexp", []string{`regexp:http://localhost:9[0-9]{3}`}, exampleOrigin},
+		{"Other origin", []string{"https://*.example.com"}, ""},
+		{"Any origin", []string{"*"}, "*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHarness(t)
+			h.setCORS(t, tt.origins)
+
+			res := h.corsRequest(t, http.MethodGet, "/v1/healthcheck", nil)
+
+			if res.StatusCode != http.StatusOK {
+				t.Errorf("got status %d; want %d", res.StatusCode, http.StatusOK)
+			}
+
+			if got := res.Header.Get("Access-Control-Allow-Origin"); got != tt.want {
+				t.Errorf("got Access-Control-Allow-Origin %q; want %q", got, tt.want)
+			}
+
+			if !strings.Contains(strings.Join(res.Header.Values("Vary"), ","), "Origin") {
+				t.Errorf("got Vary %q; want it to include Origin", res.Header.Values("Vary"))
+			}
+		})
+	}
+}
+
+// TestCORSPreflightExample is cmd/examples/cors/preflight: a JSON POST to the
+// login endpoint, which the browser checks with a preflight request first.
+func TestCORSPreflightExample(t *testing.T) {
+	h := newTestHarness(t)
+	h.setCORS(t, []string{exampleOrigin})
+
+	res := h.corsRequest(t, http.MethodOptions, "/v1/tokens/authentication", map[string]string{
+		"Access-Control-Request-Method":  http.MethodPost,
+		"Access-Control-Request-Headers": "content-type",
+	})
+
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("got status %d; want %d", res.StatusCode, http.StatusNoContent)
+	}
+
+	want := map[string]string{
+		"Access-Control-Allow-Origin":  exampleOrigin,
+		"Access-Control-Allow-Methods": "GET, POST, PUT, PATCH, DELETE",
+		"Access-Control-Allow-Headers": "Authorization, Content-Type",
+		"Access-Control-Max-Age":       "600",
+	}
+
+	for name, value := range want {
+		if got := res.Header.Get(name); got != value {
+			t.Errorf("got %s %q; want %q", name, got, value)
+		}
+	}
+
+	if got := res.Header.Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("got Access-Control-Allow-Credentials %q without session cookies", got)
+	}
+
+	// the login itself then goes through with the origin allowed
+	res = h.corsRequest(t, http.MethodPost, "/v1/tokens/authentication", map[string]string{"Content-Type": "application/json"})
+
+	if got := res.Header.Get("Access-Control-Allow-Origin"); got != exampleOrigin {
+		t.Errorf("login: got Access-Control-Allow-Origin %q; want %q", got, exampleOrigin)
+	}
+}
+
+func TestCORSRouteOverride(t *testing.T) {
+	h := newTestHarness(t)
+	h.setCORS(t, []string{"https://app.example.com"}, "/v1/healthcheck;origins=*", "/v1/tokens/*;origins="+exampleOrigin+";credentials=true;max-age=1h")
+
+	if got := h.corsRequest(t, http.MethodGet, "/v1/healthcheck", nil).Header.Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("healthcheck: got Access-Control-Allow-Origin %q; want %q", got, "*")
+	}
+
+	if got := h.corsRequest(t, http.MethodGet, "/v1/movies", nil).Header.Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("movies: got Access-Control-Allow-Origin %q; want none", got)
+	}
+
+	res := h.corsRequest(t, http.MethodOptions, "/v1/tokens/authentication", map[string]string{"Access-Control-Request-Method": http.MethodPost})
+
+	want := map[string]string{
+		"Access-Control-Allow-Origin":      exampleOrigin,
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Max-Age":           "3600",
+	}
+
+	for name, value := range want {
+		if got := res.Header.Get(name); got != value {
+			t.Errorf("tokens: got %s %q; want %q", name, got, value)
+		}
+	}
+}
+
+func TestCORSExposedHeaders(t *testing.T) {
+	h := newTestHarness(t)
+
+	cfg := *h.app.config()
+	cfg.cors.trustedOrigins = []string{exampleOrigin}
+	cfg.cors.exposedHeaders = []string{"Retry-After", "X-Request-Id"}
+	h.app.cfg.Store(&cfg)
+
+	res := h.corsRequest(t, http.MethodGet, "/v1/healthcheck", nil)
+
+	if got := res.Header.Get("Access-Control-Expose-Headers"); got != "Retry-After, X-Request-Id" {
+		t.Errorf("got Access-Control-Expose-Headers %q", got)
+	}
+}
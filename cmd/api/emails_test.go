@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+)
+
+type testOutboxEmail struct {
+	ID        int64
+	Recipient string
+	Status    string
+	Attempts  int
+	LastError string `json:"last_error"`
+}
+
+func (h *testHarness) waitForEmailStatus(t *testing.T, token string, id int64, status string) testOutboxEmail {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		var res struct{ Emails []testOutboxEmail }
+		if code := h.do(t, http.MethodGet, "/v1/admin/emails", token, nil, &res); code != http.StatusOK {
+			t.Fatalf("list emails: got status %d", code)
+		}
+
+		for _, e := range res.Emails {
+			if e.ID == id && e.Status == status {
+				return e
+			}
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("email %d never reached status %q: %+v", id, status, res.Emails)
+		}
+
+		// let failed emails become due again under the fake clock, in steps
+		// well inside the outbox lease so in-flight deliveries aren't reclaimed
+		h.clock.Advance(15 * time.Second)
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// outboxEmailID returns the id of the email queued for recipient.
+func (h *testHarness) outboxEmailID(t *testing.T, token, recipient string) int64 {
+	t.Helper()
+
+	var res struct{ Emails []testOutboxEmail }
+	if code := h.do(t, http.MethodGet, "/v1/admin/emails", token, nil, &res); code != http.StatusOK {
+		t.Fatalf("list emails: got status %d", code)
+	}
+
+	for _, e := range res.Emails {
+		if e.Recipient == recipient {
+			return e.ID
+		}
+	}
+
+	t.Fatalf("no email queued for %s: %+v", recipient, res.Emails)
+	return 0
+}
+
+func TestOutboxDeadLetterAndRetry(t *testing.T) {
+	h := newTestHarness(t)
+	h.skipIfPostgres(t)
+
+	cfg := *h.app.config()
+	cfg.outbox.maxAttempts = 2
+	h.app.cfg.Store(&cfg)
+
+	admin := h.newUser(t, "admin@example.com", "emails:manage")
+
+	h.mailbox.failing.Store(true)
+	h.registerUser(t, "Bob", "bob@example.com", "pa55word")
+
+	var res struct{ Emails []testOutboxEmail }
+	h.do(t, http.MethodGet, "/v1/admin/emails?status=pending", admin, nil, &res)
+	if len(res.Emails) != 1 || res.Emails[0].Recipient != "bob@example.com" {
+		t.Fatalf("pending emails: got %+v", res.Emails)
+	}
+	id := res.Emails[0].ID
+
+	dead := h.waitForEmailStatus(t, admin, id, data.EmailDead)
+	if dead.Attempts != 2 || dead.LastError == "" {
+		t.Errorf("dead email: got %+v", dead)
+	}
+
+	h.mailbox.failing.Store(false)
+
+	if code := h.do(t, http.MethodPost, fmt.Sprintf("/v1/admin/emails/%d/retry", id), admin, nil, nil); code != http.StatusOK {
+		t.Fatalf("retry: got status %d", code)
+	}
+
+	h.waitForEmailStatus(t, admin, id, data.EmailSent)
+	h.activateUser(t, "bob@example.com")
+
+	if code := h.do(t, http.MethodPost, fmt.Sprintf("/v1/admin/emails/%d/retry", id), admin, nil, nil); code != http.StatusNotFound {
+		t.Errorf("retry sent email: got status %d", code)
+	}
+}
+
+func TestOutboxRequiresPermission(t *testing.T) {
+	h := newTestHarness(t)
+	reader := h.newUser(t, "reader@example.com")
+
+	if code := h.do(t, http.MethodGet, "/v1/admin/emails", reader, nil, nil); code != http.StatusForbidden {
+		t.Errorf("got status %d; want %d", code, http.StatusForbidden)
+	}
+}
+
+func TestOutboxDiscardsTokens(t *testing.T) {
+	h := newTestHarness(t)
+	h.skipIfPostgres(t)
+
+	cfg := *h.app.config()
+	cfg.outbox.maxAttempts = 1
+	cfg.outbox.deadRetention = time.Hour
+	h.app.cfg.Store(&cfg)
+
+	admin := h.newUser(t, "admin@example.com", "emails:manage")
+
+	h.registerUser(t, "Bob", "bob@example.com", "pa55word")
+	h.waitForEmailStatus(t, admin, h.outboxEmailID(t, admin, "bob@example.com"), data.EmailSent)
+
+	h.mailbox.failing.Store(true)
+	h.registerUser(t, "Carol", "carol@example.com", "pa55word")
+
+	id := h.outboxEmailID(t, admin, "carol@example.com")
+	h.waitForEmailStatus(t, admin, id, data.EmailDead)
+
+	sent, err := h.app.models.Emails.GetAllForRecipient("bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sent) != 1 || sent[0].Status != data.EmailSent || len(sent[0].Data) != 0 {
+		t.Errorf("sent email kept its data: %+v", sent)
+	}
+
+	// a dead email can be retried until it is deleted with its tokens
+	h.clock.Advance(cfg.outbox.deadRetention)
+	h.app.notifyOutbox()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		dead, err := h.app.models.Emails.GetAllForRecipient("carol@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(dead) == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("dead email never deleted: %+v", dead[0])
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if code := h.do(t, http.MethodPost, fmt.Sprintf("/v1/admin/emails/%d/retry", id), admin, nil, nil); code != http.StatusNotFound {
+		t.Errorf("retry deleted email: got status %d; want %d", code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+	"github.com/PriyanshuSharma23/greenlight/internal/validator"
+)
+
+// personalData is everything stored about a user, as written to an export.
+type personalData struct {
+	ExportedAt  time.Time        `json:"exported_at"`
+	User        *data.User       `json:"user"`
+	Permissions data.Permissions `json:"permissions"`
+	Sessions    []session        `json:"sessions"`
+	Emails      []*data.Email    `json:"emails"`
+	APIKeys     []*data.APIKey   `json:"api_keys"`
+	Identities  []*data.Identity `json:"identities"`
+}
+
+type exportPayload struct {
+	UserID int64  `json:"user_id"`
+	Format string `json:"format"`
+}
+
+// archive renders d as a single JSON document, or as a ZIP with one JSON file
+// per section.
+func (d personalData) archive(format string) ([]byte, error) {
+	if format == data.ExportJSON {
+		return json.MarshalIndent(d, "", "\t")
+	}
+
+	sections := []struct {
+		name  string
+		value any
+	}{
+		{"user.json", d.User},
+		{"permissions.json", d.Permissions},
+		{"sessions.json", d.Sessions},
+		{"emails.json", d.Emails},
+		{"api_keys.json", d.APIKeys},
+		{"identities.json", d.Identities},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for _, s := range sections {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: s.name, Method: zip.Deflate, Modified: d.ExportedAt})
+		if err != nil {
+			return nil, err
+		}
+
+		js, err := json.MarshalIndent(s.value, "", "\t")
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = f.Write(js)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := zw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// requestExportHandler schedules an export of the caller's data. The archive
+// is built in the background and a download token is emailed once it's ready.
+func (app *application) requestExportHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	qs := r.URL.Query()
+	format := app.readString(&qs, "format", data.ExportZIP)
+
+	v := validator.New()
+	if v.Check(validator.In(format, data.ExportZIP, data.ExportJSON), "format", "must be zip or json"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err := app.jobs.EnqueueDurable(app.models.Jobs, jobExportUserData, exportPayload{UserID: user.ID, Format: format})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"message": "your data export is being prepared, a download link will be emailed to you"}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// downloadExportHandler serves the archive belonging to the export token in
+// the query string. It is unauthenticated so that the link in the email works
+// on its own.
+func (app *application) downloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	tokenPlaintext := r.URL.Query().Get("token")
+
+	v := validator.New()
+	if data.ValidatePlaintextToken(v, tokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(tokenPlaintext, data.ScopeExport)
+	if err == nil {
+		var export *data.Export
+
+		export, err = app.models.Exports.GetForUser(user.ID)
+		if err == nil {
+			contentType := "application/zip"
+			if export.Format == data.ExportJSON {
+				contentType = "application/json"
+			}
+
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="greenlight-export-%d.%s"`, user.ID, export.Format))
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusOK)
+			w.Write(export.Content)
+			return
+		}
+	}
+
+	switch {
+	case errors.Is(err, data.ErrNoRecordFound):
+		v.AddError("token", "invalid or expired token")
+		app.failedValidationResponse(w, r, v.Errors)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// exportUserDataJob builds a user's export, replacing any earlier one, and
+// emails them a token to download it until it expires.
+func (app *application) exportUserDataJob(ctx context.Context, payload json.RawMessage) error {
+	var p exportPayload
+
+	err := json.Unmarshal(payload, &p)
+	if err != nil {
+		return err
+	}
+
+	err = app.models.Exports.DeleteExpired()
+	if err != nil {
+		return err
+	}
+
+	user, err := app.models.Users.Get(p.UserID)
+	if err != nil {
+		// the account was deleted before the export ran
+		if errors.Is(err, data.ErrNoRecordFound) {
+			return nil
+		}
+		return err
+	}
+
+	pd := personalData{ExportedAt: time.Now().UTC(), User: user}
+
+	pd.Permissions, err = app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	if pd.Permissions == nil {
+		pd.Permissions = data.Permissions{}
+	}
+
+	pd.Sessions, err = app.sessions(user.ID)
+	if err != nil {
+		return err
+	}
+
+	pd.Emails, err = app.models.Emails.GetAllForRecipient(user.Email)
+	if err != nil {
+		return err
+	}
+
+	pd.APIKeys, err = app.models.APIKeys.GetAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	pd.Identities, err = app.models.Identities.GetAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	content, err := pd.archive(p.Format)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ttl := app.config().exports.ttl
+
+	err = app.models.Transaction(func(tx data.Models) error {
+		err := tx.Exports.DeleteAllForUser(user.ID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Tokens.DeleteAllForUser(user.ID, data.ScopeExport)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Exports.Insert(&data.Export{UserID: user.ID, Format: p.Format, Content: content}, ttl)
+		if err != nil {
+			return err
+		}
+
+		token, err := tx.Tokens.New(user.ID, ttl, data.ScopeExport)
+		if err != nil {
+			return err
+		}
+
+		return app.enqueueEmail(tx, user.Email, user.Locale, "data_export_ready.tmpl", map[string]any{
+			"token": token.Plaintext,
+			"hours": int(ttl.Hours()),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	app.notifyOutbox()
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var exportTokenRx = regexp.MustCompile(`token=([A-Z2-7]{26})`)
+
+// exportToken requests an export in format and returns the download token
+// from the email that follows.
+func (h *testHarness) exportToken(t *testing.T, token, format string) string {
+	t.Helper()
+
+	if code := h.do(t, http.MethodPost, "/v1/users/me/export?format="+format, token, nil, nil); code != http.StatusAccepted {
+		t.Fatalf("request export: got status %d; want %d", code, http.StatusAccepted)
+	}
+
+	msg := h.mailbox.waitForSubject(t, "alice@example.com", "Your Greenlight data export is ready")
+
+	match := exportTokenRx.FindStringSubmatch(msg.PlainBody)
+	if match == nil {
+		t.Fatalf("no export token in email:\n%s", msg.PlainBody)
+	}
+
+	return match[1]
+}
+
+func (h *testHarness) download(t *testing.T, exportToken string) (int, http.Header, []byte) {
+	t.Helper()
+
+	res, err := h.server.Client().Get(h.server.URL + "/v1/users/export?token=" + exportToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res.StatusCode, res.Header, body
+}
+
+func TestExportZIP(t *testing.T) {
+	h := newTestHarness(t)
+
+	token := h.newUser(t, "alice@example.com")
+
+	code, header, body := h.download(t, h.exportToken(t, token, "zip"))
+	if code != http.StatusOK {
+		t.Fatalf("download: got status %d; want %d", code, http.StatusOK)
+	}
+
+	if ct := header.Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("got content type %q", ct)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+
+	var user struct{ Email string }
+	if err := json.Unmarshal(files["user.json"], &user); err != nil || user.Email != "alice@example.com" {
+		t.Errorf("user.json: got %s (%v)", files["user.json"], err)
+	}
+
+	var sessions []struct{ Expiry time.Time }
+	if err := json.Unmarshal(files["sessions.json"], &sessions); err != nil || len(sessions) != 1 {
+		t.Errorf("sessions.json: got %s (%v)", files["sessions.json"], err)
+	}
+
+	var emails []struct{ Template string }
+	if err := json.Unmarshal(files["emails.json"], &emails); err != nil || len(emails) == 0 || emails[0].Template != "user_welcome.tmpl" {
+		t.Errorf("emails.json: got %s (%v)", files["emails.json"], err)
+	}
+
+	if bytes.Contains(body, []byte("password")) {
+		t.Error("export contains password data")
+	}
+}
+
+func TestExportJSONExpires(t *testing.T) {
+	h := newTestHarness(t)
+
+	token := h.newUser(t, "alice@example.com", "movies:write")
+	exportToken := h.exportToken(t, token, "json")
+
+	code, _, body := h.download(t, exportToken)
+	if code != http.StatusOK {
+		t.Fatalf("download: got status %d; want %d", code, http.StatusOK)
+	}
+
+	var export struct {
+		User        struct{ Email string }
+		Permissions []string
+	}
+	if err := json.Unmarshal(body, &export); err != nil {
+		t.Fatal(err)
+	}
+
+	if export.User.Email != "alice@example.com" || len(export.Permissions) != 2 {
+		t.Errorf("got export %+v", export)
+	}
+
+	h.clock.Advance(h.app.config().exports.ttl + time.Minute)
+
+	if code, _, _ := h.download(t, exportToken); code != http.StatusUnprocessableEntity {
+		t.Errorf("expired download: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestExportValidation(t *testing.T) {
+	h := newTestHarness(t)
+
+	token := h.newUser(t, "alice@example.com")
+
+	if code := h.do(t, http.MethodPost, "/v1/users/me/export?format=tar", token, nil, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("bad format: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	if code := h.do(t, http.MethodPost, "/v1/users/me/export", "", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("anonymous: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+
+	if code, _, _ := h.download(t, "ABCDEFGHIJKLMNOPQRSTUVWXYZ"); code != http.StatusUnprocessableEntity {
+		t.Errorf("unknown token: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+}
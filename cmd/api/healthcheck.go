@@ -1,14 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
 )
 
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
 	env := envelope{
 		"status": "available",
 		"system_info": map[string]any{
-			"environment": app.config.env,
+			"environment": app.config().env,
 			"version":     version,
 		},
 	}
@@ -18,3 +28,126 @@ func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Reques
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+type healthCheck struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+// readiness holds the most recent set of dependency checks so that frequent
+// probes don't each hit the database and SMTP relay.
+type readiness struct {
+	checkedAt time.Time
+	checks    map[string]healthCheck
+	mu        sync.Mutex
+	ready     bool
+	draining  atomic.Bool
+}
+
+func (app *application) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"status": "alive"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	checks, ready := app.readinessChecks()
+
+	status, code := "ready", http.StatusOK
+
+	switch {
+	case app.health.draining.Load():
+		status, code = "draining", http.StatusServiceUnavailable
+	case !ready:
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+
+	err := app.writeJSON(w, code, envelope{"status": status, "checks": checks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) readinessChecks() (map[string]healthCheck, bool) {
+	app.health.mu.Lock()
+	defer app.health.mu.Unlock()
+
+	if app.health.checks != nil && time.Since(app.health.checkedAt) < app.config().health.cacheTTL {
+		return app.health.checks, app.health.ready
+	}
+
+	checks := map[string]healthCheck{
+		"database":   app.runCheck(app.models.Health.Ping),
+		"migrations": app.runCheck(app.checkMigrations),
+	}
+
+	if app.config().health.checkSMTP && app.config().mail.transport == "smtp" {
+		checks["smtp"] = app.runCheck(app.checkSMTP)
+	}
+
+	ready := true
+	for _, check := range checks {
+		if check.Status != "up" {
+			ready = false
+		}
+	}
+
+	app.health.checks = checks
+	app.health.ready = ready
+	app.health.checkedAt = time.Now()
+
+	return checks, ready
+}
+
+func (app *application) runCheck(fn func(ctx context.Context) error) healthCheck {
+	ctx, cancel := context.WithTimeout(context.Background(), app.config().health.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := fn(ctx)
+
+	check := healthCheck{
+		Status:  "up",
+		Latency: time.Since(start).String(),
+	}
+
+	if err != nil {
+		check.Status = "down"
+		check.Error = err.Error()
+	}
+
+	return check
+}
+
+func (app *application) checkMigrations(ctx context.Context) error {
+	version, dirty, err := app.models.Health.MigrationVersion(ctx)
+	if err != nil {
+		if errors.Is(err, data.ErrNoRecordFound) {
+			return errors.New("no migrations have been applied")
+		}
+		return err
+	}
+
+	if dirty {
+		return fmt.Errorf("migration %d is dirty", version)
+	}
+
+	if version < int64(app.config().health.migrationVersion) {
+		return fmt.Errorf("schema version %d is behind expected version %d", version, app.config().health.migrationVersion)
+	}
+
+	return nil
+}
+
+func (app *application) checkSMTP(ctx context.Context) error {
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(app.config().smtp.host, strconv.Itoa(app.config().smtp.port)))
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
@@ -1 +1,33 @@
 package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHealthProbes(t *testing.T) {
+	h := newTestHarness(t)
+
+	var live struct{ Status string }
+	if code := h.do(t, http.MethodGet, "/v1/health/live", "", nil, &live); code != http.StatusOK || live.Status != "alive" {
+		t.Fatalf("live: got %d %q", code, live.Status)
+	}
+
+	var ready struct {
+		Status string
+		Checks map[string]healthCheck
+	}
+	if code := h.do(t, http.MethodGet, "/v1/health/ready", "", nil, &ready); code != http.StatusOK {
+		t.Fatalf("ready: got %d %+v", code, ready)
+	}
+
+	if ready.Checks["database"].Status != "up" || ready.Checks["migrations"].Status != "up" {
+		t.Errorf("ready: unexpected checks %+v", ready.Checks)
+	}
+
+	h.app.health.draining.Store(true)
+
+	if code := h.do(t, http.MethodGet, "/v1/health/ready", "", nil, &ready); code != http.StatusServiceUnavailable || ready.Status != "draining" {
+		t.Errorf("draining: got %d %q", code, ready.Status)
+	}
+}
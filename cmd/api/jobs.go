@@ -0,0 +1,9 @@
+package main
+
+const jobExportUserData = "users:export"
+
+// registerJobs adds the job types the server runs. It must be called before
+// the runner is started.
+func (app *application) registerJobs() {
+	app.jobs.Register(jobExportUserData, 0, app.exportUserDataJob)
+}
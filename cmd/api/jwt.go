@@ -0,0 +1,324 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+	"github.com/PriyanshuSharma23/greenlight/internal/jwt"
+	"github.com/tomasen/realip"
+)
+
+// sessionTouchInterval is how often repeated use of a JWT from the same address
+// is written back to its session, as with authentication tokens.
+const sessionTouchInterval = time.Minute
+
+// authClaims are carried by the JWTs issued in the jwt auth mode: enough to
+// authenticate a request and check its permissions without the database.
+// They can be up to -jwt-ttl out of date.
+type authClaims struct {
+	jwt.RegisteredClaims
+	Activated   bool             `json:"activated"`
+	Permissions data.Permissions `json:"permissions"`
+	// Session is the family of the session the JWT was issued in.
+	Session string `json:"sid,omitempty"`
+}
+
+func (c *authClaims) userID() int64 {
+	id, _ := strconv.ParseInt(c.Subject, 10, 64)
+	return id
+}
+
+// newJWTKeySet parses -jwt-keys. Changing the keys needs a restart.
+func newJWTKeySet(cfg config) (*jwt.KeySet, error) {
+	if len(cfg.jwt.keys) == 0 {
+		return nil, errors.New("must be provided")
+	}
+
+	keys := make([]*jwt.Key, len(cfg.jwt.keys))
+
+	for i, spec := range cfg.jwt.keys {
+		key, err := jwt.ParseKey(spec)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+
+	return jwt.NewKeySet(cfg.jwt.signingKey, keys...)
+}
+
+// newJWT signs a JWT for the user with their current permissions, returned as
+// a Token so that clients see the same shape in either auth mode.
+func (app *application) newJWT(models data.Models, user *data.User, family []byte) (*data.Token, error) {
+	permissions, err := models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+
+	id := make([]byte, 16)
+
+	_, err = rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := app.config().jwt
+	now := time.Now()
+
+	claims := authClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   cfg.issuer,
+			Subject:  strconv.FormatInt(user.ID, 10),
+			ID:       base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(id),
+			IssuedAt: jwt.NumericDate{Time: now},
+			Expiry:   jwt.NumericDate{Time: now.Add(cfg.ttl)},
+		},
+		Activated:   user.Activated,
+		Permissions: permissions,
+		Session:     base64.RawURLEncoding.EncodeToString(family),
+	}
+
+	signed, err := app.jwtKeys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Token{
+		Plaintext: signed,
+		Expiry:    claims.Expiry.Time,
+		Scope:     data.ScopeAuthentication,
+		UserID:    user.ID,
+	}, nil
+}
+
+// authenticateJWT verifies a JWT and returns its claims along with a user
+// built from them. The user only has its ID and activation status set. Its
+// session is recorded as used by the client making r.
+func (app *application) authenticateJWT(r *http.Request, token string) (*data.User, *authClaims, error) {
+	var claims authClaims
+
+	err := app.jwtKeys.Verify(token, app.config().jwt.issuer, time.Now(), &claims)
+	if err != nil {
+		return nil, nil, data.ErrNoRecordFound
+	}
+
+	revoked, err := app.revocations.revoked(app, &claims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if revoked || claims.userID() < 1 {
+		return nil, nil, data.ErrNoRecordFound
+	}
+
+	err = app.touchSession(r, &claims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &data.User{ID: claims.userID(), Activated: claims.Activated}, &claims, nil
+}
+
+// revokeJWT revokes a single JWT until it expires.
+func (app *application) revokeJWT(claims *authClaims) error {
+	return app.revocations.add(app, &data.Revocation{
+		UserID:    claims.userID(),
+		TokenID:   claims.ID,
+		RevokedAt: time.Now(),
+		Expiry:    claims.Expiry.Time,
+	})
+}
+
+// revokeUserJWTs revokes every JWT issued to the user so far. It does nothing
+// in the token auth mode, where deleting the user's tokens is enough.
+func (app *application) revokeUserJWTs(models data.Models, userID int64) error {
+	if app.jwtKeys == nil {
+		return nil
+	}
+
+	now := time.Now()
+
+	r := &data.Revocation{UserID: userID, RevokedAt: now, Expiry: now.Add(app.config().jwt.ttl)}
+
+	err := models.Revocations.Insert(r)
+	if err != nil {
+		return err
+	}
+
+	app.revocations.remember(r)
+
+	return nil
+}
+
+// revokeSessionJWTs revokes every JWT issued in the session with the given
+// refresh token family. Like revokeUserJWTs it does nothing in the token auth
+// mode.
+func (app *application) revokeSessionJWTs(models data.Models, userID int64, family []byte) error {
+	if app.jwtKeys == nil || len(family) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	r := &data.Revocation{
+		UserID:    userID,
+		Session:   base64.RawURLEncoding.EncodeToString(family),
+		RevokedAt: now,
+		Expiry:    now.Add(app.config().jwt.ttl),
+	}
+
+	err := models.Revocations.Insert(r)
+	if err != nil {
+		return err
+	}
+
+	app.revocations.remember(r)
+
+	return nil
+}
+
+// touchSession writes the use of a JWT to its session. Requests are only
+// checked against the database once per sessionTouchInterval, unless they
+// come from a new address, so that the jwt auth mode mostly keeps away from
+// it.
+func (app *application) touchSession(r *http.Request, claims *authClaims) error {
+	family, err := base64.RawURLEncoding.DecodeString(claims.Session)
+	if err != nil || len(family) == 0 {
+		return nil
+	}
+
+	ip := realip.FromRequest(r)
+
+	if !app.sessionTouches.due(claims.Session, ip) {
+		return nil
+	}
+
+	return app.models.Tokens.TouchFamily(family, ip, userAgent(r))
+}
+
+// sessionTouches remembers when and from where each session was last touched
+// through a JWT.
+type sessionTouches struct {
+	seen map[string]sessionTouch
+	mu   sync.Mutex
+}
+
+type sessionTouch struct {
+	ip string
+	at time.Time
+}
+
+func (t *sessionTouches) due(session, ip string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+
+	if last, ok := t.seen[session]; ok && last.ip == ip && now.Sub(last.at) < sessionTouchInterval {
+		return false
+	}
+
+	if t.seen == nil {
+		t.seen = make(map[string]sessionTouch)
+	}
+
+	for s, last := range t.seen {
+		if now.Sub(last.at) >= sessionTouchInterval {
+			delete(t.seen, s)
+		}
+	}
+
+	t.seen[session] = sessionTouch{ip: ip, at: now}
+
+	return true
+}
+
+// revocationList caches the jwt_revocations table, so that checking a JWT
+// doesn't need the database. It is reloaded once it is older than
+// -jwt-revocation-sync, which bounds how long a revocation made by another
+// instance takes to apply here.
+type revocationList struct {
+	tokens   map[string]bool
+	sessions map[string]bool
+	users    map[int64]time.Time
+	loadedAt time.Time
+	mu       sync.Mutex
+}
+
+func (l *revocationList) revoked(app *application, claims *authClaims) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if time.Since(l.loadedAt) > app.config().jwt.revocationSync {
+		revocations, err := app.models.Revocations.GetAll()
+		if err != nil {
+			return false, err
+		}
+
+		l.tokens, l.sessions, l.users = make(map[string]bool), make(map[string]bool), make(map[int64]time.Time)
+		for _, r := range revocations {
+			l.rememberLocked(r)
+		}
+
+		l.loadedAt = time.Now()
+	}
+
+	if l.tokens[claims.ID] || (claims.Session != "" && l.sessions[claims.Session]) {
+		return true, nil
+	}
+
+	before, ok := l.users[claims.userID()]
+
+	return ok && claims.IssuedAt.Before(before), nil
+}
+
+func (l *revocationList) add(app *application, r *data.Revocation) error {
+	err := app.models.Revocations.Insert(r)
+	if err != nil {
+		return err
+	}
+
+	l.remember(r)
+
+	return nil
+}
+
+func (l *revocationList) remember(r *data.Revocation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.tokens == nil {
+		return
+	}
+
+	l.rememberLocked(r)
+}
+
+func (l *revocationList) rememberLocked(r *data.Revocation) {
+	if r.TokenID != "" {
+		l.tokens[r.TokenID] = true
+		return
+	}
+
+	if r.Session != "" {
+		l.sessions[r.Session] = true
+		return
+	}
+
+	// the database stores microseconds, so compare at the precision of iat
+	revokedAt := r.RevokedAt.Truncate(time.Millisecond)
+	if revokedAt.After(l.users[r.UserID]) {
+		l.users[r.UserID] = revokedAt
+	}
+}
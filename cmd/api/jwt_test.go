@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+)
+
+// useJWT switches the harness to the jwt auth mode.
+func (h *testHarness) useJWT(t *testing.T) {
+	t.Helper()
+
+	cfg := *h.app.config()
+	cfg.auth.mode = "jwt"
+	cfg.jwt.keys = []string{"k1:HS256:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("s", 32)))}
+
+	keys, err := newJWTKeySet(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.app.cfg.Store(&cfg)
+	h.app.jwtKeys = keys
+}
+
+func TestJWTAuthentication(t *testing.T) {
+	h := newTestHarness(t)
+	h.useJWT(t)
+
+	h.newUser(t, "alice@example.com")
+	access, refresh := h.newSession(t, "alice@example.com", "pa55word")
+
+	if strings.Count(access, ".") != 2 || refresh == "" {
+		t.Fatalf("got access token %q and refresh token %q", access, refresh)
+	}
+
+	// the JWT is checked without the database, so deleting every stored
+	// token doesn't affect it
+	user, err := h.app.models.Users.GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = h.app.models.Tokens.DeleteAllForUser(user.ID, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/movies", access, nil, nil); code != http.StatusOK {
+		t.Errorf("list movies: got status %d; want %d", code, http.StatusOK)
+	}
+
+	// permissions come from the claims until the token is refreshed
+	if code := h.do(t, http.MethodPost, "/v1/movies", access, map[string]any{}, nil); code != http.StatusForbidden {
+		t.Errorf("create movie: got status %d; want %d", code, http.StatusForbidden)
+	}
+
+	err = h.app.models.Permissions.AddForUser(user.ID, "movies:write")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var res struct {
+		AuthenticationToken struct{ Token string } `json:"authentication_token"`
+	}
+
+	if code := h.do(t, http.MethodPost, "/v1/tokens/refresh", "", map[string]string{"refresh_token": refresh}, &res); code != http.StatusCreated {
+		t.Fatalf("refresh: got status %d; want %d", code, http.StatusCreated)
+	}
+
+	if code := h.do(t, http.MethodPost, "/v1/movies", res.AuthenticationToken.Token, map[string]any{}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("create movie after refresh: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	var me struct {
+		User data.User `json:"user"`
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/users/me", access, nil, &me); code != http.StatusOK || me.User.Email != "alice@example.com" {
+		t.Errorf("show current user: got status %d and email %q", code, me.User.Email)
+	}
+
+	if code := h.do(t, http.MethodPost, "/v1/tokens/refresh", "", map[string]string{"refresh_token": "ABCDEFGHIJKLMNOPQRSTUVWXYZ"}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("unknown refresh token: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestJWTLogout(t *testing.T) {
+	h := newTestHarness(t)
+	h.useJWT(t)
+
+	h.newUser(t, "alice@example.com")
+	access, refresh := h.newSession(t, "alice@example.com", "pa55word")
+	other, _ := h.newSession(t, "alice@example.com", "pa55word")
+
+	if code := h.do(t, http.MethodDelete, "/v1/tokens/authentication", access, map[string]string{"refresh_token": refresh}, nil); code != http.StatusOK {
+		t.Fatalf("logout: got status %d; want %d", code, http.StatusOK)
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/movies", access, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("revoked token: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+
+	if code := h.do(t, http.MethodPost, "/v1/tokens/refresh", "", map[string]string{"refresh_token": refresh}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("deleted refresh token: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/movies", other, nil, nil); code != http.StatusOK {
+		t.Errorf("other session: got status %d; want %d", code, http.StatusOK)
+	}
+
+	// other instances pick up the revocation when they next reload the list
+	h.app.revocations = revocationList{}
+
+	if code := h.do(t, http.MethodGet, "/v1/movies", access, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("revoked token after reload: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestJWTPasswordChange(t *testing.T) {
+	h := newTestHarness(t)
+	h.useJWT(t)
+
+	h.newUser(t, "alice@example.com")
+	access, refresh := h.newSession(t, "alice@example.com", "pa55word")
+
+	// iat has millisecond precision, so make sure the change comes later
+	time.Sleep(2 * time.Millisecond)
+
+	var res struct {
+		AuthenticationToken struct{ Token string } `json:"authentication_token"`
+		RefreshToken        struct{ Token string } `json:"refresh_token"`
+	}
+
+	body := map[string]string{"current_password": "pa55word", "password": "n3wpa55word"}
+	if code := h.do(t, http.MethodPut, "/v1/users/me/password", access, body, &res); code != http.StatusOK {
+		t.Fatalf("change password: got status %d; want %d", code, http.StatusOK)
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/movies", access, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("old token: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+
+	if code := h.do(t, http.MethodPost, "/v1/tokens/refresh", "", map[string]string{"refresh_token": refresh}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("old refresh token: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/movies", res.AuthenticationToken.Token, nil, nil); code != http.StatusOK {
+		t.Errorf("new token: got status %d; want %d", code, http.StatusOK)
+	}
+}
+
+func TestJWTSessionLastUsed(t *testing.T) {
+	h := newTestHarness(t)
+	h.useJWT(t)
+
+	h.newUser(t, "alice@example.com")
+	access, _ := h.newSession(t, "alice@example.com", "pa55word")
+
+	req, err := http.NewRequest(http.MethodGet, h.server.URL+"/v1/users/me", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+access)
+	req.Header.Set("X-Real-Ip", "203.0.113.7")
+
+	res, err := h.server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("show current user: got status %d", res.StatusCode)
+	}
+
+	user, err := h.app.models.Users.GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := h.app.models.Tokens.GetAllForUser(user.ID, data.ScopeRefresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the session the JWT belongs to was used from the new address
+	used := 0
+	for _, s := range sessions {
+		if s.IP == "203.0.113.7" {
+			used++
+		}
+	}
+
+	if used != 1 {
+		t.Errorf("got %d sessions used from the new address; want 1", used)
+	}
+}
+
+func TestJWTDeleteSession(t *testing.T) {
+	h := newTestHarness(t)
+	h.useJWT(t)
+
+	h.newUser(t, "alice@example.com")
+	access, _ := h.newSession(t, "alice@example.com", "pa55word")
+	other, _ := h.newSession(t, "alice@example.com", "pa55word")
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.Split(access, ".")[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims struct {
+		Session string `json:"sid"`
+	}
+
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := h.app.models.Users.GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := h.app.models.Tokens.GetAllForUser(user.ID, data.ScopeRefresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var id int64
+	for _, s := range sessions {
+		if base64.RawURLEncoding.EncodeToString(s.Family) == claims.Session {
+			id = s.ID
+		}
+	}
+
+	if id == 0 {
+		t.Fatalf("no session for sid %q", claims.Session)
+	}
+
+	if code := h.do(t, http.MethodDelete, fmt.Sprintf("/v1/users/me/sessions/%d", id), other, nil, nil); code != http.StatusOK {
+		t.Fatalf("delete session: got status %d; want %d", code, http.StatusOK)
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/movies", access, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("revoked session: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/movies", other, nil, nil); code != http.StatusOK {
+		t.Errorf("other session: got status %d; want %d", code, http.StatusOK)
+	}
+
+	// other instances pick up the revocation when they next reload the list
+	h.app.revocations = revocationList{}
+
+	if code := h.do(t, http.MethodGet, "/v1/movies", access, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("revoked session after reload: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// login posts credentials and returns the status and raw response body.
+func (h *testHarness) login(t *testing.T, email, password string) (int, string) {
+	t.Helper()
+
+	body := fmt.Sprintf(`{"email": %q, "password": %q}`, email, password)
+
+	res, err := h.server.Client().Post(h.server.URL+"/v1/tokens/authentication", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res.StatusCode, string(b)
+}
+
+func TestLoginLockout(t *testing.T) {
+	h := newTestHarness(t)
+
+	h.newUser(t, "alice@example.com")
+	maxFailures := h.app.config().login.maxFailures
+
+	for i := 0; i < maxFailures; i++ {
+		known, knownBody := h.login(t, "alice@example.com", "wrong-password")
+		unknown, unknownBody := h.login(t, "nobody@example.com", "wrong-password")
+
+		if known != http.StatusUnauthorized || known != unknown || knownBody != unknownBody {
+			t.Fatalf("attempt %d: known email got %d %s, unknown got %d %s", i+1, known, knownBody, unknown, unknownBody)
+		}
+	}
+
+	// both emails are now locked, even with the right password
+	known, knownBody := h.login(t, "alice@example.com", "pa55word")
+	unknown, unknownBody := h.login(t, "nobody@example.com", "pa55word")
+
+	if known != http.StatusTooManyRequests || known != unknown || knownBody != unknownBody {
+		t.Fatalf("locked: known email got %d %s, unknown got %d %s", known, knownBody, unknown, unknownBody)
+	}
+
+	msg := h.mailbox.waitForSubject(t, "alice@example.com", "Sign-in to your Greenlight account has been locked")
+	if !strings.Contains(msg.PlainBody, "127.0.0.1") {
+		t.Errorf("lockout email does not mention the IP address:\n%s", msg.PlainBody)
+	}
+
+	h.clock.Advance(h.app.config().login.lockout + time.Second)
+
+	h.authenticate(t, "alice@example.com", "pa55word")
+}
+
+func TestLoginSuccessResetsFailures(t *testing.T) {
+	h := newTestHarness(t)
+
+	h.newUser(t, "alice@example.com")
+	maxFailures := h.app.config().login.maxFailures
+
+	for round := 0; round < 2; round++ {
+		for i := 0; i < maxFailures-1; i++ {
+			if code, _ := h.login(t, "alice@example.com", "wrong-password"); code != http.StatusUnauthorized {
+				t.Fatalf("got status %d; want %d", code, http.StatusUnauthorized)
+			}
+		}
+
+		h.authenticate(t, "alice@example.com", "pa55word")
+	}
+}
+
+func TestLoginIPLockout(t *testing.T) {
+	h := newTestHarness(t)
+
+	cfg := *h.app.config()
+	cfg.login.maxIPFailures = 3
+	h.app.cfg.Store(&cfg)
+
+	h.newUser(t, "alice@example.com")
+
+	for i := 0; i < 3; i++ {
+		h.login(t, fmt.Sprintf("guess%d@example.com", i), "wrong-password")
+	}
+
+	if code, _ := h.login(t, "alice@example.com", "pa55word"); code != http.StatusTooManyRequests {
+		t.Errorf("got status %d; want %d", code, http.StatusTooManyRequests)
+	}
+}
+
+func TestLoginDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 250 * time.Millisecond},
+		{2, 500 * time.Millisecond},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{40, 4 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := loginDelay(tt.failures, 250*time.Millisecond, 4*time.Second); got != tt.want {
+			t.Errorf("loginDelay(%d) = %s; want %s", tt.failures, got, tt.want)
+		}
+	}
+}
@@ -4,17 +4,19 @@ import (
 	"context"
 	"database/sql"
 	"expvar"
-	"flag"
 	"fmt"
 	"os"
 	"runtime"
-	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/PriyanshuSharma23/greenlight/internal/data"
+	"github.com/PriyanshuSharma23/greenlight/internal/jobs"
 	"github.com/PriyanshuSharma23/greenlight/internal/jsonlogger"
+	"github.com/PriyanshuSharma23/greenlight/internal/jwt"
 	"github.com/PriyanshuSharma23/greenlight/internal/mailer"
+	"github.com/PriyanshuSharma23/greenlight/internal/oidc"
+	"github.com/PriyanshuSharma23/greenlight/internal/validator"
 	_ "github.com/lib/pq"
 )
 
@@ -23,78 +25,56 @@ var (
 	version   string
 )
 
-type config struct {
-	env  string
-	cors struct{ trustedOrigins []string }
-	smtp struct {
-		host     string
-		username string
-		password string
-		sender   string
-		port     int
-		retries  int
-	}
-	db struct {
-		dsn          string
-		maxIdleTime  string
-		maxIdleConns int
-		maxOpenConns int
-	}
-	limter struct {
-		rps     float64
-		burst   int
-		enabled bool
-	}
-	port int
-}
-
 type application struct {
-	models data.Models
-	logger *jsonlogger.Logger
-	mailer mailer.Mailer
-	config config
-	wg     sync.WaitGroup
+	models   data.Models
+	logger   *jsonlogger.Logger
+	mailer   atomic.Pointer[mailer.Mailer]
+	cfg      atomic.Pointer[config]
+	settings map[string]string
+	health   readiness
+	cors     corsCache
+	outbox   outbox
+	jobs     *jobs.Runner
+
+	// jwtKeys is only set in the jwt auth mode
+	jwtKeys        *jwt.KeySet
+	revocations    revocationList
+	sessionTouches sessionTouches
+
+	// oidc holds the configured identity providers by name
+	oidc map[string]*oidc.Provider
 }
 
 func main() {
-	var cfg config
-
-	flag.StringVar(&cfg.env, "env", "development", `set environment of application. options: "production", "development"`)
-	flag.IntVar(&cfg.port, "port", 4000, "default port of server")
-
-	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgresSQL DSN")
-
-	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgresSQL max idle connecitons")
-	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgresSQL max open connecitons")
-	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgresSQL max connection idle time")
-
-	flag.Float64Var(&cfg.limter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second.")
-	flag.IntVar(&cfg.limter.burst, "limiter-burst", 4, "Rate limiter maximum burst.")
-	flag.BoolVar(&cfg.limter.enabled, "limiter-enabled", true, "Enable rate limiter")
-
-	flag.StringVar(&cfg.smtp.host, "smtp-host", "sandbox.smtp.mailtrap.io", "SMTP host")
-	flag.IntVar(&cfg.smtp.port, "smtp-port", 2525, "SMTP port")
-	flag.StringVar(&cfg.smtp.username, "smtp-username", "7beb0df3023aa3", "SMTP username")
-	flag.StringVar(&cfg.smtp.password, "smtp-password", "1e59f8334837b1", "SMTP password")
-	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Greenlight <inbox.priyanshu@gmail.com>", "SMTP sender")
-	flag.IntVar(&cfg.smtp.retries, "smtp-retires", 3, "SMTP number of retries for failed email delivery")
-
-	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(s string) error {
-		cfg.cors.trustedOrigins = strings.Fields(s)
-		return nil
-	})
-
-	displayVersion := flag.Bool("version", false, "Display current version of the application")
-
-	flag.Parse()
+	cfg, fs, err := loadConfig(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	if *displayVersion {
+	if cfg.displayVersion {
 		fmt.Printf("Version:   \t%s\n", version)
 		fmt.Printf("Build Time:\t%s\n", buildTime)
 		os.Exit(0)
 	}
 
-	logger := jsonlogger.NewLogger(os.Stdout, jsonlogger.LevelInfo)
+	if cfg.printConfig {
+		err = writeConfig(os.Stdout, fs)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	v := validator.New()
+	if validateConfig(v, cfg); !v.Valid() {
+		fmt.Fprintln(os.Stderr, configError(v))
+		os.Exit(2)
+	}
+
+	level, _ := jsonlogger.ParseLevel(cfg.logLevel)
+	logger := jsonlogger.NewLogger(os.Stdout, level)
 
 	db, err := openDB(cfg)
 	if err != nil {
@@ -104,14 +84,33 @@ func main() {
 
 	logger.PrintInfo("database connection pool established", nil)
 
-	m, err := mailer.New(
-		cfg.smtp.host,
-		cfg.smtp.port,
-		cfg.smtp.username,
-		cfg.smtp.password,
-		cfg.smtp.sender,
-		cfg.smtp.retries,
-	)
+	if args := fs.Args(); len(args) > 0 {
+		if args[0] != "migrate" {
+			logger.PrintFatal(fmt.Errorf("unknown command %q", args[0]), nil)
+		}
+
+		err = runMigrate(db, logger, args[1:])
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		return
+	}
+
+	if cfg.migrate.onStart {
+		m, err := newMigrator(db, logger)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		err = m.Up(context.Background())
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		logger.PrintInfo("database migrations applied", nil)
+	}
+
+	m, err := newMailer(cfg, logger)
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
@@ -130,12 +129,28 @@ func main() {
 		return time.Now().Unix()
 	}))
 
+	models := data.NewModels(db)
+
 	app := &application{
-		logger: logger,
-		config: cfg,
-		models: data.NewModels(db),
-		mailer: m,
-		wg:     sync.WaitGroup{},
+		logger:   logger,
+		models:   models,
+		settings: configSettings(fs),
+		jobs:     newJobRunner(cfg, models.Jobs, logger),
+	}
+	app.cfg.Store(&cfg)
+	app.mailer.Store(&m)
+	app.registerJobs()
+
+	if cfg.auth.mode == "jwt" {
+		app.jwtKeys, err = newJWTKeySet(cfg)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+
+	app.oidc, err = newOIDCProviders(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
 	}
 
 	err = app.serve()
@@ -144,6 +159,45 @@ func main() {
 	}
 }
 
+// newJobRunner builds the background job runner. Job types are registered on
+// it before serve starts the workers.
+func newJobRunner(cfg config, store data.JobRepository, logger *jsonlogger.Logger) *jobs.Runner {
+	return jobs.New(jobs.Config{
+		Workers:      cfg.jobs.workers,
+		QueueSize:    cfg.jobs.queueSize,
+		MaxAttempts:  cfg.jobs.maxAttempts,
+		Timeout:      cfg.jobs.timeout,
+		PollInterval: cfg.jobs.pollInterval,
+		BackoffBase:  cfg.jobs.backoffBase,
+		BackoffMax:   cfg.jobs.backoffMax,
+	}, store, logger)
+}
+
+// newMailer builds a mailer for the configured transport. Only "smtp" sends
+// real email; the others keep it on the machine for development and tests.
+func newMailer(cfg config, logger *jsonlogger.Logger) (mailer.Mailer, error) {
+	var sender mailer.Sender
+
+	switch cfg.mail.transport {
+	case "smtp":
+		sender = mailer.NewSMTPSender(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password)
+	case "file":
+		fs, err := mailer.NewFileSender(cfg.mail.dir)
+		if err != nil {
+			return mailer.Mailer{}, err
+		}
+		sender = fs
+	case "log":
+		sender = mailer.NewLogSender(logger)
+	case "memory":
+		sender = mailer.NewMemorySender()
+	default:
+		return mailer.Mailer{}, fmt.Errorf("unknown mail transport %q", cfg.mail.transport)
+	}
+
+	return mailer.New(sender, cfg.smtp.sender, cfg.smtp.retries)
+}
+
 func openDB(cfg config) (*sql.DB, error) {
 	db, err := sql.Open("postgres", cfg.db.dsn)
 	if err != nil {
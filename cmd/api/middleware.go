@@ -7,14 +7,12 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
-	"time"
 
 	"github.com/PriyanshuSharma23/greenlight/internal/data"
+	"github.com/PriyanshuSharma23/greenlight/internal/jwt"
 	"github.com/PriyanshuSharma23/greenlight/internal/validator"
 	"github.com/felixge/httpsnoop"
 	"github.com/tomasen/realip"
-	"golang.org/x/time/rate"
 )
 
 func (app *application) recoverPanic(next http.Handler) http.Handler {
@@ -30,84 +28,60 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
-func (app *application) rateLimiter(next http.Handler) http.Handler {
-	type client struct {
-		limiter  *rate.Limiter
-		lastSeen time.Time
-	}
-
-	var (
-		mu      sync.Mutex
-		clients = make(map[string]*client)
-	)
-
-	go (func() {
-		for {
-			time.Sleep(3 * time.Second)
-
-			mu.Lock()
-			for ip, client := range clients {
-				if time.Since(client.lastSeen) > time.Minute*3 {
-					delete(clients, ip)
-				}
-			}
-			mu.Unlock()
-		}
-	})()
-
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if app.config.limter.enabled {
-			ip := realip.FromRequest(r)
-			mu.Lock()
-
-			if _, fnd := clients[ip]; !fnd {
-				clients[ip] = &client{
-					limiter: rate.NewLimiter(rate.Limit(app.config.limter.rps), app.config.limter.burst),
-				}
-			}
-
-			clients[ip].lastSeen = time.Now()
-
-			if !clients[ip].limiter.Allow() {
-				mu.Unlock()
-				app.tooManyRequestsResponse(w, r)
-				return
-			}
-
-			mu.Unlock()
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
 
 		header := r.Header.Get("Authorization")
 		if header == "" {
+			if cookie := app.cookieValue(r, sessionCookie); cookie != "" {
+				app.authenticateCookie(w, r, cookie, next)
+				return
+			}
+
 			r = app.contextSetUser(r, data.AnonymousUser)
 			next.ServeHTTP(w, r)
 			return
 		}
 
 		headerParts := strings.Split(header, " ")
-		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		if len(headerParts) != 2 {
 			app.invalidAuthenticationTokenResponse(w, r)
 			return
 		}
 
-		token := headerParts[1]
+		scheme, credential := headerParts[0], headerParts[1]
+
+		var user *data.User
+		var err error
+
+		switch {
+		// API keys are accepted under their own scheme, or as bearer tokens
+		// for clients that only know about those
+		case scheme == "ApiKey" || (scheme == "Bearer" && data.IsAPIKey(credential)):
+			var key *data.APIKey
+
+			key, user, err = app.authenticateAPIKey(credential, realip.FromRequest(r))
+			if err == nil {
+				r = app.contextSetAPIKey(r, key)
+			}
+
+		case scheme == "Bearer" && app.jwtKeys != nil && jwt.IsToken(credential):
+			var claims *authClaims
+
+			user, claims, err = app.authenticateJWT(r, credential)
+			if err == nil {
+				r = app.contextSetClaims(r, claims)
+			}
 
-		v := validator.New()
+		case scheme == "Bearer":
+			user, err = app.authenticateToken(r, credential)
 
-		if data.ValidatePlaintextToken(v, token); !v.Valid() {
+		default:
 			app.invalidAuthenticationTokenResponse(w, r)
 			return
 		}
 
-		user, err := app.models.Users.GetForToken(token, data.ScopeAuthentication)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrNoRecordFound):
@@ -123,10 +97,97 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// authenticateToken looks up the owner of an authentication token, recording
+// that it was used by the client making r.
+func (app *application) authenticateToken(r *http.Request, plaintext string) (*data.User, error) {
+	v := validator.New()
+
+	if data.ValidatePlaintextToken(v, plaintext); !v.Valid() {
+		return nil, data.ErrNoRecordFound
+	}
+
+	user, err := app.models.Users.GetForToken(plaintext, data.ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.models.Tokens.Touch(plaintext, realip.FromRequest(r), userAgent(r))
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// authenticateCookie authenticates a request by its session cookie. A cookie
+// that no longer works is ignored rather than refused, since the browser
+// keeps sending it and it mustn't get in the way of logging in again. So is
+// one sent without the CSRF token, which requireAuthentication then reports.
+func (app *application) authenticateCookie(w http.ResponseWriter, r *http.Request, cookie string, next http.Handler) {
+	w.Header().Add("Vary", "Cookie")
+
+	var user *data.User
+	var err error
+
+	if app.jwtKeys != nil && jwt.IsToken(cookie) {
+		var claims *authClaims
+
+		user, claims, err = app.authenticateJWT(r, cookie)
+		if err == nil {
+			r = app.contextSetClaims(r, claims)
+		}
+	} else {
+		user, err = app.authenticateToken(r, cookie)
+	}
+
+	switch {
+	case errors.Is(err, data.ErrNoRecordFound):
+		user = data.AnonymousUser
+	case err != nil:
+		app.serverErrorResponse(w, r, err)
+		return
+	case !app.validCSRF(r):
+		user = data.AnonymousUser
+		r = app.contextSetCSRFFailed(r)
+	default:
+		r = app.contextSetUsesCookies(r)
+	}
+
+	r = app.contextSetUser(r, user)
+	next.ServeHTTP(w, r)
+}
+
+// authenticateAPIKey looks up the key and its owner, recording that it was
+// used from ip.
+func (app *application) authenticateAPIKey(plaintext, ip string) (*data.APIKey, *data.User, error) {
+	v := validator.New()
+
+	if data.ValidatePlaintextAPIKey(v, plaintext); !v.Valid() {
+		return nil, nil, data.ErrNoRecordFound
+	}
+
+	key, user, err := app.models.APIKeys.GetForKey(plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = app.models.APIKeys.Touch(key.ID, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, user, nil
+}
+
 func (app *application) requireAuthentication(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
 		if user.IsAnonymous() {
+			if app.contextCSRFFailed(r) {
+				app.invalidCSRFTokenResponse(w, r)
+				return
+			}
+
 			app.authenticationRequiredResponse(w, r)
 			return
 		}
@@ -150,17 +211,71 @@ func (app *application) requireActivatedUser(next http.HandlerFunc) http.Handler
 	return app.requireAuthentication(fn)
 }
 
-func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+// requireUserSession refuses requests made with an API key. Keys act for
+// their owner on the resources they were granted, but can't manage the
+// account or create further credentials.
+func (app *application) requireUserSession(next http.HandlerFunc) http.HandlerFunc {
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		user := app.contextGetUser(r)
+		if app.contextGetAPIKey(r) != nil {
+			app.notPermittedResponse(w, r)
+			return
+		}
 
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		next.ServeHTTP(w, r)
+	})
+
+	return app.requireCurrentUser(fn)
+}
+
+// requireCurrentUser loads the full user record for requests authenticated
+// with a JWT, whose claims only identify the user. Handlers that read or
+// change the account need it.
+func (app *application) requireCurrentUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetClaims(r) == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := app.models.Users.Get(app.contextGetUser(r).ID)
 		if err != nil {
-			app.serverErrorResponse(w, r, err)
+			switch {
+			case errors.Is(err, data.ErrNoRecordFound):
+				app.invalidAuthenticationTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
 			return
 		}
 
-		if !permissions.Include(code) {
+		r = app.contextSetUser(r, user)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		var permissions data.Permissions
+
+		if claims := app.contextGetClaims(r); claims != nil {
+			permissions = claims.Permissions
+		} else {
+			var err error
+
+			permissions, err = app.models.Permissions.GetAllForUser(user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		// an API key only carries the permissions it was created with, as
+		// long as its owner still has them
+		key := app.contextGetAPIKey(r)
+
+		if !permissions.Include(code) || (key != nil && !key.Permissions.Include(code)) {
 			app.notPermittedResponse(w, r)
 			return
 		}
@@ -171,29 +286,18 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	return app.requireActivatedUser(fn)
 }
 
+// enableCORS adds the CORS headers the policy calls for and answers
+// preflight requests.
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Add("Vary", "Origin")
-		w.Header().Add("Vary", "Access-Control-Request-Method")
-
-		origin := r.Header.Get("Origin")
-
-		if origin != "" {
-			for _, host := range app.config.cors.trustedOrigins {
-				if host == origin {
-
-					w.Header().Set("Access-Control-Allow-Origin", host)
-
-					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
-						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		engine, err := app.cors.engine(app.config())
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 
-						w.WriteHeader(http.StatusOK)
-						return
-					}
-					break
-				}
-			}
+		if engine.Handle(w, r) {
+			return
 		}
 
 		next.ServeHTTP(w, r)
@@ -201,11 +305,14 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 }
 
 func (app *application) metrics(next http.Handler) http.Handler {
-	totalRequestsReceived := expvar.NewInt("total_requests_received")
-	totalResponsesSent := expvar.NewInt("total_responses_sent")
-	totalProcessingTimeMicroseconds := expvar.NewInt("total_processing_time_μs")
+	totalRequestsReceived := publishedInt("total_requests_received")
+	totalResponsesSent := publishedInt("total_responses_sent")
+	totalProcessingTimeMicroseconds := publishedInt("total_processing_time_μs")
 
-	totalResponsesSentByStatus := expvar.NewMap("total_responses_sent_by_status")
+	totalResponsesSentByStatus, ok := expvar.Get("total_responses_sent_by_status").(*expvar.Map)
+	if !ok {
+		totalResponsesSentByStatus = expvar.NewMap("total_responses_sent_by_status")
+	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		totalRequestsReceived.Add(1)
@@ -216,3 +323,13 @@ func (app *application) metrics(next http.Handler) http.Handler {
 		totalResponsesSentByStatus.Add(strconv.Itoa(m.Code), 1)
 	})
 }
+
+// publishedInt returns the expvar counter with the given name, creating it on
+// first use so that routes() can be built more than once in the same process.
+func publishedInt(name string) *expvar.Int {
+	if v, ok := expvar.Get(name).(*expvar.Int); ok {
+		return v
+	}
+
+	return expvar.NewInt(name)
+}
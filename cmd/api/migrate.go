@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/jsonlogger"
+	"github.com/PriyanshuSharma23/greenlight/internal/migrate"
+	"github.com/PriyanshuSharma23/greenlight/migrations"
+)
+
+const migrateUsage = "usage: api [flags] migrate up | down [N] | status | goto N | force N"
+
+func newMigrator(db *sql.DB, logger *jsonlogger.Logger) (*migrate.Migrator, error) {
+	return migrate.New(db, migrations.FS, logger)
+}
+
+// runMigrate implements the `migrate` subcommand.
+func runMigrate(db *sql.DB, logger *jsonlogger.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	m, err := newMigrator(db, logger)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		return m.Up(ctx)
+
+	case args[0] == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errors.New("migrate: down expects a positive number of steps")
+			}
+		}
+		return m.Down(ctx, steps)
+
+	case args[0] == "goto" && len(args) == 2:
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errors.New("migrate: goto expects a version number")
+		}
+		return m.Goto(ctx, version)
+
+	case args[0] == "force" && len(args) == 2:
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errors.New("migrate: force expects a version number")
+		}
+		return m.Force(ctx, version)
+
+	case args[0] == "status" && len(args) == 1:
+		current, dirty, statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("current version: %d (dirty: %t)\n\n", current, dirty)
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS")
+		for _, s := range statuses {
+			status := "pending"
+			if s.Applied {
+				status = "applied"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, status)
+		}
+		return tw.Flush()
+
+	default:
+		return errors.New(migrateUsage)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+type testMovie struct {
+	ID      int
+	Title   string
+	Year    int
+	Runtime string
+	Genres  []string
+	Version int
+}
+
+func TestMovieCRUD(t *testing.T) {
+	h := newTestHarness(t)
+	token := h.newUser(t, "writer@example.com", "movies:write")
+
+	var created struct{ Movie testMovie }
+	body := map[string]any{"title": "Moana", "year": 2016, "runtime": "107 mins", "genres": []string{"animation", "adventure"}}
+	if code := h.do(t, http.MethodPost, "/v1/movies", token, body, &created); code != http.StatusOK {
+		t.Fatalf("create: got status %d", code)
+	}
+
+	path := fmt.Sprintf("/v1/movies/%d", created.Movie.ID)
+
+	var shown struct{ Movie testMovie }
+	if code := h.do(t, http.MethodGet, path, token, nil, &shown); code != http.StatusOK {
+		t.Fatalf("show: got status %d", code)
+	}
+	if shown.Movie.Title != "Moana" || shown.Movie.Runtime != "107 min" || shown.Movie.Version != 1 {
+		t.Errorf("show: got %+v", shown.Movie)
+	}
+
+	var updated struct{ Movie testMovie }
+	if code := h.do(t, http.MethodPatch, path, token, map[string]any{"year": 2017}, &updated); code != http.StatusOK {
+		t.Fatalf("update: got status %d", code)
+	}
+	if updated.Movie.Year != 2017 || updated.Movie.Version != 2 || updated.Movie.Title != "Moana" {
+		t.Errorf("update: got %+v", updated.Movie)
+	}
+
+	var invalid struct{ Error map[string]string }
+	if code := h.do(t, http.MethodPatch, path, token, map[string]any{"year": 1500}, &invalid); code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid update: got status %d", code)
+	}
+
+	var list struct {
+		Movies   []testMovie
+		Metadata struct {
+			TotalRecords int `json:"total_records"`
+		}
+	}
+	if code := h.do(t, http.MethodGet, "/v1/movies?title=moana&genres=animation", token, nil, &list); code != http.StatusOK {
+		t.Fatalf("list: got status %d", code)
+	}
+	if len(list.Movies) != 1 || list.Metadata.TotalRecords != 1 {
+		t.Errorf("list: got %+v", list)
+	}
+
+	if code := h.do(t, http.MethodDelete, path, token, nil, nil); code != http.StatusOK {
+		t.Fatalf("delete: got status %d", code)
+	}
+
+	if code := h.do(t, http.MethodGet, path, token, nil, nil); code != http.StatusNotFound {
+		t.Errorf("show deleted: got status %d", code)
+	}
+
+	if code := h.do(t, http.MethodDelete, path, token, nil, nil); code != http.StatusNotFound {
+		t.Errorf("delete twice: got status %d", code)
+	}
+}
+
+func TestListMoviesValidation(t *testing.T) {
+	h := newTestHarness(t)
+	token := h.newUser(t, "reader@example.com")
+
+	for _, query := range []string{"page=0", "page_size=101", "sort=-unknown", "page=abc"} {
+		t.Run(query, func(t *testing.T) {
+			if code := h.do(t, http.MethodGet, "/v1/movies?"+query, token, nil, nil); code != http.StatusUnprocessableEntity {
+				t.Errorf("got status %d; want %d", code, http.StatusUnprocessableEntity)
+			}
+		})
+	}
+}
+
+func TestMoviePermissions(t *testing.T) {
+	h := newTestHarness(t)
+
+	writer := h.newUser(t, "writer@example.com", "movies:write")
+	reader := h.newUser(t, "reader@example.com")
+
+	h.registerUser(t, "Inactive", "inactive@example.com", "pa55word")
+	inactive := h.authenticate(t, "inactive@example.com", "pa55word")
+
+	var seeded struct{ Movie testMovie }
+	body := map[string]any{"title": "Moana", "year": 2016, "runtime": "107 mins", "genres": []string{"animation"}}
+	if code := h.do(t, http.MethodPost, "/v1/movies", writer, body, &seeded); code != http.StatusOK {
+		t.Fatalf("seed: got status %d", code)
+	}
+
+	path := fmt.Sprintf("/v1/movies/%d", seeded.Movie.ID)
+
+	endpoints := []struct {
+		method string
+		path   string
+		body   any
+		write  bool
+	}{
+		{http.MethodGet, "/v1/movies", nil, false},
+		{http.MethodGet, path, nil, false},
+		{http.MethodPost, "/v1/movies", body, true},
+		{http.MethodPatch, path, map[string]any{"title": "Moana"}, true},
+	}
+
+	users := []struct {
+		name      string
+		token     string
+		readCode  int
+		writeCode int
+	}{
+		{"Anonymous", "", http.StatusUnauthorized, http.StatusUnauthorized},
+		{"Invalid token", "ABCDEFGHIJKLMNOPQRSTUVWXYZ", http.StatusUnauthorized, http.StatusUnauthorized},
+		{"Inactive", inactive, http.StatusForbidden, http.StatusForbidden},
+		{"Reader", reader, http.StatusOK, http.StatusForbidden},
+		{"Writer", writer, http.StatusOK, http.StatusOK},
+	}
+
+	for _, u := range users {
+		for _, e := range endpoints {
+			t.Run(fmt.Sprintf("%s %s %s", u.name, e.method, e.path), func(t *testing.T) {
+				want := u.readCode
+				if e.write {
+					want = u.writeCode
+				}
+
+				if code := h.do(t, e.method, e.path, u.token, e.body, nil); code != want {
+					t.Errorf("got status %d; want %d", code, want)
+				}
+			})
+		}
+	}
+
+	if code := h.do(t, http.MethodDelete, path, reader, nil, nil); code != http.StatusForbidden {
+		t.Errorf("reader delete: got status %d", code)
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+	"github.com/PriyanshuSharma23/greenlight/internal/mailer"
+	"github.com/PriyanshuSharma23/greenlight/internal/oidc"
+	"github.com/PriyanshuSharma23/greenlight/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// oauthStateCookie ties a sign-in to the browser that started it, so that a
+// callback URL can't be used to sign someone else in.
+const oauthStateCookie = "greenlight_oauth_state"
+
+var providerNameRX = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// errUnverifiedEmail is returned when a provider vouches for an identity with
+// the email address of an existing user but hasn't verified it.
+var errUnverifiedEmail = errors.New("identity email address is not verified")
+
+// newOIDCProviders parses -oidc-providers. Providers are only contacted once
+// someone signs in with them.
+func newOIDCProviders(cfg config) (map[string]*oidc.Provider, error) {
+	providers := make(map[string]*oidc.Provider, len(cfg.oidc.providers))
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	for _, spec := range cfg.oidc.providers {
+		parts := strings.Split(spec, ",")
+		if len(parts) != 4 {
+			return nil, fmt.Errorf(`provider %q must be "name,issuer,client-id,client-secret"`, parts[0])
+		}
+
+		name, issuer, clientID, clientSecret := parts[0], parts[1], parts[2], parts[3]
+
+		if !providerNameRX.MatchString(name) {
+			return nil, fmt.Errorf("provider name %q must be lowercase letters, digits and dashes", name)
+		}
+
+		if providers[name] != nil {
+			return nil, fmt.Errorf("provider %q is configured twice", name)
+		}
+
+		u, err := url.Parse(issuer)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, fmt.Errorf("provider %q must have an absolute issuer URL", name)
+		}
+
+		if clientID == "" || clientSecret == "" {
+			return nil, fmt.Errorf("provider %q must have a client id and secret", name)
+		}
+
+		providers[name] = oidc.New(oidc.Config{
+			Name:         name,
+			Issuer:       issuer,
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  strings.TrimSuffix(cfg.oidc.redirectBase, "/") + "/v1/oauth/" + name + "/callback",
+		}, client)
+	}
+
+	return providers, nil
+}
+
+func (app *application) readProviderParam(r *http.Request) *oidc.Provider {
+	return app.oidc[httprouter.ParamsFromContext(r.Context()).ByName("provider")]
+}
+
+// startOAuthHandler sends the user to the provider to sign in. The state
+// parameter is also set as a cookie and checked on the way back.
+func (app *application) startOAuthHandler(w http.ResponseWriter, r *http.Request) {
+	provider := app.readProviderParam(r)
+	if provider == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	cfg := app.config().oidc
+
+	state, err := data.NewOAuthState(provider.Name(), cfg.stateTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	authURL, err := provider.AuthURL(r.Context(), state.Plaintext, state.Nonce, state.Verifier)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Identities.InsertState(state)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, app.oauthStateCookie(state.Plaintext, int(cfg.stateTTL.Seconds())))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (app *application) oauthStateCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    value,
+		Path:     "/v1/oauth/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(app.config().oidc.redirectBase, "https:"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// oauthCallbackHandler is where the provider sends the user back to. The
+// identity it vouches for signs in the user it is linked to, is linked to the
+// user with the same verified email address, or else gets a new user. Since
+// this is a browser, the session is set as cookies if they are enabled.
+func (app *application) oauthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider := app.readProviderParam(r)
+	if provider == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	q := r.URL.Query()
+
+	// the user declined or the provider failed
+	if q.Get("error") != "" {
+		app.identityProviderFailedResponse(w, r)
+		return
+	}
+
+	cookie, err := r.Cookie(oauthStateCookie)
+	if err != nil || q.Get("state") == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(q.Get("state"))) != 1 {
+		app.identityProviderFailedResponse(w, r)
+		return
+	}
+
+	http.SetCookie(w, app.oauthStateCookie("", -1))
+
+	state, err := app.models.Identities.TakeState(q.Get("state"), provider.Name())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.identityProviderFailedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), q.Get("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrRejected):
+			app.logError(r, err)
+			app.identityProviderFailedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+
+	user, err := app.linkIdentity(r, v, provider.Name(), identity)
+	if err != nil {
+		switch {
+		case !v.Valid():
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, errUnverifiedEmail):
+			// saying why would tell whoever controls the identity that the
+			// address is registered
+			app.identityProviderFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict), errors.Is(err, data.ErrDuplicateEmail):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.completeLogin(w, r, user, true)
+}
+
+// linkIdentity returns the user signing in as identity, linking it to an
+// existing or new user the first time. A user found by email address is only
+// trusted when the provider has verified it, which also claims them if they
+// weren't activated. The errors that make a new user invalid are added to v.
+func (app *application) linkIdentity(r *http.Request, v *validator.Validator, provider string, identity *oidc.Identity) (*data.User, error) {
+	var user *data.User
+	created := false
+
+	err := app.models.Transaction(func(tx data.Models) error {
+		var err error
+
+		user, err = tx.Identities.GetUser(provider, identity.Subject)
+		switch {
+		case err == nil:
+			if !user.Activated && identity.EmailVerified && strings.EqualFold(user.Email, identity.Email) {
+				return activateUser(tx, user)
+			}
+			return nil
+		case !errors.Is(err, data.ErrNoRecordFound):
+			return err
+		}
+
+		if data.ValidateEmail(v, identity.Email); !v.Valid() {
+			return errors.New("invalid identity")
+		}
+
+		user, err = tx.Users.GetByEmail(identity.Email)
+		switch {
+		case err == nil:
+			if !identity.EmailVerified {
+				return errUnverifiedEmail
+			}
+
+			if !user.Activated {
+				err = app.claimUser(tx, user)
+				if err != nil {
+					return err
+				}
+			}
+		case errors.Is(err, data.ErrNoRecordFound):
+			user, err = app.newIdentityUser(tx, r, v, identity)
+			if err != nil {
+				return err
+			}
+			created = true
+		default:
+			return err
+		}
+
+		return tx.Identities.Insert(&data.Identity{
+			Provider: provider,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+			UserID:   user.ID,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if created && !user.Activated {
+		app.notifyOutbox()
+	}
+
+	return user, nil
+}
+
+// newIdentityUser registers a user for an identity. Nobody knows their random
+// password, so they sign in through the provider, and they have to activate
+// their account unless the provider verified the email address.
+func (app *application) newIdentityUser(tx data.Models, r *http.Request, v *validator.Validator, identity *oidc.Identity) (*data.User, error) {
+	user := &data.User{
+		Name:      identity.Name,
+		Email:     identity.Email,
+		Locale:    mailer.MatchLocale(r.Header.Get("Accept-Language")),
+		Activated: identity.EmailVerified,
+	}
+
+	if user.Name == "" {
+		user.Name = identity.Email
+	}
+
+	password, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	err = user.Password.Set(password)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.ValidateUser(v, user); !v.Valid() {
+		return nil, errors.New("invalid identity")
+	}
+
+	err = tx.Users.Insert(user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Permissions.AddForUser(user.ID, "movies:read")
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Activated {
+		return user, nil
+	}
+
+	token, err := tx.Tokens.New(user.ID, time.Hour*24*3, data.ScopeActivation)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.enqueueEmail(tx, user.Email, user.Locale, "user_welcome.tmpl", map[string]any{
+		"userID":          user.ID,
+		"activationToken": token.Plaintext,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// claimUser activates a user found by an address the provider has verified.
+// Whoever registered it never proved they own it, so the password they chose
+// and their sessions are discarded; the owner signs in through the provider
+// or resets the password.
+func (app *application) claimUser(tx data.Models, user *data.User) error {
+	password, err := oidc.RandomString()
+	if err != nil {
+		return err
+	}
+
+	err = user.Password.Set(password)
+	if err != nil {
+		return err
+	}
+
+	user.PendingEmail = ""
+
+	err = activateUser(tx, user)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Tokens.DeleteAllScopesForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	return app.revokeUserJWTs(tx, user.ID)
+}
+
+func activateUser(tx data.Models, user *data.User) error {
+	user.Activated = true
+
+	err := tx.Users.UpdateUser(user)
+	if err != nil {
+		return err
+	}
+
+	return tx.Tokens.DeleteAllForUser(user.ID, data.ScopeActivation)
+}
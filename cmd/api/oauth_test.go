@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/oidc"
+	"github.com/PriyanshuSharma23/greenlight/internal/oidc/oidctest"
+)
+
+// useOIDC configures a stub provider called "stub" that signs in as identity.
+func (h *testHarness) useOIDC(t *testing.T, identity oidc.Identity) *oidctest.Server {
+	t.Helper()
+
+	srv, err := oidctest.NewServer("greenlight", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+
+	srv.SetIdentity(identity)
+
+	h.app.oidc = map[string]*oidc.Provider{
+		"stub": oidc.New(srv.Config("stub", h.server.URL+"/v1/oauth/stub/callback"), srv.Client()),
+	}
+
+	return srv
+}
+
+// startOAuth begins a sign-in and follows it through the stub provider,
+// returning the callback URL and the state cookie to present there.
+func (h *testHarness) startOAuth(t *testing.T) (string, *http.Cookie) {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	res, err := client.Get(h.server.URL + "/v1/oauth/stub/start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("start: got status %d; want %d", res.StatusCode, http.StatusFound)
+	}
+
+	var cookie *http.Cookie
+	for _, c := range res.Cookies() {
+		if c.Name == oauthStateCookie {
+			cookie = c
+		}
+	}
+
+	if cookie == nil || !cookie.HttpOnly {
+		t.Fatalf("start: got state cookie %v", cookie)
+	}
+
+	res, err = client.Get(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: got status %d; want %d", res.StatusCode, http.StatusFound)
+	}
+
+	return res.Header.Get("Location"), cookie
+}
+
+type oauthResponse struct {
+	AuthenticationToken struct{ Token string } `json:"authentication_token"`
+	RefreshToken        struct{ Token string } `json:"refresh_token"`
+	TwoFactorToken      struct{ Token string } `json:"two_factor_token"`
+	Error               any                    `json:"error"`
+}
+
+func (h *testHarness) oauthCallback(t *testing.T, callbackURL string, cookie *http.Cookie) (int, oauthResponse) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, callbackURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	res, err := h.server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var dst oauthResponse
+
+	err = json.NewDecoder(res.Body).Decode(&dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res.StatusCode, dst
+}
+
+func (h *testHarness) oauthLogin(t *testing.T) (int, oauthResponse) {
+	t.Helper()
+
+	callbackURL, cookie := h.startOAuth(t)
+	return h.oauthCallback(t, callbackURL, cookie)
+}
+
+func TestOAuthNewUser(t *testing.T) {
+	h := newTestHarness(t)
+	h.useOIDC(t, oidc.Identity{Subject: "u-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"})
+
+	code, res := h.oauthLogin(t)
+	if code != http.StatusCreated || res.AuthenticationToken.Token == "" || res.RefreshToken.Token == "" {
+		t.Fatalf("callback: got status %d and response %+v", code, res)
+	}
+
+	user, err := h.app.models.Users.GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !user.Activated || user.Name != "Alice" {
+		t.Errorf("got user %+v; want an activated user named Alice", user)
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/movies", res.AuthenticationToken.Token, nil, nil); code != http.StatusOK {
+		t.Errorf("list movies: got status %d; want %d", code, http.StatusOK)
+	}
+
+	// signing in again finds the same user through the linked identity
+	code, _ = h.oauthLogin(t)
+	if code != http.StatusCreated {
+		t.Fatalf("second sign-in: got status %d; want %d", code, http.StatusCreated)
+	}
+
+	identities, err := h.app.models.Identities.GetAllForUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(identities) != 1 || identities[0].Provider != "stub" || identities[0].Subject != "u-1" {
+		t.Errorf("got identities %+v", identities)
+	}
+}
+
+func TestOAuthUnverifiedNewUser(t *testing.T) {
+	h := newTestHarness(t)
+	h.useOIDC(t, oidc.Identity{Subject: "u-1", Email: "alice@example.com"})
+
+	code, res := h.oauthLogin(t)
+	if code != http.StatusCreated {
+		t.Fatalf("callback: got status %d; want %d", code, http.StatusCreated)
+	}
+
+	if code := h.do(t, http.MethodPost, "/v1/users/me/api-keys", res.AuthenticationToken.Token, map[string]any{}, nil); code != http.StatusForbidden {
+		t.Errorf("inactive user: got status %d; want %d", code, http.StatusForbidden)
+	}
+
+	// the welcome email activates the account as usual
+	h.activateUser(t, "alice@example.com")
+
+	user, err := h.app.models.Users.GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !user.Activated {
+		t.Error("user was not activated")
+	}
+}
+
+func TestOAuthExistingUser(t *testing.T) {
+	h := newTestHarness(t)
+
+	h.newUser(t, "alice@example.com")
+	srv := h.useOIDC(t, oidc.Identity{Subject: "u-1", Email: "alice@example.com"})
+
+	// an unverified address could belong to anyone, so it mustn't take over
+	// the account
+	if code, _ := h.oauthLogin(t); code != http.StatusUnauthorized {
+		t.Errorf("unverified email: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+
+	srv.SetIdentity(oidc.Identity{Subject: "u-1", Email: "alice@example.com", EmailVerified: true})
+
+	code, res := h.oauthLogin(t)
+	if code != http.StatusCreated {
+		t.Fatalf("verified email: got status %d; want %d", code, http.StatusCreated)
+	}
+
+	var me struct {
+		User struct{ Email string } `json:"user"`
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/users/me", res.AuthenticationToken.Token, nil, &me); code != http.StatusOK || me.User.Email != "alice@example.com" {
+		t.Errorf("show current user: got status %d and email %q", code, me.User.Email)
+	}
+
+	// the password keeps working too
+	h.authenticate(t, "alice@example.com", "pa55word")
+}
+
+// TestOAuthPreRegisteredUser is someone registering an address before its
+// owner signs in with a provider that verifies it.
+func TestOAuthPreRegisteredUser(t *testing.T) {
+	h := newTestHarness(t)
+
+	h.registerUser(t, "Mallory", "alice@example.com", "pa55word")
+	token := h.authenticate(t, "alice@example.com", "pa55word")
+
+	h.useOIDC(t, oidc.Identity{Subject: "u-1", Email: "alice@example.com", EmailVerified: true})
+
+	if code, _ := h.oauthLogin(t); code != http.StatusCreated {
+		t.Fatalf("verified email: got status %d; want %d", code, http.StatusCreated)
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/users/me", token, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("earlier session: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+
+	if code, _ := h.login(t, "alice@example.com", "pa55word"); code != http.StatusUnauthorized {
+		t.Errorf("earlier password: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestOAuthState(t *testing.T) {
+	h := newTestHarness(t)
+	h.useOIDC(t, oidc.Identity{Subject: "u-1", Email: "alice@example.com", EmailVerified: true})
+
+	callbackURL, cookie := h.startOAuth(t)
+
+	if code, _ := h.oauthCallback(t, callbackURL, nil); code != http.StatusUnauthorized {
+		t.Errorf("no cookie: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+
+	other := *cookie
+	other.Value = "another-state"
+
+	if code, _ := h.oauthCallback(t, callbackURL, &other); code != http.StatusUnauthorized {
+		t.Errorf("wrong cookie: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+
+	if code, _ := h.oauthCallback(t, callbackURL, cookie); code != http.StatusCreated {
+		t.Fatalf("callback: got status %d; want %d", code, http.StatusCreated)
+	}
+
+	if code, _ := h.oauthCallback(t, callbackURL, cookie); code != http.StatusUnauthorized {
+		t.Errorf("replayed callback: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/oauth/unknown/start", "", nil, nil); code != http.StatusNotFound {
+		t.Errorf("unknown provider: got status %d; want %d", code, http.StatusNotFound)
+	}
+}
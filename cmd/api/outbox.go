@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+	"github.com/PriyanshuSharma23/greenlight/internal/jobs"
+)
+
+// outboxLease is how long a claimed email is hidden from other workers. It
+// must comfortably exceed a delivery attempt including the mailer's retries.
+const outboxLease = time.Minute
+
+type outbox struct {
+	wake chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// startOutbox launches the workers that deliver queued email.
+func (app *application) startOutbox() {
+	app.outbox.wake = make(chan struct{}, 1)
+	app.outbox.stop = make(chan struct{})
+
+	for i := 0; i < app.config().outbox.workers; i++ {
+		app.outbox.wg.Add(1)
+		go app.outboxWorker()
+	}
+}
+
+// stopOutbox waits for in-flight deliveries to finish. Anything still queued
+// stays in the outbox for the next start.
+func (app *application) stopOutbox() {
+	if app.outbox.stop == nil {
+		return
+	}
+
+	close(app.outbox.stop)
+	app.outbox.wg.Wait()
+}
+
+// notifyOutbox wakes an idle worker after an email has been enqueued, so it
+// doesn't have to wait for the next poll.
+func (app *application) notifyOutbox() {
+	select {
+	case app.outbox.wake <- struct{}{}:
+	default:
+	}
+}
+
+// enqueueEmail adds an email to the outbox using models, which may be bound
+// to the caller's transaction. It is rendered in the given locale.
+func (app *application) enqueueEmail(models data.Models, recipient, locale, templateFile string, templateData map[string]any) error {
+	return models.Emails.Enqueue(&data.Email{
+		Recipient: recipient,
+		Template:  templateFile,
+		Locale:    locale,
+		Data:      templateData,
+	})
+}
+
+func (app *application) outboxWorker() {
+	defer app.outbox.wg.Done()
+
+	for {
+		select {
+		case <-app.outbox.stop:
+			return
+		default:
+		}
+
+		if app.deliverNextEmail() {
+			continue
+		}
+
+		// idle workers clear out dead emails, whose data holds live tokens
+		err := app.models.Emails.DeleteDead(app.config().outbox.deadRetention)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+
+		select {
+		case <-app.outbox.stop:
+			return
+		case <-app.outbox.wake:
+		case <-time.After(app.config().outbox.pollInterval):
+		}
+	}
+}
+
+// deliverNextEmail sends one due email and reports whether there was one.
+func (app *application) deliverNextEmail() bool {
+	email, err := app.models.Emails.ClaimNext(outboxLease)
+	if err != nil {
+		if !errors.Is(err, data.ErrNoRecordFound) {
+			app.logger.PrintError(err, nil)
+		}
+		return false
+	}
+
+	err = app.mailer.Load().Send(email.Recipient, email.Template, email.Locale, email.Data)
+	if err == nil {
+		err = app.models.Emails.MarkSent(email.ID)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+		return true
+	}
+
+	cfg := app.config().outbox
+	dead := email.Attempts >= cfg.maxAttempts
+
+	app.logger.PrintError(err, map[string]string{
+		"email_id": strconv.FormatInt(email.ID, 10),
+		"attempt":  strconv.Itoa(email.Attempts),
+		"dead":     strconv.FormatBool(dead),
+	})
+
+	err = app.models.Emails.MarkFailed(email.ID, err.Error(), jobs.Backoff(email.Attempts, cfg.backoffBase, cfg.backoffMax), dead)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+	}
+
+	return true
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+	"github.com/tomasen/realip"
+	"golang.org/x/time/rate"
+)
+
+// defaultTier is the tier of anonymous clients and of users without another
+// one. It is set by -limiter-rps and -limiter-burst.
+const defaultTier = "default"
+
+// userTierTTL is how long a user's tier is remembered before it is looked up
+// again, so that changes to it or their permissions apply soon enough.
+const userTierTTL = time.Minute
+
+// limiterTier is how many requests per second a client may make, and how many
+// at once.
+type limiterTier struct {
+	rps   rate.Limit
+	burst int
+}
+
+// limiterRoute puts an extra limit on requests to a path, or to paths
+// starting with it if prefix is set, on top of the client's own.
+type limiterRoute struct {
+	method string
+	path   string
+	prefix bool
+	tier   string
+}
+
+// limiterPolicy is the parsed rate limiting configuration. credentials limits
+// the requests with credentials from an IP before they are authenticated.
+type limiterPolicy struct {
+	tiers           map[string]limiterTier
+	permissionTiers map[string]string
+	routes          []limiterRoute
+	credentials     limiterTier
+}
+
+func newLimiterPolicy(cfg config) (*limiterPolicy, error) {
+	p := &limiterPolicy{
+		tiers:           map[string]limiterTier{defaultTier: {rate.Limit(cfg.limter.rps), cfg.limter.burst}},
+		permissionTiers: make(map[string]string),
+		credentials:     limiterTier{rate.Limit(cfg.limter.credentialsRPS), cfg.limter.credentialsBurst},
+	}
+
+	for _, spec := range cfg.limter.tiers {
+		parts := strings.Split(spec, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf(`tier %q must be "name:rps:burst"`, spec)
+		}
+
+		name := parts[0]
+
+		if _, ok := p.tiers[name]; ok || name == "" {
+			return nil, fmt.Errorf("tier %q must have a new name", spec)
+		}
+
+		rps, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || rps <= 0 || math.IsNaN(rps) {
+			return nil, fmt.Errorf("tier %q must have a positive rps", name)
+		}
+
+		burst, err := strconv.Atoi(parts[2])
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("tier %q must have a burst of at least 1", name)
+		}
+
+		p.tiers[name] = limiterTier{rate.Limit(rps), burst}
+	}
+
+	for _, spec := range cfg.limter.permissionTiers {
+		code, tier, ok := strings.Cut(spec, "=")
+		if !ok || code == "" {
+			return nil, fmt.Errorf(`permission tier %q must be "permission=tier"`, spec)
+		}
+
+		if _, ok := p.tiers[tier]; !ok {
+			return nil, fmt.Errorf("permission tier %q uses an unknown tier", spec)
+		}
+
+		p.permissionTiers[code] = tier
+	}
+
+	for _, spec := range cfg.limter.routes {
+		pattern, tier, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf(`route %q must be "[METHOD:]/path=tier"`, spec)
+		}
+
+		if _, ok := p.tiers[tier]; !ok {
+			return nil, fmt.Errorf("route %q uses an unknown tier", spec)
+		}
+
+		route := limiterRoute{tier: tier}
+
+		if !strings.HasPrefix(pattern, "/") {
+			route.method, pattern, _ = strings.Cut(pattern, ":")
+			if route.method != strings.ToUpper(route.method) || !strings.HasPrefix(pattern, "/") {
+				return nil, fmt.Errorf(`route %q must be "[METHOD:]/path=tier"`, spec)
+			}
+		}
+
+		route.path, route.prefix = strings.CutSuffix(pattern, "*")
+		p.routes = append(p.routes, route)
+	}
+
+	return p, nil
+}
+
+// route returns the index of the first route r matches, or -1.
+func (p *limiterPolicy) route(r *http.Request) int {
+	for i, route := range p.routes {
+		if route.method != "" && route.method != r.Method {
+			continue
+		}
+
+		if r.URL.Path == route.path || (route.prefix && strings.HasPrefix(r.URL.Path, route.path)) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// userTier picks the tier assigned to a user if it is configured, or else the
+// most generous one their permissions earn.
+func (p *limiterPolicy) userTier(assigned string, permissions data.Permissions) string {
+	if _, ok := p.tiers[assigned]; ok {
+		return assigned
+	}
+
+	best := defaultTier
+
+	for _, code := range permissions {
+		tier, ok := p.permissionTiers[code]
+		if !ok {
+			continue
+		}
+
+		a, b := p.tiers[tier], p.tiers[best]
+		if a.rps > b.rps || (a.rps == b.rps && a.burst > b.burst) {
+			best = tier
+		}
+	}
+
+	return best
+}
+
+type limiterClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type cachedTier struct {
+	tier    string
+	expires time.Time
+}
+
+// rateLimits holds a limiter per client, and per client and route, along with
+// the users' tiers and the policy built from the current configuration.
+type rateLimits struct {
+	mu      sync.Mutex
+	clients map[string]*limiterClient
+	tiers   map[int64]cachedTier
+	cfg     *config
+	policy  *limiterPolicy
+}
+
+func newRateLimits() *rateLimits {
+	l := &rateLimits{
+		clients: make(map[string]*limiterClient),
+		tiers:   make(map[int64]cachedTier),
+	}
+
+	go (func() {
+		for {
+			time.Sleep(3 * time.Second)
+
+			l.mu.Lock()
+			for key, client := range l.clients {
+				if time.Since(client.lastSeen) > time.Minute*3 {
+					delete(l.clients, key)
+				}
+			}
+			for id, tier := range l.tiers {
+				if time.Now().After(tier.expires) {
+					delete(l.tiers, id)
+				}
+			}
+			l.mu.Unlock()
+		}
+	})()
+
+	return l
+}
+
+// policyFor returns the policy for cfg, which is parsed again when a reload
+// replaces the configuration.
+func (l *rateLimits) policyFor(cfg *config) (*limiterPolicy, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cfg != cfg {
+		policy, err := newLimiterPolicy(*cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		// the users' tiers may be named differently now
+		l.cfg, l.policy = cfg, policy
+		clear(l.tiers)
+	}
+
+	return l.policy, nil
+}
+
+// limiterCharge is a request taken from a client's bucket.
+type limiterCharge struct {
+	reservation *rate.Reservation
+	at          time.Time
+}
+
+// refund gives the request back. Cancelling as of the time it was taken is
+// what makes the limiter restore it, since by now it has been acted on.
+func (c *limiterCharge) refund() {
+	c.reservation.CancelAt(c.at)
+}
+
+// charge takes a request from the client's bucket, which is adjusted to the
+// tier first in case that has changed since the last request. It returns nil
+// if the bucket is empty.
+func (l *rateLimits) charge(key string, tier limiterTier) *limiterCharge {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	client, ok := l.clients[key]
+	if !ok {
+		client = &limiterClient{limiter: rate.NewLimiter(tier.rps, tier.burst)}
+		l.clients[key] = client
+	}
+
+	now := time.Now()
+	client.lastSeen = now
+
+	if client.limiter.Limit() != tier.rps {
+		client.limiter.SetLimit(tier.rps)
+	}
+	if client.limiter.Burst() != tier.burst {
+		client.limiter.SetBurst(tier.burst)
+	}
+
+	reservation := client.limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return nil
+	}
+
+	if reservation.DelayFrom(now) > 0 {
+		reservation.CancelAt(now)
+		return nil
+	}
+
+	return &limiterCharge{reservation: reservation, at: now}
+}
+
+// rateLimitAddress charges every request to the client's IP before it is
+// authenticated, so that guessing credentials stops reaching the database
+// once the limit is hit. Anonymous requests are charged the default tier.
+// Requests with credentials are charged to a looser bucket of their own
+// instead, so that the users behind a shared address don't run out of it, and
+// are given back by rateLimitUser once they turn out to be from a user.
+func (app *application) rateLimitAddress(limits *rateLimits) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cfg := app.config()
+
+			if !cfg.limter.enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			policy, err := limits.policyFor(cfg)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			ip := realip.FromRequest(r)
+
+			if r.Header.Get("Authorization") == "" && app.cookieValue(r, sessionCookie) == "" {
+				if limits.charge("ip:"+ip, policy.tiers[defaultTier]) == nil {
+					app.tooManyRequestsResponse(w, r)
+					return
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			charge := limits.charge("credentials:"+ip, policy.credentials)
+			if charge == nil {
+				app.tooManyRequestsResponse(w, r)
+				return
+			}
+
+			r = app.contextSetLimiterCharge(r, charge)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitUser limits authenticated users to the rate of their tier instead
+// of their IP's, so that users sharing an address don't share a limit, and
+// every client further on routes with limits of their own.
+func (app *application) rateLimitUser(limits *rateLimits) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cfg := app.config()
+
+			if !cfg.limter.enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			policy, err := limits.policyFor(cfg)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			key := "ip:" + realip.FromRequest(r)
+			charge := app.contextGetLimiterCharge(r)
+
+			user := app.contextGetUser(r)
+			if user.IsAnonymous() && charge != nil {
+				// a session cookie that no longer works is ignored, so the
+				// request is anonymous after all
+				if limits.charge(key, policy.tiers[defaultTier]) == nil {
+					app.tooManyRequestsResponse(w, r)
+					return
+				}
+			}
+
+			if !user.IsAnonymous() {
+				key = "user:" + strconv.FormatInt(user.ID, 10)
+
+				if charge != nil {
+					charge.refund()
+				}
+
+				tier, err := app.userTier(r, limits, policy, user.ID)
+				if err != nil {
+					app.serverErrorResponse(w, r, err)
+					return
+				}
+
+				if limits.charge(key, policy.tiers[tier]) == nil {
+					app.tooManyRequestsResponse(w, r)
+					return
+				}
+			}
+
+			if i := policy.route(r); i >= 0 {
+				if limits.charge("route:"+strconv.Itoa(i)+":"+key, policy.tiers[policy.routes[i].tier]) == nil {
+					app.tooManyRequestsResponse(w, r)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// userTier returns the tier of the user making r, looking it up at most once
+// every userTierTTL.
+func (app *application) userTier(r *http.Request, limits *rateLimits, policy *limiterPolicy, userID int64) (string, error) {
+	limits.mu.Lock()
+	cached, ok := limits.tiers[userID]
+	limits.mu.Unlock()
+
+	if ok && time.Now().Before(cached.expires) {
+		return cached.tier, nil
+	}
+
+	assigned, err := app.models.RateLimits.GetTier(userID)
+	if err != nil {
+		return "", err
+	}
+
+	var permissions data.Permissions
+
+	if claims := app.contextGetClaims(r); claims != nil {
+		permissions = claims.Permissions
+	} else {
+		permissions, err = app.models.Permissions.GetAllForUser(userID)
+		if err != nil && !errors.Is(err, data.ErrNoRecordFound) {
+			return "", err
+		}
+	}
+
+	tier := policy.userTier(assigned, permissions)
+
+	limits.mu.Lock()
+	limits.tiers[userID] = cachedTier{tier: tier, expires: time.Now().Add(userTierTTL)}
+	limits.mu.Unlock()
+
+	return tier, nil
+}
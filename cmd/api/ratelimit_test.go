@@ -0,0 +1,236 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// useLimiter turns the limiter on with the given settings, which apply to
+// requests with credentials before they are authenticated as well. The rates
+// are low enough that no tokens come back during a test, so each bucket
+// allows exactly its burst.
+func (h *testHarness) useLimiter(t *testing.T, burst int, tiers, permissionTiers, routes []string) {
+	t.Helper()
+
+	cfg := *h.app.config()
+	cfg.limter.enabled = true
+	cfg.limter.rps = 0.001
+	cfg.limter.burst = burst
+	cfg.limter.credentialsRPS = 0.001
+	cfg.limter.credentialsBurst = burst
+	cfg.limter.tiers = tiers
+	cfg.limter.permissionTiers = permissionTiers
+	cfg.limter.routes = routes
+
+	if _, err := newLimiterPolicy(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	h.app.cfg.Store(&cfg)
+}
+
+// allowed counts the requests that get through out of n.
+func (h *testHarness) allowed(t *testing.T, n int, method, path, token string) int {
+	t.Helper()
+
+	allowed := 0
+	for i := 0; i < n; i++ {
+		code := h.do(t, method, path, token, nil, nil)
+		if code != http.StatusTooManyRequests {
+			allowed++
+		}
+	}
+
+	return allowed
+}
+
+func TestRateLimitTiers(t *testing.T) {
+	h := newTestHarness(t)
+
+	reader := h.newUser(t, "alice@example.com", "movies:read")
+	writer := h.newUser(t, "bob@example.com", "movies:read", "movies:write")
+	assigned := h.newUser(t, "carol@example.com", "movies:read")
+
+	carol, err := h.app.models.Users.GetByEmail("carol@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = h.app.models.RateLimits.SetTier(carol.ID, "partner")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.useLimiter(t, 2, []string{"writer:0.001:4", "partner:0.001:6"}, []string{"movies:write=writer"}, nil)
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"Default tier", reader, 2},
+		{"Permission tier", writer, 4},
+		{"Assigned tier", assigned, 6},
+		{"Anonymous", "", 2},
+	}
+
+	// every client has a bucket of its own, though they all share an address
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.allowed(t, 8, http.MethodGet, "/v1/healthcheck", tt.token); got != tt.want {
+				t.Errorf("got %d requests allowed; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitRoutes(t *testing.T) {
+	h := newTestHarness(t)
+
+	h.newUser(t, "alice@example.com")
+
+	h.useLimiter(t, 10, []string{"auth:0.001:2"}, nil, []string{"POST:/v1/tokens/*=auth"})
+
+	body := map[string]string{"email": "alice@example.com", "password": "wrong"}
+
+	codes := make([]int, 3)
+	for i := range codes {
+		codes[i] = h.do(t, http.MethodPost, "/v1/tokens/authentication", "", body, nil)
+	}
+
+	if codes[0] == http.StatusTooManyRequests || codes[1] == http.StatusTooManyRequests || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("login: got statuses %v; want the third limited", codes)
+	}
+
+	// other routes still have what is left of the client's own limit, which
+	// the logins were charged to as well
+	if got := h.allowed(t, 10, http.MethodGet, "/v1/healthcheck", ""); got != 7 {
+		t.Errorf("healthcheck: got %d requests allowed; want %d", got, 7)
+	}
+}
+
+func TestRateLimitInvalidCredentials(t *testing.T) {
+	h := newTestHarness(t)
+
+	token := h.newUser(t, "alice@example.com")
+
+	h.useLimiter(t, 3, nil, nil, nil)
+
+	// guesses are refused before they are looked up once the address has used
+	// its limit, whatever the scheme
+	guesses := []string{"Bearer ABCDEFGHIJKLMNOPQRSTUVWXYZ", "ApiKey glk_guess", "Bearer not-a-token", "Bearer ZYXWVUTSRQPONMLKJIHGFEDCBA", "ApiKey glk_other"}
+
+	codes := make([]int, len(guesses))
+	for i, guess := range guesses {
+		req, err := http.NewRequest(http.MethodGet, h.server.URL+"/v1/users/me", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", guess)
+
+		res, err := h.server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		codes[i] = res.StatusCode
+	}
+
+	want := []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusTooManyRequests}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Errorf("got statuses %v; want %v", codes, want)
+			break
+		}
+	}
+
+	// the address stays limited for credentials until its bucket refills, for
+	// users too, but anonymous requests have a limit of their own
+	if code := h.do(t, http.MethodGet, "/v1/users/me", token, nil, nil); code != http.StatusTooManyRequests {
+		t.Errorf("valid token from the same address: got status %d; want %d", code, http.StatusTooManyRequests)
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/healthcheck", "", nil, nil); code != http.StatusOK {
+		t.Errorf("anonymous request from the same address: got status %d; want %d", code, http.StatusOK)
+	}
+}
+
+func TestRateLimitSharedAddress(t *testing.T) {
+	h := newTestHarness(t)
+
+	tokens := []string{
+		h.newUser(t, "alice@example.com"),
+		h.newUser(t, "bob@example.com"),
+		h.newUser(t, "carol@example.com"),
+	}
+
+	h.useLimiter(t, 2, nil, nil, nil)
+
+	cfg := *h.app.config()
+	cfg.limter.credentialsBurst = 20
+	h.app.cfg.Store(&cfg)
+
+	// anonymous clients using up the address's limit don't affect its users
+	if got := h.allowed(t, 4, http.MethodGet, "/v1/healthcheck", ""); got != 2 {
+		t.Fatalf("anonymous: got %d requests allowed; want %d", got, 2)
+	}
+
+	// nor do the users' bursts, sent at once, affect each other
+	var wg sync.WaitGroup
+	var allowed atomic.Int32
+
+	for _, token := range tokens {
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(token string) {
+				defer wg.Done()
+
+				if code := h.do(t, http.MethodGet, "/v1/healthcheck", token, nil, nil); code == http.StatusOK {
+					allowed.Add(1)
+				}
+			}(token)
+		}
+	}
+
+	wg.Wait()
+
+	if got := allowed.Load(); got != 6 {
+		t.Errorf("users: got %d requests allowed; want %d", got, 6)
+	}
+}
+
+func TestLimiterPolicyInvalid(t *testing.T) {
+	tests := []struct {
+		name            string
+		tiers           []string
+		permissionTiers []string
+		routes          []string
+	}{
+		{"Malformed tier", []string{"auth:1"}, nil, nil},
+		{"Default tier", []string{"default:1:1"}, nil, nil},
+		{"Zero rps", []string{"auth:0:1"}, nil, nil},
+		{"Zero burst", []string{"auth:1:0"}, nil, nil},
+		{"Unknown permission tier", nil, []string{"movies:write=writer"}, nil},
+		{"Unknown route tier", nil, nil, []string{"/v1/tokens/*=auth"}},
+		{"Relative route", []string{"auth:1:1"}, nil, []string{"POST:v1/tokens=auth"}},
+		{"Lower case method", []string{"auth:1:1"}, nil, []string{"post:/v1/tokens=auth"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _, err := loadConfig(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cfg.limter.tiers, cfg.limter.permissionTiers, cfg.limter.routes = tt.tiers, tt.permissionTiers, tt.routes
+
+			if _, err := newLimiterPolicy(cfg); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
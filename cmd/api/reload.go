@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/jsonlogger"
+	"github.com/PriyanshuSharma23/greenlight/internal/validator"
+)
+
+// reloadableFlags lists the settings that reloadConfig applies to the running
+// server. Changes to anything else are reported but need a restart.
+var reloadableFlags = map[string]bool{
+	"log-level":                 true,
+	"limiter-rps":               true,
+	"limiter-burst":             true,
+	"limiter-credentials-rps":   true,
+	"limiter-credentials-burst": true,
+	"limiter-enabled":           true,
+	"limiter-tiers":             true,
+	"limiter-permission-tiers":  true,
+	"limiter-routes":            true,
+	"cors-trusted-origins":      true,
+	"cors-allowed-methods":      true,
+	"cors-allowed-headers":      true,
+	"cors-exposed-headers":      true,
+	"cors-credentials":          true,
+	"cors-max-age":              true,
+	"cors-routes":               true,
+	"smtp-host":                 true,
+	"smtp-port":                 true,
+	"smtp-username":             true,
+	"smtp-password":             true,
+	"smtp-sender":               true,
+	"smtp-retires":              true,
+	"mail-transport":            true,
+	"mail-dir":                  true,
+}
+
+func (app *application) config() *config {
+	return app.cfg.Load()
+}
+
+// reloadConfig re-reads the configuration from the same sources used at
+// startup and swaps in the runtime-safe parts. An invalid configuration is
+// rejected as a whole, leaving the running server untouched.
+func (app *application) reloadConfig() error {
+	next, fs, err := loadConfig(os.Args[1:])
+	if err != nil {
+		return fmt.Errorf("reload rejected: %w", err)
+	}
+
+	v := validator.New()
+	if validateConfig(v, next); !v.Valid() {
+		return fmt.Errorf("reload rejected: %w", configError(v))
+	}
+
+	level, err := jsonlogger.ParseLevel(next.logLevel)
+	if err != nil {
+		return fmt.Errorf("reload rejected: %w", err)
+	}
+
+	current := app.config()
+	settings := configSettings(fs)
+
+	changed := make(map[string]string)
+	var restart []string
+
+	for name, value := range settings {
+		old := app.settings[name]
+		if old == value {
+			continue
+		}
+
+		if !reloadableFlags[name] {
+			restart = append(restart, name)
+			continue
+		}
+
+		if secretFlags[name] {
+			changed[name] = "changed"
+		} else {
+			changed[name] = fmt.Sprintf("%q -> %q", old, value)
+		}
+	}
+
+	merged := *current
+	merged.logLevel = next.logLevel
+	merged.limter = next.limter
+	merged.cors = next.cors
+	merged.smtp = next.smtp
+	merged.mail = next.mail
+
+	if merged.smtp != current.smtp || merged.mail != current.mail {
+		m, err := newMailer(merged, app.logger)
+		if err != nil {
+			return fmt.Errorf("reload rejected: %w", err)
+		}
+
+		app.mailer.Store(&m)
+	}
+
+	app.logger.SetLevel(level)
+	app.cfg.Store(&merged)
+
+	// compare the next reload with what was read now, so that a change that
+	// needs a restart is only reported once
+	app.settings = settings
+
+	if len(restart) > 0 {
+		sort.Strings(restart)
+		changed["requires_restart"] = strings.Join(restart, ", ")
+	}
+
+	app.logger.PrintInfo("configuration reloaded", changed)
+
+	return nil
+}
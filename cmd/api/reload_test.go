@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/jsonlogger"
+)
+
+func TestReloadReportsRestartOnce(t *testing.T) {
+	h := newTestHarness(t)
+
+	var log bytes.Buffer
+	h.app.logger = jsonlogger.NewLogger(&log, jsonlogger.LevelInfo)
+
+	args := os.Args
+	os.Args = []string{"api"}
+	t.Cleanup(func() { os.Args = args })
+
+	t.Setenv("GREENLIGHT_DB_DSN", "postgres://localhost/greenlight")
+	t.Setenv("GREENLIGHT_PORT", "5000")
+
+	for i, want := range []bool{true, false} {
+		log.Reset()
+
+		if err := h.app.reloadConfig(); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := strings.Contains(log.String(), "requires_restart"); got != want {
+			t.Errorf("reload %d: got log %s", i+1, log.String())
+		}
+	}
+}
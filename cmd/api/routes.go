@@ -15,6 +15,8 @@ func (app *application) routes() http.Handler {
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/health/live", app.livenessHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/health/ready", app.readinessHandler)
 
 	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
@@ -24,12 +26,40 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/email", app.confirmEmailChangeHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/export", app.downloadExportHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", app.requireAuthentication(app.requireCurrentUser(app.showCurrentUserHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", app.requireActivatedUser(app.requireUserSession(app.updateCurrentUserHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", app.requireAuthentication(app.requireUserSession(app.deleteCurrentUserHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/password", app.requireAuthentication(app.requireUserSession(app.changePasswordHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/export", app.requireAuthentication(app.requireUserSession(app.requestExportHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/2fa", app.requireAuthentication(app.showTwoFactorHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/2fa", app.requireActivatedUser(app.requireUserSession(app.enrollTwoFactorHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/2fa", app.requireActivatedUser(app.requireUserSession(app.confirmTwoFactorHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/2fa", app.requireAuthentication(app.requireUserSession(app.disableTwoFactorHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/api-keys", app.requireAuthentication(app.requireUserSession(app.listAPIKeysHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/api-keys", app.requireActivatedUser(app.requireUserSession(app.createAPIKeyHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/api-keys/:id", app.requireAuthentication(app.requireUserSession(app.deleteAPIKeyHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/sessions", app.requireAuthentication(app.requireUserSession(app.listSessionsHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions/:id", app.requireAuthentication(app.requireUserSession(app.deleteSessionHandler)))
 
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication", app.requireAuthentication(app.requireUserSession(app.deleteAuthenticationTokenHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/2fa", app.createTwoFactorTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.refreshAuthenticationTokenHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/oauth/:provider/start", app.startOAuthHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/oauth/:provider/callback", app.oauthCallbackHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/emails", app.requirePermission("emails:manage", app.listEmailsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/emails/:id/retry", app.requirePermission("emails:manage", app.retryEmailHandler))
 
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
-	standard := alice.New(app.metrics, app.recoverPanic, app.enableCORS, app.rateLimiter, app.authenticate)
+	limits := newRateLimits()
+
+	standard := alice.New(app.metrics, app.recoverPanic, app.enableCORS, app.rateLimitAddress(limits), app.authenticate, app.rateLimitUser(limits))
 
 	return standard.Then(router)
 }
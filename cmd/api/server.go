@@ -14,7 +14,7 @@ import (
 
 func (app *application) serve() error {
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", app.config.port),
+		Addr:         fmt.Sprintf(":%d", app.config().port),
 		Handler:      app.routes(),
 		IdleTimeout:  time.Minute,
 		ErrorLog:     log.New(app.logger, "", 0),
@@ -24,12 +24,40 @@ func (app *application) serve() error {
 
 	shutdownError := make(chan error)
 
+	go (func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+
+		for range hup {
+			err := app.reloadConfig()
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{
+					"signal": syscall.SIGHUP.String(),
+				})
+			}
+		}
+	})()
+
 	go (func() {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
 		s := <-quit
 
+		app.health.draining.Store(true)
+
+		// keep serving until the readiness probes have seen that this instance
+		// is draining and taken it out of rotation, or a second signal
+		app.logger.PrintInfo("draining server", map[string]string{
+			"signal": s.String(),
+			"delay":  app.config().health.drainDelay.String(),
+		})
+
+		select {
+		case <-time.After(app.config().health.drainDelay):
+		case s = <-quit:
+		}
+
 		app.logger.PrintInfo("shutting down server", map[string]string{
 			"signal": s.String(),
 		})
@@ -37,16 +65,34 @@ func (app *application) serve() error {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		app.logger.PrintInfo("completing background tasks", map[string]string{
+		err := server.Shutdown(ctx)
+
+		app.logger.PrintInfo("completing background jobs", map[string]string{
 			"addr": server.Addr,
 		})
-		app.wg.Wait()
-		shutdownError <- server.Shutdown(ctx)
+
+		jobsCtx, jobsCancel := context.WithTimeout(context.Background(), app.config().jobs.drainTimeout)
+		defer jobsCancel()
+
+		jobsErr := app.jobs.Shutdown(jobsCtx)
+		if jobsErr != nil {
+			app.logger.PrintError(jobsErr, map[string]string{
+				"during": "background job drain",
+			})
+		}
+
+		app.logger.PrintInfo("stopping outbox workers", nil)
+		app.stopOutbox()
+
+		shutdownError <- err
 	})()
 
+	app.jobs.Start()
+	app.startOutbox()
+
 	app.logger.PrintInfo("starting server", map[string]string{
 		"addr": server.Addr,
-		"env":  app.config.env,
+		"env":  app.config().env,
 	})
 
 	err := server.ListenAndServe()
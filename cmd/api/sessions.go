@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+)
+
+// maxUserAgentLength caps the User-Agent header stored with a session.
+const maxUserAgentLength = 256
+
+// session is a login as shown to its user. It is described by the session's
+// current refresh token, whose id identifies it until the next refresh.
+type session struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Expiry     time.Time `json:"expiry"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+}
+
+func userAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = ua[:maxUserAgentLength]
+	}
+
+	return strings.ToValidUTF8(ua, "")
+}
+
+// sessions returns the user's live sessions, soonest to expire first.
+func (app *application) sessions(userID int64) ([]session, error) {
+	tokens, err := app.models.Tokens.GetAllForUser(userID, data.ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]session, len(tokens))
+
+	for i, t := range tokens {
+		sessions[i] = session{
+			ID:         t.ID,
+			CreatedAt:  t.CreatedAt,
+			LastUsedAt: t.LastUsedAt,
+			Expiry:     t.Expiry,
+			IP:         t.IP,
+			UserAgent:  t.UserAgent,
+		}
+	}
+
+	return sessions, nil
+}
+
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	sessions, err := app.sessions(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteSessionHandler logs a session out wherever it is being used, which in
+// the jwt auth mode also revokes the JWTs issued in it.
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Transaction(func(tx data.Models) error {
+		family, err := tx.Tokens.DeleteByID(int64(id), user.ID, data.ScopeRefresh)
+		if err != nil {
+			return err
+		}
+
+		return app.revokeSessionJWTs(tx, user.ID, family)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "session successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
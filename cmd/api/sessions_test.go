@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// listSessions returns the raw sessions of the user with the given token.
+func (h *testHarness) listSessions(t *testing.T, token string) []map[string]any {
+	t.Helper()
+
+	var res struct {
+		Sessions []map[string]any `json:"sessions"`
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/users/me/sessions", token, nil, &res); code != http.StatusOK {
+		t.Fatalf("list sessions: got status %d", code)
+	}
+
+	return res.Sessions
+}
+
+func TestSessions(t *testing.T) {
+	h := newTestHarness(t)
+	h.skipIfPostgres(t)
+
+	h.newUser(t, "alice@example.com")
+	h.newUser(t, "bob@example.com")
+	bob, _ := h.newSession(t, "bob@example.com", "pa55word")
+
+	// newUser already logged alice in once
+	laptop, laptopRefresh := h.newSession(t, "alice@example.com", "pa55word")
+	phone, _ := h.newSession(t, "alice@example.com", "pa55word")
+
+	sessions := h.listSessions(t, laptop)
+	if len(sessions) != 3 {
+		t.Fatalf("got %d sessions; want 3", len(sessions))
+	}
+
+	for _, s := range sessions {
+		if s["ip"] != "127.0.0.1" || s["user_agent"] == "" {
+			t.Errorf("got ip %v and user agent %v", s["ip"], s["user_agent"])
+		}
+		for _, key := range []string{"hash", "token"} {
+			if _, ok := s[key]; ok {
+				t.Errorf("session exposes %q", key)
+			}
+		}
+	}
+
+	// using a session is recorded on it, at most once a minute
+	h.clock.Advance(2 * time.Minute)
+
+	if code := h.do(t, http.MethodGet, "/v1/movies", phone, nil, nil); code != http.StatusOK {
+		t.Fatalf("use phone session: got status %d", code)
+	}
+
+	phoneSession := h.listSessions(t, laptop)[2]
+	if phoneSession["last_used_at"] == phoneSession["created_at"] {
+		t.Errorf("last_used_at not updated: %v", phoneSession)
+	}
+
+	// refreshing carries the session over under a new id
+	laptopSession := h.listSessions(t, laptop)[1]
+
+	code, laptop, _ := h.refresh(t, laptopRefresh)
+	if code != http.StatusCreated {
+		t.Fatalf("refresh: got status %d", code)
+	}
+
+	sessions = h.listSessions(t, laptop)
+	if len(sessions) != 3 {
+		t.Fatalf("got %d sessions after refresh; want 3", len(sessions))
+	}
+
+	refreshed := sessions[2]
+	if refreshed["created_at"] != laptopSession["created_at"] || refreshed["id"] == laptopSession["id"] {
+		t.Errorf("got %v after refreshing %v", refreshed, laptopSession)
+	}
+
+	path := fmt.Sprintf("/v1/users/me/sessions/%v", refreshed["id"])
+
+	if code := h.do(t, http.MethodDelete, path, bob, nil, nil); code != http.StatusNotFound {
+		t.Errorf("delete another user's session: got status %d; want %d", code, http.StatusNotFound)
+	}
+
+	if code := h.do(t, http.MethodDelete, path, phone, nil, nil); code != http.StatusOK {
+		t.Fatalf("delete session: got status %d; want %d", code, http.StatusOK)
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/movies", laptop, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("revoked session: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+
+	if code := h.do(t, http.MethodDelete, path, phone, nil, nil); code != http.StatusNotFound {
+		t.Errorf("delete session again: got status %d; want %d", code, http.StatusNotFound)
+	}
+
+	if got := len(h.listSessions(t, phone)); got != 2 {
+		t.Errorf("got %d sessions after revoking one; want 2", got)
+	}
+}
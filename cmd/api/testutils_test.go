@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+	"github.com/PriyanshuSharma23/greenlight/internal/jsonlogger"
+	"github.com/PriyanshuSharma23/greenlight/internal/migrate"
+	"github.com/PriyanshuSharma23/greenlight/migrations"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+	// every registration and login hashes a password, which at the real cost
+	// makes the tests take minutes
+	data.PasswordCost = bcrypt.MinCost
+
+	os.Exit(m.Run())
+}
+
+// testHarness runs the full application behind an httptest server. It uses
+// the in-memory store unless GREENLIGHT_TEST_DB_DSN is set, in which case
+// each harness migrates and later drops its own Postgres schema.
+type testHarness struct {
+	app      *application
+	server   *httptest.Server
+	mailbox  *testMailbox
+	clock    *testClock
+	postgres bool
+}
+
+func newTestHarness(t *testing.T) *testHarness {
+	t.Helper()
+
+	cfg, fs, err := loadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &testHarness{
+		mailbox: newTestMailbox(t),
+		clock:   &testClock{now: time.Now()},
+	}
+
+	cfg.limter.enabled = false
+	cfg.health.migrationVersion = 0
+	cfg.mail.transport = "smtp"
+	cfg.smtp.host, cfg.smtp.port = h.mailbox.host, h.mailbox.port
+	cfg.smtp.retries = 1
+	cfg.outbox.pollInterval = 10 * time.Millisecond
+	cfg.jobs.pollInterval = 10 * time.Millisecond
+	cfg.login.delayBase = 0
+
+	logger := jsonlogger.NewLogger(io.Discard, jsonlogger.LevelOff)
+
+	m, err := newMailer(cfg, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	models := h.newModels(t)
+
+	h.app = &application{
+		models:   models,
+		logger:   logger,
+		settings: configSettings(fs),
+		jobs:     newJobRunner(cfg, models.Jobs, logger),
+	}
+	h.app.cfg.Store(&cfg)
+	h.app.mailer.Store(&m)
+	h.app.registerJobs()
+
+	h.server = httptest.NewServer(h.app.routes())
+	h.app.jobs.Start()
+	h.app.startOutbox()
+
+	t.Cleanup(func() {
+		h.server.Close()
+		h.app.jobs.Shutdown(context.Background())
+		h.app.stopOutbox()
+	})
+
+	return h
+}
+
+func (h *testHarness) newModels(t *testing.T) data.Models {
+	dsn := os.Getenv("GREENLIGHT_TEST_DB_DSN")
+	if dsn == "" {
+		return data.NewMemoryModels(h.clock.Now)
+	}
+
+	h.postgres = true
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("postgres", withSearchPath(dsn, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	m, err := migrate.New(db, migrations.FS, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data.NewModels(db)
+}
+
+// withSearchPath points every connection at schema, keeping public on the
+// path for extensions such as citext.
+func withSearchPath(dsn, schema string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		q := u.Query()
+		q.Set("search_path", schema+",public")
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+
+	return dsn + " search_path='" + schema + ",public'"
+}
+
+// skipIfPostgres skips tests that rely on the fake clock, which only the
+// in-memory store honours.
+func (h *testHarness) skipIfPostgres(t *testing.T) {
+	if h.postgres {
+		t.Skip("requires the in-memory store")
+	}
+}
+
+// do sends body as JSON, authenticating with token when it isn't empty, and
+// decodes the JSON response into dst. It returns the status code.
+func (h *testHarness) do(t *testing.T, method, path, token string, body, dst any) int {
+	t.Helper()
+
+	var r io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequest(method, h.server.URL+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := h.server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if dst != nil {
+		err = json.NewDecoder(res.Body).Decode(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return res.StatusCode
+}
+
+func (h *testHarness) registerUser(t *testing.T, name, email, password string) int64 {
+	t.Helper()
+
+	body := map[string]string{"name": name, "email": email, "password": password}
+	if code := h.do(t, http.MethodPost, "/v1/users", "", body, nil); code != http.StatusAccepted {
+		t.Fatalf("register %s: got status %d", email, code)
+	}
+
+	// the response doesn't say whether an account was created, so look it up
+	user, err := h.app.models.Users.GetByEmail(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user.ID
+}
+
+var activationTokenRx = regexp.MustCompile(`"token":\s*"([A-Z2-7]{26})"`)
+
+// activationToken reads the token out of the welcome email sent to email.
+func (h *testHarness) activationToken(t *testing.T, email string) string {
+	t.Helper()
+
+	msg := h.mailbox.waitFor(t, email)
+
+	match := activationTokenRx.FindStringSubmatch(msg.PlainBody)
+	if match == nil {
+		t.Fatalf("no activation token in email to %s:\n%s", email, msg.PlainBody)
+	}
+
+	return match[1]
+}
+
+func (h *testHarness) activateUser(t *testing.T, email string) {
+	t.Helper()
+
+	body := map[string]string{"token": h.activationToken(t, email)}
+	if code := h.do(t, http.MethodPut, "/v1/users/activated", "", body, nil); code != http.StatusOK {
+		t.Fatalf("activate %s: got status %d", email, code)
+	}
+}
+
+func (h *testHarness) authenticate(t *testing.T, email, password string) string {
+	t.Helper()
+
+	var res struct {
+		AuthenticationToken struct{ Token string } `json:"authentication_token"`
+	}
+
+	body := map[string]string{"email": email, "password": password}
+	if code := h.do(t, http.MethodPost, "/v1/tokens/authentication", "", body, &res); code != http.StatusCreated {
+		t.Fatalf("authenticate %s: got status %d", email, code)
+	}
+
+	return res.AuthenticationToken.Token
+}
+
+// newUser registers, activates and authenticates a user with the given extra
+// permissions, returning its authentication token.
+func (h *testHarness) newUser(t *testing.T, email string, permissions ...string) string {
+	t.Helper()
+
+	id := h.registerUser(t, "Test User", email, "pa55word")
+	h.activateUser(t, email)
+
+	if len(permissions) > 0 {
+		err := h.app.models.Permissions.AddForUser(id, permissions...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return h.authenticate(t, email, "pa55word")
+}
+
+type testClock struct {
+	now time.Time
+	mu  sync.Mutex
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+type testEmail struct {
+	To        string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+}
+
+// testMailbox is a minimal SMTP server that accepts every message and keeps
+// it for inspection.
+type testMailbox struct {
+	host     string
+	messages []testEmail
+	received chan struct{}
+	port     int
+	mu       sync.Mutex
+	failing  atomic.Bool
+}
+
+func newTestMailbox(t *testing.T) *testMailbox {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	addr := ln.Addr().(*net.TCPAddr)
+
+	mb := &testMailbox{
+		host:     addr.IP.String(),
+		port:     addr.Port,
+		received: make(chan struct{}, 1),
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go mb.serve(conn)
+		}
+	}()
+
+	return mb
+}
+
+func (mb *testMailbox) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 localhost test mailbox")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(cmd, "RCPT") && mb.failing.Load():
+			reply("550 mailbox unavailable")
+
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 end data with <CR><LF>.<CR><LF>")
+
+			var raw bytes.Buffer
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				raw.WriteString(strings.TrimPrefix(line, "."))
+			}
+
+			mb.store(raw.Bytes())
+			reply("250 OK")
+
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (mb *testMailbox) store(raw []byte) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return
+	}
+
+	email := testEmail{
+		To:      msg.Header.Get("To"),
+		Subject: msg.Header.Get("Subject"),
+	}
+
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err == nil && params["boundary"] != "" {
+		mr := multipart.NewReader(msg.Body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+
+			body, _ := io.ReadAll(part)
+			if strings.HasPrefix(part.Header.Get("Content-Type"), "text/html") {
+				email.HTMLBody = string(body)
+			} else {
+				email.PlainBody = string(body)
+			}
+		}
+	}
+
+	mb.mu.Lock()
+	mb.messages = append(mb.messages, email)
+	mb.mu.Unlock()
+
+	select {
+	case mb.received <- struct{}{}:
+	default:
+	}
+}
+
+// waitFor returns the most recent message sent to recipient, waiting for it
+// to arrive when necessary.
+func (mb *testMailbox) waitFor(t *testing.T, recipient string) testEmail {
+	t.Helper()
+
+	return mb.waitForSubject(t, recipient, "")
+}
+
+// waitForSubject is like waitFor but only considers messages with the given
+// subject, unless subject is empty.
+func (mb *testMailbox) waitForSubject(t *testing.T, recipient, subject string) testEmail {
+	t.Helper()
+
+	deadline := time.After(5 * time.Second)
+
+	for {
+		mb.mu.Lock()
+		for i := len(mb.messages) - 1; i >= 0; i-- {
+			if mb.messages[i].To == recipient && (subject == "" || mb.messages[i].Subject == subject) {
+				msg := mb.messages[i]
+				mb.mu.Unlock()
+				return msg
+			}
+		}
+		mb.mu.Unlock()
+
+		select {
+		case <-mb.received:
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("no email %q sent to %s", subject, recipient)
+		}
+	}
+}
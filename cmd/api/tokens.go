@@ -3,16 +3,18 @@ package main
 import (
 	"errors"
 	"net/http"
-	"time"
+	"strconv"
 
 	"github.com/PriyanshuSharma23/greenlight/internal/data"
 	"github.com/PriyanshuSharma23/greenlight/internal/validator"
+	"github.com/tomasen/realip"
 )
 
 func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Cookie   bool   `json:"cookie"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -31,36 +33,273 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
+	ip := realip.FromRequest(r)
+
+	lockedFor, err := app.loginLockout(input.Email, ip)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if lockedFor > 0 {
+		app.loginLockedResponse(w, r, lockedFor)
+		return
+	}
+
 	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, data.ErrNoRecordFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	matches := false
+	if user != nil {
+		matches, err = user.Password.Matches(input.Password)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	} else {
+		data.SimulatePasswordCheck(input.Password)
+	}
+
+	if !matches {
+		delay, err := app.recordLoginFailure(input.Email, ip, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		sleepContext(r.Context(), delay)
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	app.completeLogin(w, r, user, input.Cookie)
+}
+
+// completeLogin finishes a sign-in once the user has shown who they are. With
+// two-factor authentication that only earns a short-lived token to exchange
+// for the real one along with a code, and failures keep counting until that's
+// done. The session is sent as cookies if useCookies is set.
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, user *data.User, useCookies bool) {
+	t, err := app.models.TwoFactor.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrNoRecordFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if t != nil && t.Confirmed {
+		token, err := app.models.Tokens.New(user.ID, app.config().twoFactor.pendingTTL, data.ScopeTwoFactor)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusAccepted, envelope{"two_factor_token": token}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Logins.Reset(data.LoginEmailKey(user.Email))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env, err := app.newSession(app.models, r, user, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeSession(w, r, http.StatusCreated, env, useCookies)
+}
+
+// newSession issues an authentication token and a refresh token for a request
+// from the user. They continue the session of prev, a rotated token, or start
+// a new one when prev is nil. In the jwt auth mode the authentication token is
+// a JWT, which isn't stored.
+func (app *application) newSession(models data.Models, r *http.Request, user *data.User, prev *data.Token) (envelope, error) {
+	session := &data.Token{UserID: user.ID, IP: realip.FromRequest(r), UserAgent: userAgent(r)}
+
+	if prev != nil {
+		session.Family, session.CreatedAt = prev.Family, prev.CreatedAt
+	} else {
+		family, err := data.NewTokenFamily()
+		if err != nil {
+			return nil, err
+		}
+		session.Family = family
+	}
+
+	cfg := app.config().auth
+
+	var token *data.Token
+	var err error
+
+	if app.jwtKeys != nil {
+		token, err = app.newJWT(models, user, session.Family)
+	} else {
+		token, err = models.Tokens.NewInSession(session, cfg.tokenTTL, data.ScopeAuthentication)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := models.Tokens.NewInSession(session, cfg.refreshTTL, data.ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	return envelope{"authentication_token": token, "refresh_token": refresh}, nil
+}
+
+// refreshAuthenticationTokenHandler rotates a refresh token: it is used up and
+// a new authentication and refresh token are issued in its family, so the
+// session lasts as long as it keeps being refreshed within -auth-refresh-ttl.
+// Presenting a refresh token that was already rotated means it has leaked,
+// so the whole family is revoked.
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if r.ContentLength != 0 {
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	// browser clients send the refresh cookie instead, which needs no CSRF
+	// token: refreshing changes nothing a forged request could read, and it's
+	// how a reloaded page gets its CSRF token back
+	useCookies := false
+	if input.RefreshToken == "" {
+		input.RefreshToken = app.cookieValue(r, refreshCookie)
+		useCookies = input.RefreshToken != ""
+	}
+
+	v := validator.New()
+	if data.ValidatePlaintextToken(v, input.RefreshToken); !v.Valid() {
+		app.failedValidationResponse(w, r, map[string]string{"refresh_token": v.Errors["token"]})
+		return
+	}
+
+	var (
+		old *data.Token
+		env envelope
+	)
+
+	err := app.models.Transaction(func(tx data.Models) error {
+		var err error
+
+		old, err = tx.Tokens.Rotate(input.RefreshToken, data.ScopeRefresh)
+		if err != nil {
+			return err
+		}
+
+		user, err := tx.Users.Get(old.UserID)
+		if err != nil {
+			return err
+		}
+
+		env, err = app.newSession(tx, r, user, old)
+		return err
+	})
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrTokenReused):
+			app.revokeTokenFamily(w, r, old)
 		case errors.Is(err, data.ErrNoRecordFound):
-			app.invalidCredentialsResponse(w, r)
+			v.AddError("refresh_token", "invalid or expired token")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
-
 		}
 		return
 	}
 
-	matches, err := user.Password.Matches(input.Password)
+	app.writeSession(w, r, http.StatusCreated, env, useCookies)
+}
+
+// revokeTokenFamily handles the reuse of a rotated refresh token by revoking
+// every token in its family, along with the user's JWTs since those can't be
+// told apart by family, and rejecting the request.
+func (app *application) revokeTokenFamily(w http.ResponseWriter, r *http.Request, token *data.Token) {
+	app.logger.PrintInfo("refresh token reused", map[string]string{
+		"user_id": strconv.FormatInt(token.UserID, 10),
+		"ip":      realip.FromRequest(r),
+	})
+
+	err := app.models.Tokens.DeleteFamily(token.Family)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	if !matches {
-		app.invalidCredentialsResponse(w, r)
+	err = app.revokeUserJWTs(app.models, token.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, time.Hour*24, data.ScopeAuthentication)
+	v := validator.New()
+	v.AddError("refresh_token", "invalid or expired token")
+	app.failedValidationResponse(w, r, v.Errors)
+}
+
+// deleteAuthenticationTokenHandler logs out. The token the request was made
+// with stops working straight away, along with the rest of its session. A JWT
+// is added to the revocation list instead, so its refresh token has to be
+// given in the body for the session to end.
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if r.ContentLength != 0 {
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	var err error
+
+	if claims := app.contextGetClaims(r); claims != nil {
+		err = app.revokeJWT(claims)
+	} else {
+		err = app.models.Tokens.Delete(user.ID, app.requestToken(r))
+	}
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if app.contextUsesCookies(r) {
+		if input.RefreshToken == "" {
+			input.RefreshToken = app.cookieValue(r, refreshCookie)
+		}
+		app.clearSessionCookies(w)
+	}
+
+	if input.RefreshToken != "" {
+		err = app.models.Tokens.Delete(user.ID, input.RefreshToken)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "successfully logged out"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
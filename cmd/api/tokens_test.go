@@ -0,0 +1,167 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+)
+
+// newSession logs in and returns the authentication and refresh tokens.
+func (h *testHarness) newSession(t *testing.T, email, password string) (string, string) {
+	t.Helper()
+
+	var res struct {
+		AuthenticationToken struct{ Token string } `json:"authentication_token"`
+		RefreshToken        struct{ Token string } `json:"refresh_token"`
+	}
+
+	body := map[string]string{"email": email, "password": password}
+	if code := h.do(t, http.MethodPost, "/v1/tokens/authentication", "", body, &res); code != http.StatusCreated {
+		t.Fatalf("authenticate %s: got status %d", email, code)
+	}
+
+	return res.AuthenticationToken.Token, res.RefreshToken.Token
+}
+
+// refresh exchanges a refresh token, returning the status code and the new
+// authentication and refresh tokens.
+func (h *testHarness) refresh(t *testing.T, token string) (int, string, string) {
+	t.Helper()
+
+	var res struct {
+		AuthenticationToken struct{ Token string } `json:"authentication_token"`
+		RefreshToken        struct{ Token string } `json:"refresh_token"`
+	}
+
+	code := h.do(t, http.MethodPost, "/v1/tokens/refresh", "", map[string]string{"refresh_token": token}, &res)
+
+	return code, res.AuthenticationToken.Token, res.RefreshToken.Token
+}
+
+func TestRefreshToken(t *testing.T) {
+	h := newTestHarness(t)
+	h.skipIfPostgres(t)
+
+	h.newUser(t, "alice@example.com")
+	access, refresh := h.newSession(t, "alice@example.com", "pa55word")
+
+	if refresh == "" {
+		t.Fatal("no refresh token issued at login")
+	}
+
+	// the session slides: each refresh lasts -auth-refresh-ttl from when it
+	// was issued, so a session kept in use outlives the first refresh token
+	ttl := h.app.config().auth.refreshTTL
+
+	h.clock.Advance(ttl * 2 / 3)
+
+	code, access2, refresh2 := h.refresh(t, refresh)
+	if code != http.StatusCreated || access2 == access || refresh2 == refresh {
+		t.Fatalf("refresh: got status %d", code)
+	}
+
+	h.clock.Advance(ttl * 2 / 3)
+
+	code, access3, refresh3 := h.refresh(t, refresh2)
+	if code != http.StatusCreated {
+		t.Fatalf("second refresh: got status %d; want %d", code, http.StatusCreated)
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/movies", access3, nil, nil); code != http.StatusOK {
+		t.Errorf("refreshed token: got status %d; want %d", code, http.StatusOK)
+	}
+
+	h.clock.Advance(ttl + time.Minute)
+
+	if code, _, _ := h.refresh(t, refresh3); code != http.StatusUnprocessableEntity {
+		t.Errorf("expired refresh token: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	h := newTestHarness(t)
+
+	h.newUser(t, "alice@example.com")
+	access, refresh := h.newSession(t, "alice@example.com", "pa55word")
+	other, otherRefresh := h.newSession(t, "alice@example.com", "pa55word")
+
+	code, access2, refresh2 := h.refresh(t, refresh)
+	if code != http.StatusCreated {
+		t.Fatalf("refresh: got status %d; want %d", code, http.StatusCreated)
+	}
+
+	// replaying the rotated token revokes every token in its family
+	if code, _, _ := h.refresh(t, refresh); code != http.StatusUnprocessableEntity {
+		t.Errorf("reused refresh token: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	if code, _, _ := h.refresh(t, refresh2); code != http.StatusUnprocessableEntity {
+		t.Errorf("refresh token rotated from the reused one: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	for _, token := range []string{access, access2} {
+		if code := h.do(t, http.MethodGet, "/v1/movies", token, nil, nil); code != http.StatusUnauthorized {
+			t.Errorf("authentication token in the family: got status %d; want %d", code, http.StatusUnauthorized)
+		}
+	}
+
+	// other sessions are left alone
+	if code := h.do(t, http.MethodGet, "/v1/movies", other, nil, nil); code != http.StatusOK {
+		t.Errorf("other session: got status %d; want %d", code, http.StatusOK)
+	}
+
+	if code, _, _ := h.refresh(t, otherRefresh); code != http.StatusCreated {
+		t.Errorf("other session refresh: got status %d; want %d", code, http.StatusCreated)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	h := newTestHarness(t)
+
+	h.newUser(t, "alice@example.com")
+	access, refresh := h.newSession(t, "alice@example.com", "pa55word")
+
+	if code := h.do(t, http.MethodDelete, "/v1/tokens/authentication", access, nil, nil); code != http.StatusOK {
+		t.Fatalf("logout: got status %d; want %d", code, http.StatusOK)
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/movies", access, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("after logout: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+
+	if code, _, _ := h.refresh(t, refresh); code != http.StatusUnprocessableEntity {
+		t.Errorf("refresh after logout: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestPasswordChangeRevokesRefreshTokens(t *testing.T) {
+	h := newTestHarness(t)
+
+	token := h.newUser(t, "alice@example.com")
+	_, refresh := h.newSession(t, "alice@example.com", "pa55word")
+
+	body := map[string]string{"current_password": "pa55word", "password": "n3wpa55word"}
+	if code := h.do(t, http.MethodPut, "/v1/users/me/password", token, body, nil); code != http.StatusOK {
+		t.Fatalf("change password: got status %d; want %d", code, http.StatusOK)
+	}
+
+	if code, _, _ := h.refresh(t, refresh); code != http.StatusUnprocessableEntity {
+		t.Errorf("refresh after password change: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	user, err := h.app.models.Users.GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := h.app.models.Tokens.GetAllForUser(user.ID, data.ScopeRefresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tokens) != 1 {
+		t.Errorf("got %d refresh tokens after password change; want 1", len(tokens))
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+	"github.com/PriyanshuSharma23/greenlight/internal/totp"
+	"github.com/PriyanshuSharma23/greenlight/internal/validator"
+	"github.com/tomasen/realip"
+)
+
+func (app *application) showTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	enabled := false
+
+	t, err := app.models.TwoFactor.Get(user.ID)
+	switch {
+	case err == nil:
+		enabled = t.Confirmed
+	case !errors.Is(err, data.ErrNoRecordFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	left, err := app.models.TwoFactor.RecoveryCodesLeft(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"two_factor": map[string]any{"enabled": enabled, "recovery_codes_left": left}}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// enrollTwoFactorHandler starts setting up an authenticator app. Logins aren't
+// affected until the enrollment is confirmed with a code, and starting again
+// before then replaces the secret.
+func (app *application) enrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.TwoFactor.Enroll(&data.TOTP{UserID: user.ID, Secret: secret})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.twoFactorEnabledResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{"two_factor": map[string]string{
+		"secret":           totp.EncodeSecret(secret),
+		"provisioning_uri": totp.URI(app.config().twoFactor.issuer, user.Email, secret),
+	}}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// confirmTwoFactorHandler enables two-factor authentication once the caller
+// shows a code from their app, and returns the recovery codes. This is the
+// only time the recovery codes can be seen.
+func (app *application) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(validator.NotBlank(input.Code), "code", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	t, err := app.models.TwoFactor.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if t.Confirmed {
+		app.twoFactorEnabledResponse(w, r)
+		return
+	}
+
+	step, ok := totp.Validate(t.Secret, input.Code, time.Now(), t.LastStep)
+	if !ok {
+		v.AddError("code", "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var codes []string
+
+	err = app.models.Transaction(func(tx data.Models) error {
+		err := tx.TwoFactor.UseStep(user.ID, step)
+		if err != nil {
+			return err
+		}
+
+		codes, err = tx.TwoFactor.NewRecoveryCodes(user.ID)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			v.AddError("code", "is incorrect")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(validator.NotBlank(input.Password), "password", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.confirmPassword(w, r, user, input.Password, "password") {
+		return
+	}
+
+	err = app.models.TwoFactor.Delete(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "two-factor authentication successfully disabled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createTwoFactorTokenHandler is the second step of logging in to an account
+// with two-factor authentication. It exchanges the 2fa-pending token issued
+// for a correct password, together with a code from the authenticator app or
+// a recovery code, for an authentication token. Wrong codes count towards
+// the login lockout like wrong passwords do.
+func (app *application) createTwoFactorTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+		Cookie         bool   `json:"cookie"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidatePlaintextToken(v, input.TokenPlaintext)
+	v.Check(input.Code != "" || input.RecoveryCode != "", "code", "must be provided")
+	v.Check(input.Code == "" || input.RecoveryCode == "", "recovery_code", "must not be provided together with code")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(input.TokenPlaintext, data.ScopeTwoFactor)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			v.AddError("token", "invalid or expired token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	ip := realip.FromRequest(r)
+
+	lockedFor, err := app.loginLockout(user.Email, ip)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if lockedFor > 0 {
+		app.loginLockedResponse(w, r, lockedFor)
+		return
+	}
+
+	ok, err := app.checkSecondFactor(user.ID, input.Code, input.RecoveryCode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !ok {
+		delay, err := app.recordLoginFailure(user.Email, ip, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		sleepContext(r.Context(), delay)
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	err = app.models.Logins.Reset(data.LoginEmailKey(user.Email))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var env envelope
+
+	err = app.models.Transaction(func(tx data.Models) error {
+		err := tx.Tokens.DeleteAllForUser(user.ID, data.ScopeTwoFactor)
+		if err != nil {
+			return err
+		}
+
+		env, err = app.newSession(tx, r, user, nil)
+		return err
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeSession(w, r, http.StatusCreated, env, input.Cookie)
+}
+
+// checkSecondFactor reports whether code, or else recoveryCode, is valid for
+// the user, using it up if so.
+func (app *application) checkSecondFactor(userID int64, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		err := app.models.TwoFactor.UseRecoveryCode(userID, recoveryCode)
+		switch {
+		case errors.Is(err, data.ErrNoRecordFound):
+			return false, nil
+		case err != nil:
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	t, err := app.models.TwoFactor.Get(userID)
+	switch {
+	case errors.Is(err, data.ErrNoRecordFound):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	step, ok := totp.Validate(t.Secret, code, time.Now(), t.LastStep)
+	if !ok || !t.Confirmed {
+		return false, nil
+	}
+
+	err = app.models.TwoFactor.UseStep(userID, step)
+	switch {
+	case errors.Is(err, data.ErrEditConflict):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/base32"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+	"github.com/PriyanshuSharma23/greenlight/internal/totp"
+)
+
+// enableTwoFactor enrolls and confirms an authenticator for the user with the
+// given token, returning its secret and the recovery codes.
+func (h *testHarness) enableTwoFactor(t *testing.T, token string) ([]byte, []string) {
+	t.Helper()
+
+	var enrolled struct {
+		TwoFactor struct {
+			Secret          string `json:"secret"`
+			ProvisioningURI string `json:"provisioning_uri"`
+		} `json:"two_factor"`
+	}
+
+	if code := h.do(t, http.MethodPost, "/v1/users/me/2fa", token, nil, &enrolled); code != http.StatusCreated {
+		t.Fatalf("enroll: got status %d", code)
+	}
+
+	if !strings.HasPrefix(enrolled.TwoFactor.ProvisioningURI, "otpauth://totp/Greenlight:") {
+		t.Errorf("got provisioning uri %q", enrolled.TwoFactor.ProvisioningURI)
+	}
+
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrolled.TwoFactor.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	body := map[string]string{"code": totp.Code(secret, time.Now())}
+	if code := h.do(t, http.MethodPut, "/v1/users/me/2fa", token, body, &confirmed); code != http.StatusOK {
+		t.Fatalf("confirm: got status %d", code)
+	}
+
+	return secret, confirmed.RecoveryCodes
+}
+
+// loginPending logs in with a password and returns the 2fa-pending token.
+func (h *testHarness) loginPending(t *testing.T, email, password string) string {
+	t.Helper()
+
+	var res struct {
+		TwoFactorToken struct{ Token string } `json:"two_factor_token"`
+	}
+
+	body := map[string]string{"email": email, "password": password}
+	if code := h.do(t, http.MethodPost, "/v1/tokens/authentication", "", body, &res); code != http.StatusAccepted {
+		t.Fatalf("login: got status %d; want %d", code, http.StatusAccepted)
+	}
+
+	return res.TwoFactorToken.Token
+}
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	h := newTestHarness(t)
+
+	token := h.newUser(t, "alice@example.com")
+
+	var enrolled struct {
+		TwoFactor struct{ Secret string } `json:"two_factor"`
+	}
+
+	if code := h.do(t, http.MethodPost, "/v1/users/me/2fa", token, nil, &enrolled); code != http.StatusCreated {
+		t.Fatalf("enroll: got status %d", code)
+	}
+
+	// an unconfirmed enrollment doesn't affect logins
+	h.authenticate(t, "alice@example.com", "pa55word")
+
+	body := map[string]string{"code": "000000"}
+	if code := h.do(t, http.MethodPut, "/v1/users/me/2fa", token, body, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("wrong code: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	secret, recoveryCodes := h.enableTwoFactor(t, token)
+
+	if len(recoveryCodes) != data.RecoveryCodeCount {
+		t.Errorf("got %d recovery codes; want %d", len(recoveryCodes), data.RecoveryCodeCount)
+	}
+
+	if code := h.do(t, http.MethodPost, "/v1/users/me/2fa", token, nil, nil); code != http.StatusConflict {
+		t.Errorf("enroll again: got status %d; want %d", code, http.StatusConflict)
+	}
+
+	body = map[string]string{"code": totp.Code(secret, time.Now().Add(totp.Period))}
+	if code := h.do(t, http.MethodPut, "/v1/users/me/2fa", token, body, nil); code != http.StatusConflict {
+		t.Errorf("confirm again: got status %d; want %d", code, http.StatusConflict)
+	}
+
+	var status struct {
+		TwoFactor struct {
+			Enabled           bool `json:"enabled"`
+			RecoveryCodesLeft int  `json:"recovery_codes_left"`
+		} `json:"two_factor"`
+	}
+
+	h.do(t, http.MethodGet, "/v1/users/me/2fa", token, nil, &status)
+	if !status.TwoFactor.Enabled || status.TwoFactor.RecoveryCodesLeft != data.RecoveryCodeCount {
+		t.Errorf("got status %+v", status.TwoFactor)
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	h := newTestHarness(t)
+
+	token := h.newUser(t, "alice@example.com")
+	secret, recoveryCodes := h.enableTwoFactor(t, token)
+
+	pending := h.loginPending(t, "alice@example.com", "pa55word")
+
+	// the pending token is no good as an authentication token
+	if code := h.do(t, http.MethodGet, "/v1/users/me", pending, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("pending token: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+
+	user, err := h.app.models.Users.GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enrollment, err := h.app.models.TwoFactor.Get(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the code used to confirm the enrollment can't be replayed
+	used := time.Unix(enrollment.LastStep*int64(totp.Period.Seconds()), 0)
+
+	body := map[string]string{"token": pending, "code": totp.Code(secret, used)}
+	if code := h.do(t, http.MethodPost, "/v1/tokens/2fa", "", body, nil); code != http.StatusUnauthorized {
+		t.Errorf("replayed code: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+
+	var res struct {
+		AuthenticationToken struct{ Token string } `json:"authentication_token"`
+	}
+
+	body["code"] = totp.Code(secret, time.Now().Add(totp.Period))
+	if code := h.do(t, http.MethodPost, "/v1/tokens/2fa", "", body, &res); code != http.StatusCreated {
+		t.Fatalf("valid code: got status %d; want %d", code, http.StatusCreated)
+	}
+
+	if code := h.do(t, http.MethodGet, "/v1/users/me", res.AuthenticationToken.Token, nil, nil); code != http.StatusOK {
+		t.Errorf("authentication token: got status %d; want %d", code, http.StatusOK)
+	}
+
+	// the pending token was used up
+	body["code"] = totp.Code(secret, time.Now().Add(-totp.Period))
+	if code := h.do(t, http.MethodPost, "/v1/tokens/2fa", "", body, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("used pending token: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	pending = h.loginPending(t, "alice@example.com", "pa55word")
+
+	body = map[string]string{"token": pending, "recovery_code": strings.ToLower(recoveryCodes[0])}
+	if code := h.do(t, http.MethodPost, "/v1/tokens/2fa", "", body, nil); code != http.StatusCreated {
+		t.Fatalf("recovery code: got status %d; want %d", code, http.StatusCreated)
+	}
+
+	pending = h.loginPending(t, "alice@example.com", "pa55word")
+
+	body = map[string]string{"token": pending, "recovery_code": recoveryCodes[0]}
+	if code := h.do(t, http.MethodPost, "/v1/tokens/2fa", "", body, nil); code != http.StatusUnauthorized {
+		t.Errorf("used recovery code: got status %d; want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestTwoFactorLockout(t *testing.T) {
+	h := newTestHarness(t)
+
+	token := h.newUser(t, "alice@example.com")
+	h.enableTwoFactor(t, token)
+
+	pending := h.loginPending(t, "alice@example.com", "pa55word")
+	body := map[string]string{"token": pending, "code": "000000"}
+
+	for i := 0; i < h.app.config().login.maxFailures; i++ {
+		if code := h.do(t, http.MethodPost, "/v1/tokens/2fa", "", body, nil); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: got status %d; want %d", i+1, code, http.StatusUnauthorized)
+		}
+	}
+
+	if code := h.do(t, http.MethodPost, "/v1/tokens/2fa", "", body, nil); code != http.StatusTooManyRequests {
+		t.Errorf("locked: got status %d; want %d", code, http.StatusTooManyRequests)
+	}
+}
+
+func TestTwoFactorDisable(t *testing.T) {
+	h := newTestHarness(t)
+
+	token := h.newUser(t, "alice@example.com")
+	h.enableTwoFactor(t, token)
+
+	body := map[string]string{"password": "wrong-password"}
+	if code := h.do(t, http.MethodDelete, "/v1/users/me/2fa", token, body, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("wrong password: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	body["password"] = "pa55word"
+	if code := h.do(t, http.MethodDelete, "/v1/users/me/2fa", token, body, nil); code != http.StatusOK {
+		t.Fatalf("disable: got status %d; want %d", code, http.StatusOK)
+	}
+
+	h.authenticate(t, "alice@example.com", "pa55word")
+
+	if code := h.do(t, http.MethodDelete, "/v1/users/me/2fa", token, body, nil); code != http.StatusNotFound {
+		t.Errorf("disable again: got status %d; want %d", code, http.StatusNotFound)
+	}
+}
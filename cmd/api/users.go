@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/PriyanshuSharma23/greenlight/internal/data"
+	"github.com/PriyanshuSharma23/greenlight/internal/mailer"
 	"github.com/PriyanshuSharma23/greenlight/internal/validator"
 )
 
@@ -14,6 +15,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Name     string `json:"name"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Locale   string `json:"locale"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -22,9 +24,14 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if input.Locale == "" {
+		input.Locale = mailer.MatchLocale(r.Header.Get("Accept-Language"))
+	}
+
 	user := &data.User{
 		Name:      input.Name,
 		Email:     input.Email,
+		Locale:    input.Locale,
 		Activated: false,
 	}
 
@@ -41,48 +48,76 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Users.Insert(user)
+	err = app.models.Transaction(func(tx data.Models) error {
+		err := tx.Users.Insert(user)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Permissions.AddForUser(user.ID, "movies:read")
+		if err != nil {
+			return err
+		}
+
+		token, err := tx.Tokens.New(user.ID, time.Hour*24*3, data.ScopeActivation)
+		if err != nil {
+			return err
+		}
+
+		return app.enqueueEmail(tx, user.Email, user.Locale, "user_welcome.tmpl", map[string]any{
+			"userID":          user.ID,
+			"activationToken": token.Plaintext,
+		})
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
-			v.AddError("email", "a user with this email already exists")
-			app.failedValidationResponse(w, r, v.Errors)
+			// answer exactly as for a new account so that registration can't be
+			// used to find out who has one, and let the owner know instead
+			err = app.notifyExistingAccount(input.Email)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
 		default:
 			app.serverErrorResponse(w, r, err)
+			return
 		}
-		return
 	}
 
-	err = app.models.Permissions.AddForUser(user.ID, "movies:read")
+	app.notifyOutbox()
+
+	env := envelope{"message": "registration received, check your email to continue"}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
-		return
 	}
+}
 
-	token, err := app.models.Tokens.New(user.ID, time.Hour*24*3, data.ScopeActivation)
+// notifyExistingAccount emails the owner of email about an attempt to register
+// it again. Accounts that were never activated get a fresh activation token,
+// which makes registering again a way to recover a lost one.
+func (app *application) notifyExistingAccount(email string) error {
+	user, err := app.models.Users.GetByEmail(email)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
+		return err
 	}
 
-	app.background(func() {
-		data := map[string]interface{}{
-			"userId":          user.ID,
-			"activationToken": token.Plaintext,
-		}
+	templateData := map[string]any{"activationToken": ""}
 
-		err := app.mailer.Send(user.Email, "user_welcome.tmpl", data)
-		if err != nil {
-			app.logger.PrintError(err, map[string]string{
-				"email": user.Email,
-			})
+	return app.models.Transaction(func(tx data.Models) error {
+		if !user.Activated {
+			token, err := tx.Tokens.New(user.ID, time.Hour*24*3, data.ScopeActivation)
+			if err != nil {
+				return err
+			}
+
+			templateData["activationToken"] = token.Plaintext
 		}
-	})
 
-	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user}, nil)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-	}
+		return app.enqueueEmail(tx, user.Email, user.Locale, "account_exists.tmpl", templateData)
+	})
 }
 
 func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegisterActivateAuthenticate(t *testing.T) {
+	h := newTestHarness(t)
+
+	h.registerUser(t, "Alice", "alice@example.com", "pa55word")
+
+	msg := h.mailbox.waitFor(t, "alice@example.com")
+	if msg.Subject != "Welcome to Greenlight" {
+		t.Errorf("got subject %q", msg.Subject)
+	}
+
+	body := map[string]string{"email": "alice@example.com", "password": "pa55word"}
+	token := h.authenticate(t, body["email"], body["password"])
+
+	// an inactive account can authenticate but not read movies
+	if code := h.do(t, http.MethodGet, "/v1/movies", token, nil, nil); code != http.StatusForbidden {
+		t.Errorf("inactive user: got status %d; want %d", code, http.StatusForbidden)
+	}
+
+	h.activateUser(t, "alice@example.com")
+
+	if code := h.do(t, http.MethodGet, "/v1/movies", token, nil, nil); code != http.StatusOK {
+		t.Errorf("activated user: got status %d; want %d", code, http.StatusOK)
+	}
+}
+
+func TestRegisterUserValidation(t *testing.T) {
+	h := newTestHarness(t)
+
+	h.registerUser(t, "Alice", "alice@example.com", "pa55word")
+
+	tests := []struct {
+		name     string
+		body     map[string]string
+		wantCode int
+		wantKey  string
+	}{
+		{"Short password", map[string]string{"name": "Bob", "email": "bob@example.com", "password": "pa55"}, http.StatusUnprocessableEntity, "password"},
+		{"Missing name", map[string]string{"email": "bob@example.com", "password": "pa55word"}, http.StatusUnprocessableEntity, "name"},
+		{"Invalid locale", map[string]string{"name": "Bob", "email": "bob@example.com", "password": "pa55word", "locale": "spanish"}, http.StatusUnprocessableEntity, "locale"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res struct{ Error map[string]string }
+
+			code := h.do(t, http.MethodPost, "/v1/users", "", tt.body, &res)
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+
+			if _, ok := res.Error[tt.wantKey]; !ok {
+				t.Errorf("got errors %v; want key %q", res.Error, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestRegisterExistingEmail(t *testing.T) {
+	h := newTestHarness(t)
+
+	register := func(email string) (int, string) {
+		t.Helper()
+
+		body := fmt.Sprintf(`{"name": "Bob", "email": %q, "password": "pa55word"}`, email)
+
+		res, err := h.server.Client().Post(h.server.URL+"/v1/users", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		b, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return res.StatusCode, string(b)
+	}
+
+	newCode, newBody := register("alice@example.com")
+	h.mailbox.waitForSubject(t, "alice@example.com", "Welcome to Greenlight")
+
+	existingCode, existingBody := register("alice@example.com")
+	if newCode != http.StatusAccepted || existingCode != newCode || existingBody != newBody {
+		t.Fatalf("new email got %d %s, existing got %d %s", newCode, newBody, existingCode, existingBody)
+	}
+
+	// an account that was never activated can be activated from the notice
+	msg := h.mailbox.waitForSubject(t, "alice@example.com", "You already have a Greenlight account")
+
+	match := activationTokenRx.FindStringSubmatch(msg.PlainBody)
+	if match == nil {
+		t.Fatalf("no activation token in notice:\n%s", msg.PlainBody)
+	}
+
+	body := map[string]string{"token": match[1]}
+	if code := h.do(t, http.MethodPut, "/v1/users/activated", "", body, nil); code != http.StatusOK {
+		t.Fatalf("activate from notice: got status %d", code)
+	}
+
+	user, err := h.app.models.Users.GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.Name != "Bob" {
+		t.Errorf("existing account was changed: got name %q", user.Name)
+	}
+
+	h.newUser(t, "carol@example.com")
+	register("carol@example.com")
+
+	msg = h.mailbox.waitForSubject(t, "carol@example.com", "You already have a Greenlight account")
+	if activationTokenRx.MatchString(msg.PlainBody) {
+		t.Errorf("notice to an activated account has an activation token:\n%s", msg.PlainBody)
+	}
+}
+
+func TestRegisterUserLocale(t *testing.T) {
+	h := newTestHarness(t)
+
+	tests := []struct {
+		name           string
+		locale         string
+		acceptLanguage string
+		wantLocale     string
+		wantSubject    string
+	}{
+		{"Default", "", "", "en", "Welcome to Greenlight"},
+		{"Explicit", "es", "en-US", "es", "Te damos la bienvenida a Greenlight"},
+		{"Accept-Language", "", "fr;q=0.9, es-MX, en;q=0.5", "es", "Te damos la bienvenida a Greenlight"},
+		{"Untranslated", "fr", "", "fr", "Welcome to Greenlight"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email := fmt.Sprintf("user%d@example.com", i)
+
+			body := map[string]string{"name": "User", "email": email, "password": "pa55word", "locale": tt.locale}
+			js, err := json.Marshal(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(http.MethodPost, h.server.URL+"/v1/users", bytes.NewReader(js))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+
+			res, err := h.server.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != http.StatusAccepted {
+				t.Fatalf("got status %d; want %d", res.StatusCode, http.StatusAccepted)
+			}
+
+			user, err := h.app.models.Users.GetByEmail(email)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if user.Locale != tt.wantLocale {
+				t.Errorf("got locale %q; want %q", user.Locale, tt.wantLocale)
+			}
+
+			if msg := h.mailbox.waitFor(t, email); msg.Subject != tt.wantSubject {
+				t.Errorf("got subject %q; want %q", msg.Subject, tt.wantSubject)
+			}
+		})
+	}
+}
+
+func TestActivationTokenSingleUse(t *testing.T) {
+	h := newTestHarness(t)
+
+	h.registerUser(t, "Alice", "alice@example.com", "pa55word")
+	token := h.activationToken(t, "alice@example.com")
+
+	body := map[string]string{"token": token}
+	if code := h.do(t, http.MethodPut, "/v1/users/activated", "", body, nil); code != http.StatusOK {
+		t.Fatalf("first activation: got status %d", code)
+	}
+
+	if code := h.do(t, http.MethodPut, "/v1/users/activated", "", body, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("second activation: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	h := newTestHarness(t)
+
+	h.registerUser(t, "Alice", "alice@example.com", "pa55word")
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		wantCode int
+	}{
+		{"Valid", "alice@example.com", "pa55word", http.StatusCreated},
+		{"Wrong password", "alice@example.com", "wrongpa55", http.StatusUnauthorized},
+		{"Unknown email", "bob@example.com", "pa55word", http.StatusUnauthorized},
+		{"Invalid email", "bob", "pa55word", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := map[string]string{"email": tt.email, "password": tt.password}
+
+			code := h.do(t, http.MethodPost, "/v1/tokens/authentication", "", body, nil)
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestAuthenticationTokenExpiry(t *testing.T) {
+	h := newTestHarness(t)
+	h.skipIfPostgres(t)
+
+	token := h.newUser(t, "alice@example.com")
+
+	if code := h.do(t, http.MethodGet, "/v1/movies", token, nil, nil); code != http.StatusOK {
+		t.Fatalf("fresh token: got status %d", code)
+	}
+
+	h.clock.Advance(25 * time.Hour)
+
+	var res struct{ Error string }
+	code := h.do(t, http.MethodGet, "/v1/movies", token, nil, &res)
+	if code != http.StatusUnauthorized || !strings.Contains(res.Error, "authentication token") {
+		t.Errorf("expired token: got status %d %q", code, res.Error)
+	}
+}
@@ -7,12 +7,14 @@ require github.com/julienschmidt/httprouter v1.3.0
 require github.com/lib/pq v1.10.9
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/felixge/httpsnoop v1.0.4
 	github.com/go-mail/mail/v2 v2.3.0
 	github.com/justinas/alice v1.2.0
 	github.com/tomasen/realip v0.0.0-20180522021738-f0c99a92ddce
 	golang.org/x/crypto v0.26.0
 	golang.org/x/time v0.6.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,274 @@
+// Package cors decides which cross-origin requests browsers may make, and
+// answers their preflight requests. A base policy applies to every route
+// unless a more specific route override matches the request path.
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy is what cross-origin requests to a set of routes may do. Origins are
+// exact ("https://example.com"), wildcards where * stands for one or more
+// host labels or a port ("https://*.example.com", "http://localhost:*"),
+// regular expressions matching the whole origin ("regexp:^https://pr-[0-9]+\.example\.com$"),
+// or "*" for any origin.
+type Policy struct {
+	Origins        []string
+	Methods        []string
+	AllowedHeaders []string
+	ExposedHeaders []string
+	Credentials    bool
+	MaxAge         time.Duration
+}
+
+// Route overrides the base policy for requests whose path is Path, or starts
+// with it if it ends in "*".
+type Route struct {
+	Path   string
+	Policy Policy
+}
+
+type compiled struct {
+	Policy
+	any      bool
+	exact    map[string]bool
+	patterns []*regexp.Regexp
+}
+
+type route struct {
+	path   string
+	prefix bool
+	policy *compiled
+}
+
+// Engine applies a base policy and route overrides to requests.
+type Engine struct {
+	base   *compiled
+	routes []route
+}
+
+var wildcardRX = regexp.MustCompile(`\\\*`)
+
+// New checks and compiles the policies.
+func New(base Policy, routes ...Route) (*Engine, error) {
+	e := &Engine{}
+
+	var err error
+
+	e.base, err = compile(base)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range routes {
+		if !strings.HasPrefix(r.Path, "/") {
+			return nil, fmt.Errorf("cors: route %q must start with /", r.Path)
+		}
+
+		p, err := compile(r.Policy)
+		if err != nil {
+			return nil, fmt.Errorf("%w (route %s)", err, r.Path)
+		}
+
+		path, prefix := strings.CutSuffix(r.Path, "*")
+		e.routes = append(e.routes, route{path: path, prefix: prefix, policy: p})
+	}
+
+	// the longest match wins, so try the most specific routes first
+	sort.SliceStable(e.routes, func(i, j int) bool {
+		return len(e.routes[i].path) > len(e.routes[j].path)
+	})
+
+	return e, nil
+}
+
+func compile(p Policy) (*compiled, error) {
+	c := &compiled{Policy: p, exact: make(map[string]bool)}
+
+	for _, origin := range p.Origins {
+		switch {
+		case origin == "*":
+			if p.Credentials {
+				return nil, fmt.Errorf(`cors: origin "*" can't be allowed credentials`)
+			}
+			c.any = true
+
+		case strings.HasPrefix(origin, "regexp:"):
+			rx, err := regexp.Compile(`^(?:` + strings.TrimPrefix(origin, "regexp:") + `)$`)
+			if err != nil {
+				return nil, fmt.Errorf("cors: origin %q: %w", origin, err)
+			}
+			c.patterns = append(c.patterns, rx)
+
+		default:
+			u, err := url.Parse(strings.ReplaceAll(origin, "*", "1"))
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+				return nil, fmt.Errorf("cors: origin %q must be a scheme and host", origin)
+			}
+
+			origin = strings.TrimSuffix(strings.ToLower(origin), "/")
+
+			if !strings.Contains(origin, "*") {
+				c.exact[origin] = true
+				continue
+			}
+
+			pattern := wildcardRX.ReplaceAllString(regexp.QuoteMeta(origin), `[a-z0-9-]+(?:\.[a-z0-9-]+)*`)
+			c.patterns = append(c.patterns, regexp.MustCompile(`^`+pattern+`$`))
+		}
+	}
+
+	for _, m := range p.Methods {
+		if m != strings.ToUpper(m) || m == "" {
+			return nil, fmt.Errorf("cors: method %q must be upper case", m)
+		}
+	}
+
+	if p.MaxAge < 0 {
+		return nil, fmt.Errorf("cors: max age must not be negative")
+	}
+
+	return c, nil
+}
+
+func (c *compiled) allows(origin string) bool {
+	if c.any || c.exact[origin] {
+		return true
+	}
+
+	for _, rx := range c.patterns {
+		if rx.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// policy returns the policy for a request path.
+func (e *Engine) policy(path string) *compiled {
+	for _, r := range e.routes {
+		if path == r.path || (r.prefix && strings.HasPrefix(path, r.path)) {
+			return r.policy
+		}
+	}
+
+	return e.base
+}
+
+// Allows reports whether a request to path from origin is allowed.
+func (e *Engine) Allows(path, origin string) bool {
+	return origin != "" && e.policy(path).allows(origin)
+}
+
+// Handle adds the CORS headers for r to w. It reports whether r was a
+// preflight request, which it has answered.
+func (e *Engine) Handle(w http.ResponseWriter, r *http.Request) bool {
+	h := w.Header()
+
+	h.Add("Vary", "Origin")
+
+	preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+	if preflight {
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+
+	p := e.policy(r.URL.Path)
+	if !p.allows(origin) {
+		return false
+	}
+
+	if p.any && !p.Credentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if p.Credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if !preflight {
+		if len(p.ExposedHeaders) > 0 {
+			h.Set("Access-Control-Expose-Headers", strings.Join(p.ExposedHeaders, ", "))
+		}
+		return false
+	}
+
+	if len(p.Methods) > 0 {
+		h.Set("Access-Control-Allow-Methods", strings.Join(p.Methods, ", "))
+	}
+
+	if len(p.AllowedHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(p.AllowedHeaders, ", "))
+	}
+
+	if p.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return true
+}
+
+// ParseRoute reads a route override written as the path followed by the
+// settings it changes from base, separated by semicolons:
+//
+//	/v1/tokens/*;origins=https://app.example.com;credentials=true;max-age=1h
+//
+// Lists are comma separated. The keys are origins, methods, allowed-headers,
+// exposed-headers, credentials and max-age.
+func ParseRoute(spec string, base Policy) (Route, error) {
+	parts := strings.Split(spec, ";")
+	r := Route{Path: parts[0], Policy: base}
+
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return r, fmt.Errorf("cors: route %s: %q must be key=value", r.Path, part)
+		}
+
+		var list []string
+		if value != "" {
+			list = strings.Split(value, ",")
+		}
+
+		var err error
+
+		switch key {
+		case "origins":
+			r.Policy.Origins = list
+		case "methods":
+			r.Policy.Methods = list
+		case "allowed-headers":
+			r.Policy.AllowedHeaders = list
+		case "exposed-headers":
+			r.Policy.ExposedHeaders = list
+		case "credentials":
+			r.Policy.Credentials, err = strconv.ParseBool(value)
+		case "max-age":
+			r.Policy.MaxAge, err = time.ParseDuration(value)
+		default:
+			return r, fmt.Errorf("cors: route %s: unknown setting %q", r.Path, key)
+		}
+		if err != nil {
+			return r, fmt.Errorf("cors: route %s: invalid %s: %w", r.Path, key, err)
+		}
+	}
+
+	return r, nil
+}
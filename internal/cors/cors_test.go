@@ -0,0 +1,218 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOrigins(t *testing.T) {
+	e, err := New(Policy{Origins: []string{
+		"https://example.com",
+		"https://*.example.org",
+		"http://localhost:*",
+		`regexp:https://pr-[0-9]+\.preview\.example\.net`,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://example.com", true},
+		{"http://example.com", false},
+		{"https://www.example.com", false},
+		{"https://app.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"https://evilexample.org", false},
+		{"https://app.example.org.evil.com", false},
+		{"http://localhost:9000", true},
+		{"http://localhost", false},
+		{"https://pr-42.preview.example.net", true},
+		{"https://pr-42.preview.example.net.evil.com", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := e.Allows("/v1/movies", tt.origin); got != tt.want {
+			t.Errorf("Allows(%q) = %t; want %t", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestInvalidPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+	}{
+		{"Any origin with credentials", Policy{Origins: []string{"*"}, Credentials: true}},
+		{"Origin with a path", Policy{Origins: []string{"https://example.com/app"}}},
+		{"Origin without a scheme", Policy{Origins: []string{"example.com"}}},
+		{"Invalid regexp", Policy{Origins: []string{"regexp:("}}},
+		{"Lower case method", Policy{Methods: []string{"get"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.policy); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	e, err := New(Policy{
+		Origins:        []string{"https://example.com"},
+		Methods:        []string{"GET", "POST"},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		ExposedHeaders: []string{"Retry-After"},
+		Credentials:    true,
+		MaxAge:         time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodOptions, "/v1/movies", nil)
+	r.Header.Set("Origin", "https://example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+	w := httptest.NewRecorder()
+
+	if !e.Handle(w, r) {
+		t.Fatal("preflight request wasn't answered")
+	}
+
+	want := map[string]string{
+		"Access-Control-Allow-Origin":      "https://example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST",
+		"Access-Control-Allow-Headers":     "Authorization, Content-Type",
+		"Access-Control-Max-Age":           "3600",
+	}
+
+	for name, value := range want {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("got %s %q; want %q", name, got, value)
+		}
+	}
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("got status %d; want %d", w.Code, http.StatusNoContent)
+	}
+
+	// the actual request only gets the exposed headers
+	r = httptest.NewRequest(http.MethodPost, "/v1/movies", nil)
+	r.Header.Set("Origin", "https://example.com")
+
+	w = httptest.NewRecorder()
+
+	if e.Handle(w, r) {
+		t.Fatal("actual request was answered")
+	}
+
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got != "Retry-After" {
+		t.Errorf("got Access-Control-Expose-Headers %q", got)
+	}
+
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "" {
+		t.Errorf("got Access-Control-Allow-Methods %q on an actual request", got)
+	}
+}
+
+func TestUntrustedOrigin(t *testing.T) {
+	e, err := New(Policy{Origins: []string{"https://example.com"}, Methods: []string{"GET"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodOptions, "/v1/movies", nil)
+	r.Header.Set("Origin", "https://evil.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+
+	w := httptest.NewRecorder()
+
+	if e.Handle(w, r) {
+		t.Error("preflight from an untrusted origin was answered")
+	}
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("got Access-Control-Allow-Origin %q", got)
+	}
+}
+
+func TestAnyOrigin(t *testing.T) {
+	e, err := New(Policy{Origins: []string{"*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/healthcheck", nil)
+	r.Header.Set("Origin", "https://anywhere.example")
+
+	w := httptest.NewRecorder()
+	e.Handle(w, r)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("got Access-Control-Allow-Origin %q; want %q", got, "*")
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	base := Policy{Origins: []string{"https://example.com"}, Methods: []string{"GET", "POST"}}
+
+	var routes []Route
+	for _, spec := range []string{
+		"/v1/healthcheck;origins=*",
+		"/v1/tokens/*;origins=https://login.example.com;credentials=true;max-age=1h",
+		"/v1/tokens/refresh;methods=POST",
+	} {
+		r, err := ParseRoute(spec, base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		routes = append(routes, r)
+	}
+
+	e, err := New(base, routes...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		origin string
+		want   bool
+	}{
+		{"/v1/movies", "https://example.com", true},
+		{"/v1/movies", "https://other.example", false},
+		{"/v1/healthcheck", "https://other.example", true},
+		{"/v1/healthcheck/more", "https://other.example", false},
+		{"/v1/tokens/authentication", "https://login.example.com", true},
+		{"/v1/tokens/authentication", "https://example.com", false},
+		// the longest match wins, and it inherits from the base policy
+		{"/v1/tokens/refresh", "https://example.com", true},
+		{"/v1/tokens/refresh", "https://login.example.com", false},
+	}
+
+	for _, tt := range tests {
+		if got := e.Allows(tt.path, tt.origin); got != tt.want {
+			t.Errorf("Allows(%q, %q) = %t; want %t", tt.path, tt.origin, got, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"/v1/tokens/*;credentials", "/v1/tokens/*;colour=blue", "/v1/tokens/*;max-age=soon"} {
+		if _, err := ParseRoute(spec, base); err == nil {
+			t.Errorf("ParseRoute(%q): got no error", spec)
+		}
+	}
+
+	if _, err := New(base, Route{Path: "v1/movies", Policy: base}); err == nil {
+		t.Error("relative route path: got no error")
+	}
+}
@@ -0,0 +1,239 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/validator"
+	"github.com/lib/pq"
+)
+
+// APIKeyPrefix starts every API key, so that keys can be told apart from
+// authentication tokens and spotted by secret scanners.
+const APIKeyPrefix = "glk_"
+
+// apiKeyTouchInterval limits how often using a key from the same IP address
+// writes its last used time.
+const apiKeyTouchInterval = time.Minute
+
+// APIKey is a long-lived credential for scripts and services. It acts as its
+// owner but only with the listed permissions. Like a Token, only the hash of
+// the key is stored, and Plaintext is set only when the key is created.
+type APIKey struct {
+	CreatedAt   time.Time   `json:"created_at"`
+	Expiry      *time.Time  `json:"expiry"`
+	LastUsedAt  *time.Time  `json:"last_used_at"`
+	Name        string      `json:"name"`
+	Plaintext   string      `json:"key,omitempty"`
+	Prefix      string      `json:"prefix"`
+	LastUsedIP  string      `json:"last_used_ip,omitempty"`
+	Permissions Permissions `json:"permissions"`
+	Hash        []byte      `json:"-"`
+	ID          int64       `json:"id"`
+	UserID      int64       `json:"-"`
+}
+
+// Expired reports whether the key has an expiry that has passed at now.
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.Expiry != nil && !k.Expiry.After(now)
+}
+
+func generateAPIKey(key *APIKey) error {
+	randomBytes := make([]byte, 20)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+
+	key.Plaintext = APIKeyPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	key.Prefix = key.Plaintext[:len(APIKeyPrefix)+6]
+	key.Hash = hashAPIKey(key.Plaintext)
+
+	return nil
+}
+
+func hashAPIKey(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+// IsAPIKey reports whether s looks like an API key rather than a token.
+func IsAPIKey(s string) bool {
+	return strings.HasPrefix(s, APIKeyPrefix)
+}
+
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.Check(validator.NotBlank(key.Name), "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(validator.Unique(key.Permissions), "permissions", "must not contain duplicate values")
+}
+
+func ValidatePlaintextAPIKey(v *validator.Validator, plaintext string) {
+	v.Check(IsAPIKey(plaintext), "key", "must start with "+APIKeyPrefix)
+	v.Check(len(plaintext) == len(APIKeyPrefix)+32, "key", "must be 36 bytes long")
+}
+
+type APIKeyModel struct {
+	DB DBTX
+}
+
+// New generates a key for key.UserID and stores it, setting key.Plaintext.
+func (m APIKeyModel) New(key *APIKey) error {
+	err := generateAPIKey(key)
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+          INSERT INTO api_keys (user_id, name, hash, prefix, permissions, expiry)
+          VALUES ($1, $2, $3, $4, $5, $6)
+          RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{key.UserID, key.Name, key.Hash, key.Prefix, pq.Array(key.Permissions), key.Expiry}
+	return m.DB.QueryRowContext(ctx, stmt, args...).Scan(&key.ID, &key.CreatedAt)
+}
+
+// GetAllForUser returns the user's keys, including expired ones, oldest
+// first.
+func (m APIKeyModel) GetAllForUser(userID int64) ([]*APIKey, error) {
+	stmt := `
+          SELECT id, created_at, user_id, name, prefix, permissions, expiry, last_used_at, last_used_ip
+          FROM api_keys
+          WHERE user_id = $1
+          ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]*APIKey, 0)
+
+	for rows.Next() {
+		var key APIKey
+
+		err := rows.Scan(
+			&key.ID,
+			&key.CreatedAt,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array(&key.Permissions),
+			&key.Expiry,
+			&key.LastUsedAt,
+			&key.LastUsedIP,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &key)
+	}
+
+	return keys, rows.Err()
+}
+
+// GetForKey returns the unexpired key with the given plaintext and its owner.
+func (m APIKeyModel) GetForKey(plaintext string) (*APIKey, *User, error) {
+	stmt := `
+          SELECT api_keys.id, api_keys.created_at, api_keys.user_id, api_keys.name, api_keys.prefix,
+            api_keys.permissions, api_keys.expiry, api_keys.last_used_at, api_keys.last_used_ip,
+            users.id, users.created_at, users.name, users.email, users.pending_email, users.locale,
+            users.password_hash, users.activated, users.version
+          FROM api_keys
+          INNER JOIN users ON users.id = api_keys.user_id
+          WHERE api_keys.hash = $1 AND (api_keys.expiry IS NULL OR api_keys.expiry > $2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var key APIKey
+	var user User
+
+	err := m.DB.QueryRowContext(ctx, stmt, hashAPIKey(plaintext), time.Now()).Scan(
+		&key.ID,
+		&key.CreatedAt,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Permissions),
+		&key.Expiry,
+		&key.LastUsedAt,
+		&key.LastUsedIP,
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.PendingEmail,
+		&user.Locale,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrNoRecordFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	return &key, &user, nil
+}
+
+// Touch records that the key was just used from ip. Repeated use from the
+// same address only writes once per apiKeyTouchInterval.
+func (m APIKeyModel) Touch(id int64, ip string) error {
+	stmt := `
+          UPDATE api_keys
+          SET last_used_at = NOW(), last_used_ip = $2
+          WHERE id = $1 AND (last_used_at IS NULL OR last_used_ip <> $2
+            OR last_used_at < NOW() - make_interval(secs => $3))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, id, ip, apiKeyTouchInterval.Seconds())
+	return err
+}
+
+// Delete removes the key if it belongs to the user.
+func (m APIKeyModel) Delete(id, userID int64) error {
+	stmt := `
+          DELETE FROM api_keys
+          WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRecordFound
+	}
+
+	return nil
+}
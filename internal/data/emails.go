@@ -0,0 +1,308 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	EmailPending = "pending"
+	EmailSent    = "sent"
+	EmailDead    = "dead"
+)
+
+// Email is a message waiting in, or delivered from, the outbox. Data holds
+// the template values, which may include tokens, so it is never rendered
+// to JSON.
+type Email struct {
+	CreatedAt     time.Time      `json:"created_at"`
+	NextAttemptAt time.Time      `json:"next_attempt_at"`
+	SentAt        *time.Time     `json:"sent_at,omitempty"`
+	Data          map[string]any `json:"-"`
+	Recipient     string         `json:"recipient"`
+	Template      string         `json:"template"`
+	Locale        string         `json:"locale"`
+	Status        string         `json:"status"`
+	LastError     string         `json:"last_error,omitempty"`
+	ID            int64          `json:"id"`
+	Attempts      int            `json:"attempts"`
+}
+
+type EmailModel struct {
+	DB DBTX
+}
+
+func (m EmailModel) Enqueue(email *Email) error {
+	js, err := json.Marshal(email.Data)
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+          INSERT INTO email_outbox (recipient, template, locale, data)
+          VALUES ($1, $2, $3, $4)
+          RETURNING id, created_at, status, next_attempt_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, stmt, email.Recipient, email.Template, email.Locale, js).Scan(
+		&email.ID,
+		&email.CreatedAt,
+		&email.Status,
+		&email.NextAttemptAt,
+	)
+}
+
+// ClaimNext leases the oldest due email to the caller by pushing its next
+// attempt past the lease. If the caller dies mid-delivery, the email becomes
+// due again once the lease runs out. ErrNoRecordFound means nothing is due.
+func (m EmailModel) ClaimNext(lease time.Duration) (*Email, error) {
+	stmt := `
+          UPDATE email_outbox
+          SET attempts = attempts + 1, next_attempt_at = $1
+          WHERE id = (
+            SELECT id FROM email_outbox
+            WHERE status = 'pending' AND next_attempt_at <= $2
+            ORDER BY next_attempt_at, id
+            LIMIT 1
+            FOR UPDATE SKIP LOCKED
+          )
+          RETURNING id, created_at, recipient, template, locale, data, status, attempts, next_attempt_at, last_error, sent_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	now := time.Now()
+
+	email, err := scanEmail(m.DB.QueryRowContext(ctx, stmt, now.Add(lease), now))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecordFound
+		}
+		return nil, err
+	}
+
+	return email, nil
+}
+
+// MarkSent records the delivery of an email and clears its data, which holds
+// the tokens it carried and isn't needed anymore.
+func (m EmailModel) MarkSent(id int64) error {
+	stmt := `
+          UPDATE email_outbox
+          SET status = 'sent', sent_at = NOW(), last_error = '', data = '{}'
+          WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, id)
+	return err
+}
+
+// MarkFailed records a failed attempt and schedules the next one after
+// retryIn, or moves the email to the dead letter state when dead is true.
+func (m EmailModel) MarkFailed(id int64, lastError string, retryIn time.Duration, dead bool) error {
+	status := EmailPending
+	if dead {
+		status = EmailDead
+	}
+
+	stmt := `
+          UPDATE email_outbox
+          SET status = $1, last_error = $2, next_attempt_at = $3
+          WHERE id = $4`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, status, lastError, time.Now().Add(retryIn), id)
+	return err
+}
+
+func (m EmailModel) GetAll(status string, f Filters) ([]*Email, Metadata, error) {
+	stmt := fmt.Sprintf(`
+          SELECT COUNT(*) OVER(), id, created_at, recipient, template, locale, data, status, attempts, next_attempt_at, last_error, sent_at
+          FROM email_outbox
+          WHERE (status = $1 OR $1 = '')
+          ORDER BY %s %s, id ASC
+          LIMIT $2 OFFSET $3`, f.sortColumn(), f.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, status, f.limit(), f.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+
+	emails := make([]*Email, 0)
+
+	for rows.Next() {
+		var (
+			email Email
+			data  []byte
+		)
+
+		err := rows.Scan(
+			&totalRecords,
+			&email.ID,
+			&email.CreatedAt,
+			&email.Recipient,
+			&email.Template,
+			&email.Locale,
+			&data,
+			&email.Status,
+			&email.Attempts,
+			&email.NextAttemptAt,
+			&email.LastError,
+			&email.SentAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		err = json.Unmarshal(data, &email.Data)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		emails = append(emails, &email)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return emails, calculateMetadata(totalRecords, f.Page, f.PageSize), nil
+}
+
+// Retry puts a dead or pending email back at the front of the queue with a
+// fresh attempt count. Sent emails are not resent.
+func (m EmailModel) Retry(id int64) (*Email, error) {
+	stmt := `
+          UPDATE email_outbox
+          SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+          WHERE id = $1 AND status <> 'sent'
+          RETURNING id, created_at, recipient, template, locale, data, status, attempts, next_attempt_at, last_error, sent_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	email, err := scanEmail(m.DB.QueryRowContext(ctx, stmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecordFound
+		}
+		return nil, err
+	}
+
+	return email, nil
+}
+
+// DeleteDead removes dead emails queued more than retention ago, along with
+// the tokens in their data. Until then they can be retried.
+func (m EmailModel) DeleteDead(retention time.Duration) error {
+	stmt := `
+          DELETE FROM email_outbox
+          WHERE status = 'dead' AND created_at <= $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, time.Now().Add(-retention))
+	return err
+}
+
+func scanEmail(row *sql.Row) (*Email, error) {
+	var (
+		email Email
+		data  []byte
+	)
+
+	err := row.Scan(
+		&email.ID,
+		&email.CreatedAt,
+		&email.Recipient,
+		&email.Template,
+		&email.Locale,
+		&data,
+		&email.Status,
+		&email.Attempts,
+		&email.NextAttemptAt,
+		&email.LastError,
+		&email.SentAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &email.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &email, nil
+}
+
+// GetAllForRecipient returns every outbox email addressed to recipient,
+// oldest first.
+func (m EmailModel) GetAllForRecipient(recipient string) ([]*Email, error) {
+	stmt := `
+          SELECT id, created_at, recipient, template, locale, data, status, attempts, next_attempt_at, last_error, sent_at
+          FROM email_outbox
+          WHERE recipient = $1
+          ORDER BY created_at, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, recipient)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := make([]*Email, 0)
+
+	for rows.Next() {
+		var (
+			email Email
+			data  []byte
+		)
+
+		err := rows.Scan(
+			&email.ID,
+			&email.CreatedAt,
+			&email.Recipient,
+			&email.Template,
+			&email.Locale,
+			&data,
+			&email.Status,
+			&email.Attempts,
+			&email.NextAttemptAt,
+			&email.LastError,
+			&email.SentAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(data, &email.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		emails = append(emails, &email)
+	}
+
+	return emails, rows.Err()
+}
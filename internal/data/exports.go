@@ -0,0 +1,99 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	ExportJSON = "json"
+	ExportZIP  = "zip"
+)
+
+// Export is a generated archive of a user's personal data, kept until its
+// expiry so that it can be downloaded with a ScopeExport token.
+type Export struct {
+	CreatedAt time.Time
+	Expiry    time.Time
+	Format    string
+	Content   []byte
+	ID        int64
+	UserID    int64
+}
+
+type ExportModel struct {
+	DB DBTX
+}
+
+func (m ExportModel) Insert(export *Export, ttl time.Duration) error {
+	stmt := `
+          INSERT INTO data_exports (user_id, format, content, expiry)
+          VALUES ($1, $2, $3, $4)
+          RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	export.Expiry = time.Now().Add(ttl)
+
+	args := []any{export.UserID, export.Format, export.Content, export.Expiry}
+	return m.DB.QueryRowContext(ctx, stmt, args...).Scan(&export.ID, &export.CreatedAt)
+}
+
+// GetForUser returns the user's newest export that hasn't expired.
+func (m ExportModel) GetForUser(userID int64) (*Export, error) {
+	stmt := `
+          SELECT id, created_at, user_id, format, content, expiry
+          FROM data_exports
+          WHERE user_id = $1 AND expiry > $2
+          ORDER BY created_at DESC, id DESC
+          LIMIT 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var export Export
+
+	err := m.DB.QueryRowContext(ctx, stmt, userID, time.Now()).Scan(
+		&export.ID,
+		&export.CreatedAt,
+		&export.UserID,
+		&export.Format,
+		&export.Content,
+		&export.Expiry,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecordFound
+		}
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+func (m ExportModel) DeleteAllForUser(userID int64) error {
+	stmt := `
+          DELETE FROM data_exports
+          WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, userID)
+	return err
+}
+
+func (m ExportModel) DeleteExpired() error {
+	stmt := `
+          DELETE FROM data_exports
+          WHERE expiry <= $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, time.Now())
+	return err
+}
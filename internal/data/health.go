@@ -0,0 +1,37 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type HealthModel struct {
+	DB *sql.DB
+}
+
+func (m HealthModel) Ping(ctx context.Context) error {
+	return m.DB.PingContext(ctx)
+}
+
+// MigrationVersion reports the schema version recorded by the migration tool
+// and whether the last migration was left half-applied.
+func (m HealthModel) MigrationVersion(ctx context.Context) (int64, bool, error) {
+	stmt := `SELECT version, dirty FROM schema_migrations LIMIT 1`
+
+	var (
+		version int64
+		dirty   bool
+	)
+
+	err := m.DB.QueryRowContext(ctx, stmt).Scan(&version, &dirty)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, ErrNoRecordFound
+		}
+
+		return 0, false, err
+	}
+
+	return version, dirty, nil
+}
@@ -0,0 +1,204 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Identity links an account at an external identity provider to a user.
+type Identity struct {
+	CreatedAt time.Time `json:"created_at"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	UserID    int64     `json:"-"`
+}
+
+// OAuthState is what a sign-in with an identity provider needs to remember
+// between sending the user there and their return: the PKCE verifier and
+// nonce. It is found by the state parameter, which is only stored hashed.
+type OAuthState struct {
+	Expiry    time.Time
+	Plaintext string
+	Provider  string
+	Verifier  string
+	Nonce     string
+	Hash      []byte
+}
+
+// NewOAuthState returns a state for a sign-in with provider, with a random
+// state, verifier and nonce.
+func NewOAuthState(provider string, ttl time.Duration) (*OAuthState, error) {
+	values := make([]string, 3)
+
+	for i := range values {
+		b := make([]byte, 32)
+
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	hash := sha256.Sum256([]byte(values[0]))
+
+	return &OAuthState{
+		Expiry:    time.Now().Add(ttl),
+		Plaintext: values[0],
+		Provider:  provider,
+		Verifier:  values[1],
+		Nonce:     values[2],
+		Hash:      hash[:],
+	}, nil
+}
+
+type IdentityModel struct {
+	DB DBTX
+}
+
+func (m IdentityModel) Insert(identity *Identity) error {
+	stmt := `
+          INSERT INTO user_identities (provider, subject, user_id, email)
+          VALUES ($1, $2, $3, $4)
+          RETURNING created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{identity.Provider, identity.Subject, identity.UserID, identity.Email}
+
+	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(&identity.CreatedAt)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `violates unique constraint "user_identities_pkey"`):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetUser returns the user the provider's subject is linked to.
+func (m IdentityModel) GetUser(provider, subject string) (*User, error) {
+	stmt := `
+          SELECT users.id, users.created_at, users.name, users.email, users.pending_email, users.locale,
+            users.password_hash, users.activated, users.version
+          FROM users
+          INNER JOIN user_identities ON user_identities.user_id = users.id
+          WHERE user_identities.provider = $1 AND user_identities.subject = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var user User
+
+	err := m.DB.QueryRowContext(ctx, stmt, provider, subject).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.PendingEmail,
+		&user.Locale,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// GetAllForUser returns the identities linked to the user, oldest first.
+func (m IdentityModel) GetAllForUser(userID int64) ([]*Identity, error) {
+	stmt := `
+          SELECT provider, subject, user_id, email, created_at
+          FROM user_identities
+          WHERE user_id = $1
+          ORDER BY created_at, provider`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := make([]*Identity, 0)
+
+	for rows.Next() {
+		var identity Identity
+
+		err := rows.Scan(&identity.Provider, &identity.Subject, &identity.UserID, &identity.Email, &identity.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, &identity)
+	}
+
+	return identities, rows.Err()
+}
+
+// InsertState stores a sign-in in progress, clearing out abandoned ones.
+func (m IdentityModel) InsertState(state *OAuthState) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM oauth_states WHERE expiry <= $1`, time.Now())
+	if err != nil {
+		return err
+	}
+
+	stmt := `
+          INSERT INTO oauth_states (hash, provider, verifier, nonce, expiry)
+          VALUES ($1, $2, $3, $4, $5)`
+
+	_, err = m.DB.ExecContext(ctx, stmt, state.Hash, state.Provider, state.Verifier, state.Nonce, state.Expiry)
+	return err
+}
+
+// TakeState deletes and returns the unexpired sign-in with the given state
+// parameter, so that each can only be completed once.
+func (m IdentityModel) TakeState(plaintext, provider string) (*OAuthState, error) {
+	stmt := `
+          DELETE FROM oauth_states
+          WHERE hash = $1 AND provider = $2 AND expiry > $3
+          RETURNING verifier, nonce, expiry`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	hash := sha256.Sum256([]byte(plaintext))
+	state := OAuthState{Plaintext: plaintext, Provider: provider, Hash: hash[:]}
+
+	err := m.DB.QueryRowContext(ctx, stmt, state.Hash, provider, time.Now()).Scan(&state.Verifier, &state.Nonce, &state.Expiry)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &state, nil
+}
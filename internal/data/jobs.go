@@ -0,0 +1,131 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	JobPending = "pending"
+	JobDone    = "done"
+	JobDead    = "dead"
+)
+
+type Job struct {
+	CreatedAt  time.Time
+	RunAt      time.Time
+	FinishedAt *time.Time
+	Payload    json.RawMessage
+	Type       string
+	Status     string
+	LastError  string
+	ID         int64
+	Attempts   int
+}
+
+type JobModel struct {
+	DB DBTX
+}
+
+func (m JobModel) Insert(job *Job) error {
+	stmt := `
+          INSERT INTO jobs (type, payload)
+          VALUES ($1, $2)
+          RETURNING id, created_at, status, run_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, stmt, job.Type, []byte(job.Payload)).Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.Status,
+		&job.RunAt,
+	)
+}
+
+// Claim leases the oldest due job of one of the given types, skipping rows
+// locked by other instances. ErrNoRecordFound means nothing is due.
+func (m JobModel) Claim(types []string, lease time.Duration) (*Job, error) {
+	stmt := `
+          UPDATE jobs
+          SET attempts = attempts + 1, run_at = $1
+          WHERE id = (
+            SELECT id FROM jobs
+            WHERE status = 'pending' AND run_at <= $2 AND type = ANY($3)
+            ORDER BY run_at, id
+            LIMIT 1
+            FOR UPDATE SKIP LOCKED
+          )
+          RETURNING id, created_at, type, payload, status, attempts, run_at, last_error, finished_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	now := time.Now()
+
+	var (
+		job     Job
+		payload []byte
+	)
+
+	err := m.DB.QueryRowContext(ctx, stmt, now.Add(lease), now, pq.Array(types)).Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.Type,
+		&payload,
+		&job.Status,
+		&job.Attempts,
+		&job.RunAt,
+		&job.LastError,
+		&job.FinishedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecordFound
+		}
+		return nil, err
+	}
+
+	job.Payload = payload
+
+	return &job, nil
+}
+
+func (m JobModel) Complete(id int64) error {
+	stmt := `
+          UPDATE jobs
+          SET status = 'done', finished_at = NOW(), last_error = ''
+          WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, id)
+	return err
+}
+
+// Fail records a failed attempt and schedules the next one after retryIn,
+// or gives up on the job when dead is true.
+func (m JobModel) Fail(id int64, lastError string, retryIn time.Duration, dead bool) error {
+	status := JobPending
+	if dead {
+		status = JobDead
+	}
+
+	stmt := `
+          UPDATE jobs
+          SET status = $1, last_error = $2, run_at = $3
+          WHERE id = $4`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, status, lastError, time.Now().Add(retryIn), id)
+	return err
+}
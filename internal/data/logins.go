@@ -0,0 +1,111 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// LoginAttempt counts recent failed logins for a key, which identifies either
+// an email address or a client IP. LockedFor is how much of a lockout is
+// left, zero when the key isn't locked.
+type LoginAttempt struct {
+	Key       string
+	Failures  int
+	LockedFor time.Duration
+}
+
+func LoginEmailKey(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+func LoginIPKey(ip string) string {
+	return "ip:" + ip
+}
+
+type LoginAttemptModel struct {
+	DB DBTX
+}
+
+func (m LoginAttemptModel) Get(key string) (*LoginAttempt, error) {
+	stmt := `
+          SELECT failures, COALESCE(GREATEST(EXTRACT(EPOCH FROM locked_until - NOW()), 0), 0)
+          FROM login_attempts
+          WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	attempt := LoginAttempt{Key: key}
+
+	var lockedFor float64
+
+	err := m.DB.QueryRowContext(ctx, stmt, key).Scan(&attempt.Failures, &lockedFor)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	attempt.LockedFor = time.Duration(lockedFor * float64(time.Second))
+
+	return &attempt, nil
+}
+
+// RecordFailure counts a failed login for key. Failures older than window are
+// forgotten, so the count starts again from one.
+func (m LoginAttemptModel) RecordFailure(key string, window time.Duration) (*LoginAttempt, error) {
+	stmt := `
+          INSERT INTO login_attempts (key, failures, last_failure_at)
+          VALUES ($1, 1, NOW())
+          ON CONFLICT (key) DO UPDATE SET
+            failures = CASE
+              WHEN login_attempts.last_failure_at < NOW() - make_interval(secs => $2) THEN 1
+              ELSE login_attempts.failures + 1
+            END,
+            last_failure_at = NOW()
+          RETURNING failures, COALESCE(GREATEST(EXTRACT(EPOCH FROM locked_until - NOW()), 0), 0)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	attempt := LoginAttempt{Key: key}
+
+	var lockedFor float64
+
+	err := m.DB.QueryRowContext(ctx, stmt, key, window.Seconds()).Scan(&attempt.Failures, &lockedFor)
+	if err != nil {
+		return nil, err
+	}
+
+	attempt.LockedFor = time.Duration(lockedFor * float64(time.Second))
+
+	return &attempt, nil
+}
+
+// Lock refuses logins for key for the duration d.
+func (m LoginAttemptModel) Lock(key string, d time.Duration) error {
+	stmt := `
+          UPDATE login_attempts
+          SET locked_until = NOW() + make_interval(secs => $2)
+          WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, key, d.Seconds())
+	return err
+}
+
+// Reset forgets the failures recorded for key after a successful login.
+func (m LoginAttemptModel) Reset(key string) error {
+	stmt := `
+          DELETE FROM login_attempts
+          WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, key)
+	return err
+}
@@ -0,0 +1,1615 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// memoryStore keeps every table in maps guarded by a single lock, mirroring
+// the Postgres schema closely enough for the HTTP API to be exercised
+// without a database.
+type memoryStore struct {
+	*memoryTables
+	mu *sync.RWMutex
+}
+
+type memoryTables struct {
+	movies      map[int]Movie
+	users       map[int64]User
+	tokens      map[string]Token
+	userPerms   map[int64]map[string]bool
+	emails      map[int64]Email
+	jobs        map[int64]Job
+	exports     map[int64]Export
+	logins      map[string]memoryLogin
+	totp        map[int64]TOTP
+	recovery    map[string]int64
+	apiKeys     map[int64]APIKey
+	revocations []Revocation
+	identities  map[string]Identity
+	oauthStates map[string]OAuthState
+	tiers       map[int64]string
+	permissions Permissions
+	now         func() time.Time
+	nextMovieID int
+	nextUserID  int64
+	nextEmailID int64
+	nextJobID   int64
+	nextExport  int64
+	nextAPIKey  int64
+	nextTokenID int64
+}
+
+// NewMemoryModels returns Models backed by an in-memory store. It is meant for
+// tests and local experiments; nothing is persisted. The store reads the
+// current time from now, which defaults to time.Now when nil.
+func NewMemoryModels(now func() time.Time) Models {
+	if now == nil {
+		now = time.Now
+	}
+
+	s := &memoryStore{
+		memoryTables: &memoryTables{
+			now:         now,
+			movies:      make(map[int]Movie),
+			users:       make(map[int64]User),
+			tokens:      make(map[string]Token),
+			userPerms:   make(map[int64]map[string]bool),
+			emails:      make(map[int64]Email),
+			jobs:        make(map[int64]Job),
+			exports:     make(map[int64]Export),
+			logins:      make(map[string]memoryLogin),
+			totp:        make(map[int64]TOTP),
+			recovery:    make(map[string]int64),
+			apiKeys:     make(map[int64]APIKey),
+			identities:  make(map[string]Identity),
+			oauthStates: make(map[string]OAuthState),
+			tiers:       make(map[int64]string),
+			permissions: Permissions{"emails:manage", "movies:read", "movies:write"},
+		},
+		mu: &sync.RWMutex{},
+	}
+
+	return s.models()
+}
+
+func (s *memoryStore) models() Models {
+	m := Models{
+		Movies:      memoryMovies{s},
+		Permissions: memoryPermissions{s},
+		Users:       memoryUsers{s},
+		Tokens:      memoryTokens{s},
+		Emails:      memoryEmails{s},
+		Jobs:        memoryJobs{s},
+		Exports:     memoryExports{s},
+		Logins:      memoryLogins{s},
+		TwoFactor:   memoryTwoFactor{s},
+		APIKeys:     memoryAPIKeys{s},
+		Revocations: memoryRevocations{s},
+		Identities:  memoryIdentities{s},
+		RateLimits:  memoryRateLimits{s},
+		Health:      memoryHealth{},
+	}
+
+	m.transaction = s.transaction
+
+	return m
+}
+
+// transaction holds the store's lock while fn runs, so that it is isolated
+// from other writers, and restores a snapshot of the tables when fn fails. fn
+// gets Models on the same tables under a lock of their own; using the store's
+// other Models from fn would deadlock.
+func (s *memoryStore) transaction(fn func(Models) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.clone()
+
+	tx := &memoryStore{memoryTables: s.memoryTables, mu: &sync.RWMutex{}}
+
+	err := fn(tx.models())
+	if err != nil {
+		*s.memoryTables = *snapshot
+	}
+
+	return err
+}
+
+func (s *memoryTables) clone() *memoryTables {
+	c := *s
+
+	c.movies = make(map[int]Movie, len(s.movies))
+	c.users = make(map[int64]User, len(s.users))
+	c.tokens = make(map[string]Token, len(s.tokens))
+	c.userPerms = make(map[int64]map[string]bool, len(s.userPerms))
+	c.emails = make(map[int64]Email, len(s.emails))
+	c.jobs = make(map[int64]Job, len(s.jobs))
+	c.exports = make(map[int64]Export, len(s.exports))
+	c.logins = make(map[string]memoryLogin, len(s.logins))
+	c.totp = make(map[int64]TOTP, len(s.totp))
+	c.recovery = make(map[string]int64, len(s.recovery))
+	c.apiKeys = make(map[int64]APIKey, len(s.apiKeys))
+	c.revocations = append([]Revocation(nil), s.revocations...)
+	c.identities = make(map[string]Identity, len(s.identities))
+	c.oauthStates = make(map[string]OAuthState, len(s.oauthStates))
+	c.tiers = make(map[int64]string, len(s.tiers))
+
+	for k, v := range s.movies {
+		c.movies[k] = v
+	}
+	for k, v := range s.users {
+		c.users[k] = v
+	}
+	for k, v := range s.tokens {
+		c.tokens[k] = v
+	}
+	for k, v := range s.identities {
+		c.identities[k] = v
+	}
+	for k, v := range s.oauthStates {
+		c.oauthStates[k] = v
+	}
+	for k, v := range s.tiers {
+		c.tiers[k] = v
+	}
+	for k, v := range s.userPerms {
+		c.userPerms[k] = make(map[string]bool, len(v))
+		for code := range v {
+			c.userPerms[k][code] = true
+		}
+	}
+	for k, v := range s.emails {
+		c.emails[k] = v
+	}
+	for k, v := range s.jobs {
+		c.jobs[k] = v
+	}
+	for k, v := range s.exports {
+		c.exports[k] = v
+	}
+	for k, v := range s.logins {
+		c.logins[k] = v
+	}
+	for k, v := range s.totp {
+		c.totp[k] = v
+	}
+	for k, v := range s.recovery {
+		c.recovery[k] = v
+	}
+	for k, v := range s.apiKeys {
+		c.apiKeys[k] = v
+	}
+
+	return &c
+}
+
+type memoryMovies struct{ s *memoryStore }
+
+func copyMovie(m Movie) *Movie {
+	m.Genres = append([]string(nil), m.Genres...)
+	return &m
+}
+
+func (m memoryMovies) Insert(mov *Movie) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	m.s.nextMovieID++
+
+	mov.ID = m.s.nextMovieID
+	mov.CreatedAt = m.s.now().Truncate(time.Second)
+	mov.Version = 1
+
+	m.s.movies[mov.ID] = *copyMovie(*mov)
+
+	return nil
+}
+
+func (m memoryMovies) Get(id int) (*Movie, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	movie, ok := m.s.movies[id]
+	if !ok {
+		return nil, ErrNoRecordFound
+	}
+
+	return copyMovie(movie), nil
+}
+
+func (m memoryMovies) Update(mov *Movie) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	stored, ok := m.s.movies[mov.ID]
+	if !ok || stored.Version != mov.Version {
+		return ErrEditConflict
+	}
+
+	mov.Version++
+	m.s.movies[mov.ID] = *copyMovie(*mov)
+
+	return nil
+}
+
+func (m memoryMovies) Delete(id int) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.movies[id]; !ok {
+		return ErrNoRecordFound
+	}
+
+	delete(m.s.movies, id)
+
+	return nil
+}
+
+func (m memoryMovies) GetAll(title string, genres []string, f Filters) ([]*Movie, Metadata, error) {
+	m.s.mu.RLock()
+
+	query := searchTerms(title)
+
+	var matches []*Movie
+	for _, movie := range m.s.movies {
+		if !containsAll(searchTerms(movie.Title), query) || !containsAll(movie.Genres, genres) {
+			continue
+		}
+		matches = append(matches, copyMovie(movie))
+	}
+
+	m.s.mu.RUnlock()
+
+	column, desc := f.sortColumn(), f.sortDirection() == "DESC"
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+
+		var c int
+		switch column {
+		case "title":
+			c = strings.Compare(a.Title, b.Title)
+		case "year":
+			c = a.Year - b.Year
+		case "runtime":
+			c = int(a.Runtime - b.Runtime)
+		default:
+			c = a.ID - b.ID
+		}
+
+		if c == 0 {
+			return a.ID < b.ID
+		}
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	return paginate(matches, f)
+}
+
+type memoryUsers struct{ s *memoryStore }
+
+func copyUser(u User) *User {
+	u.Password = password{hash: append([]byte(nil), u.Password.hash...)}
+	return &u
+}
+
+func (m memoryUsers) Insert(user *User) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for _, u := range m.s.users {
+		if strings.EqualFold(u.Email, user.Email) {
+			return ErrDuplicateEmail
+		}
+	}
+
+	m.s.nextUserID++
+
+	user.ID = m.s.nextUserID
+	user.CreatedAt = m.s.now().Truncate(time.Second)
+	user.Version = 1
+
+	m.s.users[user.ID] = *copyUser(*user)
+
+	return nil
+}
+
+func (m memoryUsers) Get(id int64) (*User, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	u, ok := m.s.users[id]
+	if !ok {
+		return nil, ErrNoRecordFound
+	}
+
+	return copyUser(u), nil
+}
+
+func (m memoryUsers) GetByEmail(email string) (*User, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	for _, u := range m.s.users {
+		if strings.EqualFold(u.Email, email) {
+			return copyUser(u), nil
+		}
+	}
+
+	return nil, ErrNoRecordFound
+}
+
+func (m memoryUsers) GetAll(search string, f Filters) ([]*User, Metadata, error) {
+	m.s.mu.RLock()
+
+	search = strings.ToLower(search)
+
+	var matches []*User
+	for _, u := range m.s.users {
+		if strings.Contains(strings.ToLower(u.Name), search) || strings.Contains(strings.ToLower(u.Email), search) {
+			matches = append(matches, copyUser(u))
+		}
+	}
+
+	m.s.mu.RUnlock()
+
+	column, desc := f.sortColumn(), f.sortDirection() == "DESC"
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+
+		var c int
+		switch column {
+		case "name":
+			c = strings.Compare(a.Name, b.Name)
+		case "email":
+			c = strings.Compare(strings.ToLower(a.Email), strings.ToLower(b.Email))
+		case "created_at":
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		default:
+			c = int(a.ID - b.ID)
+		}
+
+		if c == 0 {
+			return a.ID < b.ID
+		}
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	return paginate(matches, f)
+}
+
+func (m memoryUsers) GetForToken(tokenPlaintext, scope string) (*User, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	token, ok := m.s.tokens[string(hash[:])]
+	if !ok || token.Scope != scope || !token.Expiry.After(m.s.now()) {
+		return nil, ErrNoRecordFound
+	}
+
+	user, ok := m.s.users[token.UserID]
+	if !ok {
+		return nil, ErrNoRecordFound
+	}
+
+	return copyUser(user), nil
+}
+
+func (m memoryUsers) UpdateUser(user *User) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	stored, ok := m.s.users[user.ID]
+	if !ok || stored.Version != user.Version {
+		return ErrEditConflict
+	}
+
+	for _, u := range m.s.users {
+		if u.ID != user.ID && strings.EqualFold(u.Email, user.Email) {
+			return ErrDuplicateEmail
+		}
+	}
+
+	user.Version++
+	m.s.users[user.ID] = *copyUser(*user)
+
+	return nil
+}
+
+func (m memoryUsers) Delete(id int64) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.users[id]; !ok {
+		return ErrNoRecordFound
+	}
+
+	delete(m.s.users, id)
+	delete(m.s.userPerms, id)
+	delete(m.s.totp, id)
+
+	for hash, userID := range m.s.recovery {
+		if userID == id {
+			delete(m.s.recovery, hash)
+		}
+	}
+
+	for kid, key := range m.s.apiKeys {
+		if key.UserID == id {
+			delete(m.s.apiKeys, kid)
+		}
+	}
+
+	for k, identity := range m.s.identities {
+		if identity.UserID == id {
+			delete(m.s.identities, k)
+		}
+	}
+
+	delete(m.s.tiers, id)
+
+	for eid, export := range m.s.exports {
+		if export.UserID == id {
+			delete(m.s.exports, eid)
+		}
+	}
+
+	for hash, token := range m.s.tokens {
+		if token.UserID == id {
+			delete(m.s.tokens, hash)
+		}
+	}
+
+	return nil
+}
+
+type memoryPermissions struct{ s *memoryStore }
+
+func (m memoryPermissions) GetAllForUser(userID int64) (Permissions, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	var permissions Permissions
+	for _, code := range m.s.permissions {
+		if m.s.userPerms[userID][code] {
+			permissions = append(permissions, code)
+		}
+	}
+
+	return permissions, nil
+}
+
+func (m memoryPermissions) AddForUser(userID int64, codes ...string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.users[userID]; !ok {
+		return ErrNoRecordFound
+	}
+
+	if m.s.userPerms[userID] == nil {
+		m.s.userPerms[userID] = make(map[string]bool)
+	}
+
+	for _, code := range codes {
+		if m.s.permissions.Include(code) {
+			m.s.userPerms[userID][code] = true
+		}
+	}
+
+	return nil
+}
+
+func (m memoryPermissions) RemoveForUser(userID int64, codes ...string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for _, code := range codes {
+		delete(m.s.userPerms[userID], code)
+	}
+
+	return nil
+}
+
+func (m memoryPermissions) GetAll() (Permissions, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	permissions := append(Permissions(nil), m.s.permissions...)
+	sort.Strings(permissions)
+
+	return permissions, nil
+}
+
+type memoryTokens struct{ s *memoryStore }
+
+func (m memoryTokens) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.s.now()
+	token.Expiry = now.Add(ttl)
+	token.CreatedAt, token.LastUsedAt = now.Truncate(time.Second), now.Truncate(time.Second)
+
+	err = m.Insert(token)
+	return token, err
+}
+
+func (m memoryTokens) NewInSession(session *Token, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(session.UserID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.s.now()
+	token.Expiry = now.Add(ttl)
+	token.CreatedAt, token.LastUsedAt = now.Truncate(time.Second), now.Truncate(time.Second)
+
+	inheritSession(token, session)
+
+	err = m.Insert(token)
+	return token, err
+}
+
+func (m memoryTokens) Insert(token *Token) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.users[token.UserID]; !ok {
+		return ErrNoRecordFound
+	}
+
+	m.s.nextTokenID++
+	token.ID = m.s.nextTokenID
+
+	stored := *token
+	stored.Plaintext = ""
+	m.s.tokens[string(token.Hash)] = stored
+
+	return nil
+}
+
+func (m memoryTokens) Touch(tokenPlaintext, ip, userAgent string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	used, ok := m.s.tokens[string(hash[:])]
+	if !ok {
+		return nil
+	}
+
+	now := m.s.now()
+
+	for key, token := range m.s.tokens {
+		inSession := key == string(hash[:]) || (used.Family != nil && bytes.Equal(token.Family, used.Family))
+		if !inSession || token.Rotated {
+			continue
+		}
+
+		if token.IP != ip || token.LastUsedAt.Before(now.Add(-tokenTouchInterval)) {
+			token.LastUsedAt, token.IP, token.UserAgent = now.Truncate(time.Second), ip, userAgent
+			m.s.tokens[key] = token
+		}
+	}
+
+	return nil
+}
+
+func (m memoryTokens) TouchFamily(family []byte, ip, userAgent string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	now := m.s.now()
+
+	for key, token := range m.s.tokens {
+		if token.Family == nil || !bytes.Equal(token.Family, family) || token.Rotated {
+			continue
+		}
+
+		if token.IP != ip || token.LastUsedAt.Before(now.Add(-tokenTouchInterval)) {
+			token.LastUsedAt, token.IP, token.UserAgent = now.Truncate(time.Second), ip, userAgent
+			m.s.tokens[key] = token
+		}
+	}
+
+	return nil
+}
+
+func (m memoryTokens) DeleteAllForUser(userID int64, scope string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for key, token := range m.s.tokens {
+		if token.UserID == userID && token.Scope == scope {
+			delete(m.s.tokens, key)
+		}
+	}
+
+	return nil
+}
+
+func (m memoryTokens) Delete(userID int64, tokenPlaintext string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	token, ok := m.s.tokens[string(hash[:])]
+	if !ok || token.UserID != userID {
+		return nil
+	}
+
+	delete(m.s.tokens, string(hash[:]))
+
+	if token.Family != nil {
+		m.deleteFamily(token.Family)
+	}
+
+	return nil
+}
+
+func (m memoryTokens) DeleteByID(id, userID int64, scope string) ([]byte, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for key, token := range m.s.tokens {
+		if token.ID != id {
+			continue
+		}
+
+		if token.UserID != userID || token.Scope != scope || token.Rotated || !token.Expiry.After(m.s.now()) {
+			return nil, ErrNoRecordFound
+		}
+
+		delete(m.s.tokens, key)
+
+		if token.Family != nil {
+			m.deleteFamily(token.Family)
+		}
+
+		return token.Family, nil
+	}
+
+	return nil, ErrNoRecordFound
+}
+
+func (m memoryTokens) DeleteFamily(family []byte) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	m.deleteFamily(family)
+
+	return nil
+}
+
+func (m memoryTokens) deleteFamily(family []byte) {
+	for key, token := range m.s.tokens {
+		if bytes.Equal(token.Family, family) {
+			delete(m.s.tokens, key)
+		}
+	}
+}
+
+func (m memoryTokens) Rotate(tokenPlaintext, scope string) (*Token, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	token, ok := m.s.tokens[string(hash[:])]
+	if !ok || token.Scope != scope || !token.Expiry.After(m.s.now()) {
+		return nil, ErrNoRecordFound
+	}
+
+	if token.Rotated {
+		return &token, ErrTokenReused
+	}
+
+	token.Rotated = true
+	m.s.tokens[string(hash[:])] = token
+
+	return &token, nil
+}
+
+func (m memoryTokens) DeleteAllScopesForUser(userID int64) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for key, token := range m.s.tokens {
+		if token.UserID == userID {
+			delete(m.s.tokens, key)
+		}
+	}
+
+	return nil
+}
+
+func (m memoryTokens) GetAllForUser(userID int64, scope string) ([]*Token, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	now := m.s.now()
+
+	tokens := make([]*Token, 0)
+	for _, token := range m.s.tokens {
+		if token.UserID == userID && token.Scope == scope && token.Expiry.After(now) && !token.Rotated {
+			t := token
+			t.Hash = append([]byte(nil), token.Hash...)
+			tokens = append(tokens, &t)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].Expiry.Equal(tokens[j].Expiry) {
+			return tokens[i].Expiry.Before(tokens[j].Expiry)
+		}
+		return tokens[i].ID < tokens[j].ID
+	})
+
+	return tokens, nil
+}
+
+type memoryEmails struct{ s *memoryStore }
+
+func (m memoryEmails) Enqueue(email *Email) error {
+	// round-trip through JSON like the jsonb column does
+	js, err := json.Marshal(email.Data)
+	if err != nil {
+		return err
+	}
+
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	m.s.nextEmailID++
+
+	stored := *email
+	stored.ID = m.s.nextEmailID
+	stored.CreatedAt = m.s.now().Truncate(time.Second)
+	stored.NextAttemptAt = m.s.now()
+	stored.Status = EmailPending
+
+	err = json.Unmarshal(js, &stored.Data)
+	if err != nil {
+		return err
+	}
+
+	m.s.emails[stored.ID] = stored
+
+	email.ID, email.CreatedAt, email.NextAttemptAt, email.Status = stored.ID, stored.CreatedAt, stored.NextAttemptAt, stored.Status
+
+	return nil
+}
+
+func (m memoryEmails) ClaimNext(lease time.Duration) (*Email, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	now := m.s.now()
+
+	var next *Email
+	for _, email := range m.s.emails {
+		if email.Status != EmailPending || email.NextAttemptAt.After(now) {
+			continue
+		}
+
+		if next == nil || email.NextAttemptAt.Before(next.NextAttemptAt) ||
+			(email.NextAttemptAt.Equal(next.NextAttemptAt) && email.ID < next.ID) {
+			e := email
+			next = &e
+		}
+	}
+
+	if next == nil {
+		return nil, ErrNoRecordFound
+	}
+
+	next.Attempts++
+	next.NextAttemptAt = now.Add(lease)
+	m.s.emails[next.ID] = *next
+
+	return next, nil
+}
+
+func (m memoryEmails) MarkSent(id int64) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	email, ok := m.s.emails[id]
+	if !ok {
+		return nil
+	}
+
+	sentAt := m.s.now().Truncate(time.Second)
+	email.Status, email.SentAt, email.LastError, email.Data = EmailSent, &sentAt, "", map[string]any{}
+	m.s.emails[id] = email
+
+	return nil
+}
+
+func (m memoryEmails) MarkFailed(id int64, lastError string, retryIn time.Duration, dead bool) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	email, ok := m.s.emails[id]
+	if !ok {
+		return nil
+	}
+
+	email.Status = EmailPending
+	if dead {
+		email.Status = EmailDead
+	}
+	email.LastError, email.NextAttemptAt = lastError, m.s.now().Add(retryIn)
+	m.s.emails[id] = email
+
+	return nil
+}
+
+func (m memoryEmails) GetAll(status string, f Filters) ([]*Email, Metadata, error) {
+	m.s.mu.RLock()
+
+	var matches []*Email
+	for _, email := range m.s.emails {
+		if status == "" || email.Status == status {
+			e := email
+			matches = append(matches, &e)
+		}
+	}
+
+	m.s.mu.RUnlock()
+
+	desc := f.sortDirection() == "DESC"
+
+	// ids grow with created_at, so both sort columns order the same way
+	sort.Slice(matches, func(i, j int) bool {
+		if desc {
+			return matches[i].ID > matches[j].ID
+		}
+		return matches[i].ID < matches[j].ID
+	})
+
+	return paginate(matches, f)
+}
+
+func (m memoryEmails) GetAllForRecipient(recipient string) ([]*Email, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	emails := make([]*Email, 0)
+	for _, email := range m.s.emails {
+		if email.Recipient == recipient {
+			e := email
+			emails = append(emails, &e)
+		}
+	}
+
+	sort.Slice(emails, func(i, j int) bool { return emails[i].ID < emails[j].ID })
+
+	return emails, nil
+}
+
+func (m memoryEmails) Retry(id int64) (*Email, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	email, ok := m.s.emails[id]
+	if !ok || email.Status == EmailSent {
+		return nil, ErrNoRecordFound
+	}
+
+	email.Status, email.Attempts, email.NextAttemptAt = EmailPending, 0, m.s.now()
+	m.s.emails[id] = email
+
+	return &email, nil
+}
+
+func (m memoryEmails) DeleteDead(retention time.Duration) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	cutoff := m.s.now().Add(-retention)
+
+	for id, email := range m.s.emails {
+		if email.Status == EmailDead && !email.CreatedAt.After(cutoff) {
+			delete(m.s.emails, id)
+		}
+	}
+
+	return nil
+}
+
+type memoryExports struct{ s *memoryStore }
+
+func (m memoryExports) Insert(export *Export, ttl time.Duration) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.users[export.UserID]; !ok {
+		return ErrNoRecordFound
+	}
+
+	m.s.nextExport++
+
+	export.ID = m.s.nextExport
+	export.CreatedAt = m.s.now().Truncate(time.Second)
+	export.Expiry = m.s.now().Add(ttl)
+
+	stored := *export
+	stored.Content = append([]byte(nil), export.Content...)
+	m.s.exports[export.ID] = stored
+
+	return nil
+}
+
+func (m memoryExports) GetForUser(userID int64) (*Export, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	now := m.s.now()
+
+	var latest *Export
+	for _, export := range m.s.exports {
+		if export.UserID != userID || !export.Expiry.After(now) {
+			continue
+		}
+
+		if latest == nil || export.ID > latest.ID {
+			e := export
+			latest = &e
+		}
+	}
+
+	if latest == nil {
+		return nil, ErrNoRecordFound
+	}
+
+	latest.Content = append([]byte(nil), latest.Content...)
+
+	return latest, nil
+}
+
+func (m memoryExports) DeleteAllForUser(userID int64) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for id, export := range m.s.exports {
+		if export.UserID == userID {
+			delete(m.s.exports, id)
+		}
+	}
+
+	return nil
+}
+
+func (m memoryExports) DeleteExpired() error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	now := m.s.now()
+
+	for id, export := range m.s.exports {
+		if !export.Expiry.After(now) {
+			delete(m.s.exports, id)
+		}
+	}
+
+	return nil
+}
+
+type memoryLogin struct {
+	lastFailureAt time.Time
+	lockedUntil   time.Time
+	failures      int
+}
+
+type memoryLogins struct{ s *memoryStore }
+
+func (m memoryLogins) attempt(key string, l memoryLogin) *LoginAttempt {
+	attempt := &LoginAttempt{Key: key, Failures: l.failures}
+	if d := l.lockedUntil.Sub(m.s.now()); d > 0 {
+		attempt.LockedFor = d
+	}
+	return attempt
+}
+
+func (m memoryLogins) Get(key string) (*LoginAttempt, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	return m.attempt(key, m.s.logins[key]), nil
+}
+
+func (m memoryLogins) RecordFailure(key string, window time.Duration) (*LoginAttempt, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	now := m.s.now()
+
+	l := m.s.logins[key]
+	if l.lastFailureAt.Before(now.Add(-window)) {
+		l.failures = 0
+	}
+	l.failures++
+	l.lastFailureAt = now
+	m.s.logins[key] = l
+
+	return m.attempt(key, l), nil
+}
+
+func (m memoryLogins) Lock(key string, d time.Duration) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if l, ok := m.s.logins[key]; ok {
+		l.lockedUntil = m.s.now().Add(d)
+		m.s.logins[key] = l
+	}
+
+	return nil
+}
+
+func (m memoryLogins) Reset(key string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	delete(m.s.logins, key)
+
+	return nil
+}
+
+type memoryTwoFactor struct{ s *memoryStore }
+
+func (m memoryTwoFactor) Get(userID int64) (*TOTP, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	t, ok := m.s.totp[userID]
+	if !ok {
+		return nil, ErrNoRecordFound
+	}
+
+	t.Secret = append([]byte(nil), t.Secret...)
+
+	return &t, nil
+}
+
+func (m memoryTwoFactor) Enroll(t *TOTP) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.users[t.UserID]; !ok {
+		return ErrNoRecordFound
+	}
+
+	if stored, ok := m.s.totp[t.UserID]; ok && stored.Confirmed {
+		return ErrEditConflict
+	}
+
+	t.CreatedAt = m.s.now().Truncate(time.Second)
+	t.Confirmed, t.LastStep = false, 0
+
+	stored := *t
+	stored.Secret = append([]byte(nil), t.Secret...)
+	m.s.totp[t.UserID] = stored
+
+	return nil
+}
+
+func (m memoryTwoFactor) UseStep(userID, step int64) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	t, ok := m.s.totp[userID]
+	if !ok || t.LastStep >= step {
+		return ErrEditConflict
+	}
+
+	t.LastStep, t.Confirmed = step, true
+	m.s.totp[userID] = t
+
+	return nil
+}
+
+func (m memoryTwoFactor) Delete(userID int64) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for hash, id := range m.s.recovery {
+		if id == userID {
+			delete(m.s.recovery, hash)
+		}
+	}
+
+	if _, ok := m.s.totp[userID]; !ok {
+		return ErrNoRecordFound
+	}
+
+	delete(m.s.totp, userID)
+
+	return nil
+}
+
+func (m memoryTwoFactor) NewRecoveryCodes(userID int64) ([]string, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.users[userID]; !ok {
+		return nil, ErrNoRecordFound
+	}
+
+	for hash, id := range m.s.recovery {
+		if id == userID {
+			delete(m.s.recovery, hash)
+		}
+	}
+
+	codes := make([]string, 0, RecoveryCodeCount)
+
+	for i := 0; i < RecoveryCodeCount; i++ {
+		code, hash, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		m.s.recovery[string(hash)] = userID
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+func (m memoryTwoFactor) UseRecoveryCode(userID int64, code string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	hash := string(hashRecoveryCode(code))
+
+	if id, ok := m.s.recovery[hash]; !ok || id != userID {
+		return ErrNoRecordFound
+	}
+
+	delete(m.s.recovery, hash)
+
+	return nil
+}
+
+func (m memoryTwoFactor) RecoveryCodesLeft(userID int64) (int, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	n := 0
+	for _, id := range m.s.recovery {
+		if id == userID {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+type memoryAPIKeys struct{ s *memoryStore }
+
+func copyAPIKey(k APIKey) *APIKey {
+	k.Permissions = append(Permissions(nil), k.Permissions...)
+	k.Hash = append([]byte(nil), k.Hash...)
+	return &k
+}
+
+func (m memoryAPIKeys) New(key *APIKey) error {
+	err := generateAPIKey(key)
+	if err != nil {
+		return err
+	}
+
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.users[key.UserID]; !ok {
+		return ErrNoRecordFound
+	}
+
+	m.s.nextAPIKey++
+
+	key.ID = m.s.nextAPIKey
+	key.CreatedAt = m.s.now().Truncate(time.Second)
+
+	stored := copyAPIKey(*key)
+	stored.Plaintext = ""
+	m.s.apiKeys[key.ID] = *stored
+
+	return nil
+}
+
+func (m memoryAPIKeys) GetAllForUser(userID int64) ([]*APIKey, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	keys := make([]*APIKey, 0)
+	for _, key := range m.s.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, copyAPIKey(key))
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	return keys, nil
+}
+
+func (m memoryAPIKeys) GetForKey(plaintext string) (*APIKey, *User, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	hash := string(hashAPIKey(plaintext))
+
+	for _, key := range m.s.apiKeys {
+		if string(key.Hash) != hash || key.Expired(m.s.now()) {
+			continue
+		}
+
+		user, ok := m.s.users[key.UserID]
+		if !ok {
+			break
+		}
+
+		return copyAPIKey(key), copyUser(user), nil
+	}
+
+	return nil, nil, ErrNoRecordFound
+}
+
+func (m memoryAPIKeys) Touch(id int64, ip string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	key, ok := m.s.apiKeys[id]
+	if !ok {
+		return nil
+	}
+
+	now := m.s.now()
+
+	if key.LastUsedAt == nil || key.LastUsedIP != ip || key.LastUsedAt.Before(now.Add(-apiKeyTouchInterval)) {
+		usedAt := now.Truncate(time.Second)
+		key.LastUsedAt, key.LastUsedIP = &usedAt, ip
+		m.s.apiKeys[id] = key
+	}
+
+	return nil
+}
+
+func (m memoryAPIKeys) Delete(id, userID int64) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	key, ok := m.s.apiKeys[id]
+	if !ok || key.UserID != userID {
+		return ErrNoRecordFound
+	}
+
+	delete(m.s.apiKeys, id)
+
+	return nil
+}
+
+type memoryRevocations struct{ s *memoryStore }
+
+func (m memoryRevocations) Insert(r *Revocation) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	m.s.revocations = append(m.s.revocations, *r)
+
+	return nil
+}
+
+func (m memoryRevocations) GetAll() ([]*Revocation, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	now := m.s.now()
+
+	var kept []Revocation
+	revocations := make([]*Revocation, 0)
+
+	for _, r := range m.s.revocations {
+		if r.Expiry.After(now) {
+			kept = append(kept, r)
+			rev := r
+			revocations = append(revocations, &rev)
+		}
+	}
+
+	m.s.revocations = kept
+
+	return revocations, nil
+}
+
+type memoryJobs struct{ s *memoryStore }
+
+func (m memoryJobs) Insert(job *Job) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	m.s.nextJobID++
+
+	job.ID = m.s.nextJobID
+	job.CreatedAt = m.s.now().Truncate(time.Second)
+	job.RunAt = m.s.now()
+	job.Status = JobPending
+
+	stored := *job
+	stored.Payload = append(json.RawMessage(nil), job.Payload...)
+	m.s.jobs[job.ID] = stored
+
+	return nil
+}
+
+func (m memoryJobs) Claim(types []string, lease time.Duration) (*Job, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	now := m.s.now()
+
+	var next *Job
+	for _, job := range m.s.jobs {
+		if job.Status != JobPending || job.RunAt.After(now) || !containsAll(types, []string{job.Type}) {
+			continue
+		}
+
+		if next == nil || job.RunAt.Before(next.RunAt) || (job.RunAt.Equal(next.RunAt) && job.ID < next.ID) {
+			j := job
+			next = &j
+		}
+	}
+
+	if next == nil {
+		return nil, ErrNoRecordFound
+	}
+
+	next.Attempts++
+	next.RunAt = now.Add(lease)
+	m.s.jobs[next.ID] = *next
+
+	return next, nil
+}
+
+func (m memoryJobs) Complete(id int64) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	job, ok := m.s.jobs[id]
+	if !ok {
+		return nil
+	}
+
+	finishedAt := m.s.now().Truncate(time.Second)
+	job.Status, job.FinishedAt, job.LastError = JobDone, &finishedAt, ""
+	m.s.jobs[id] = job
+
+	return nil
+}
+
+func (m memoryJobs) Fail(id int64, lastError string, retryIn time.Duration, dead bool) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	job, ok := m.s.jobs[id]
+	if !ok {
+		return nil
+	}
+
+	job.Status = JobPending
+	if dead {
+		job.Status = JobDead
+	}
+	job.LastError, job.RunAt = lastError, m.s.now().Add(retryIn)
+	m.s.jobs[id] = job
+
+	return nil
+}
+
+// memoryHealth reports a healthy store with no schema migrations to track.
+type memoryHealth struct{}
+
+func (memoryHealth) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (memoryHealth) MigrationVersion(ctx context.Context) (int64, bool, error) {
+	return 0, false, ctx.Err()
+}
+
+// searchTerms splits s into lower-cased words the same way the 'simple'
+// text search configuration does.
+func searchTerms(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func containsAll(values, wanted []string) bool {
+	for _, w := range wanted {
+		found := false
+		for _, v := range values {
+			if v == w {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func paginate[T any](records []T, f Filters) ([]T, Metadata, error) {
+	total := len(records)
+
+	start := f.offset()
+	if start > total {
+		start = total
+	}
+
+	end := start + f.limit()
+	if end > total {
+		end = total
+	}
+
+	page := make([]T, 0, end-start)
+	page = append(page, records[start:end]...)
+
+	return page, calculateMetadata(total, f.Page, f.PageSize), nil
+}
+
+type memoryIdentities struct{ s *memoryStore }
+
+func identityKey(provider, subject string) string {
+	return provider + "\x00" + subject
+}
+
+func (m memoryIdentities) Insert(identity *Identity) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.users[identity.UserID]; !ok {
+		return ErrNoRecordFound
+	}
+
+	key := identityKey(identity.Provider, identity.Subject)
+	if _, ok := m.s.identities[key]; ok {
+		return ErrEditConflict
+	}
+
+	identity.CreatedAt = m.s.now().Truncate(time.Second)
+	m.s.identities[key] = *identity
+
+	return nil
+}
+
+func (m memoryIdentities) GetUser(provider, subject string) (*User, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	identity, ok := m.s.identities[identityKey(provider, subject)]
+	if !ok {
+		return nil, ErrNoRecordFound
+	}
+
+	user, ok := m.s.users[identity.UserID]
+	if !ok {
+		return nil, ErrNoRecordFound
+	}
+
+	return &user, nil
+}
+
+func (m memoryIdentities) GetAllForUser(userID int64) ([]*Identity, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	identities := make([]*Identity, 0)
+	for _, identity := range m.s.identities {
+		if identity.UserID == userID {
+			i := identity
+			identities = append(identities, &i)
+		}
+	}
+
+	sort.Slice(identities, func(i, j int) bool {
+		if !identities[i].CreatedAt.Equal(identities[j].CreatedAt) {
+			return identities[i].CreatedAt.Before(identities[j].CreatedAt)
+		}
+		return identities[i].Provider < identities[j].Provider
+	})
+
+	return identities, nil
+}
+
+func (m memoryIdentities) InsertState(state *OAuthState) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	now := m.s.now()
+
+	for k, s := range m.s.oauthStates {
+		if !s.Expiry.After(now) {
+			delete(m.s.oauthStates, k)
+		}
+	}
+
+	stored := *state
+	stored.Plaintext = ""
+	m.s.oauthStates[string(state.Hash)] = stored
+
+	return nil
+}
+
+func (m memoryIdentities) TakeState(plaintext, provider string) (*OAuthState, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	hash := sha256.Sum256([]byte(plaintext))
+
+	state, ok := m.s.oauthStates[string(hash[:])]
+	if !ok || state.Provider != provider || !state.Expiry.After(m.s.now()) {
+		return nil, ErrNoRecordFound
+	}
+
+	delete(m.s.oauthStates, string(hash[:]))
+	state.Plaintext = plaintext
+
+	return &state, nil
+}
+
+type memoryRateLimits struct{ s *memoryStore }
+
+func (m memoryRateLimits) GetTier(userID int64) (string, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	return m.s.tiers[userID], nil
+}
+
+func (m memoryRateLimits) SetTier(userID int64, tier string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if tier == "" {
+		delete(m.s.tiers, userID)
+		return nil
+	}
+
+	if _, ok := m.s.users[userID]; !ok {
+		return ErrNoRecordFound
+	}
+
+	m.s.tiers[userID] = tier
+
+	return nil
+}
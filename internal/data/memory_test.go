@@ -0,0 +1,192 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestUser(t *testing.T, models Models, email string) *User {
+	t.Helper()
+
+	user := &User{Name: "Test", Email: email}
+	if err := user.Password.Set("pa55word"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := models.Users.Insert(user); err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func TestMemoryUsersDuplicateEmail(t *testing.T) {
+	models := NewMemoryModels(nil)
+	newTestUser(t, models, "alice@example.com")
+
+	user := &User{Name: "Other", Email: "ALICE@example.com"}
+	user.Password.Set("pa55word")
+
+	err := models.Users.Insert(user)
+	if !errors.Is(err, ErrDuplicateEmail) {
+		t.Fatalf("got %v; want ErrDuplicateEmail", err)
+	}
+}
+
+func TestMemoryUsersEditConflict(t *testing.T) {
+	models := NewMemoryModels(nil)
+	newTestUser(t, models, "alice@example.com")
+
+	first, _ := models.Users.GetByEmail("alice@example.com")
+	second, _ := models.Users.GetByEmail("alice@example.com")
+
+	first.Activated = true
+	if err := models.Users.UpdateUser(first); err != nil {
+		t.Fatal(err)
+	}
+
+	second.Name = "Stale"
+	if err := models.Users.UpdateUser(second); !errors.Is(err, ErrEditConflict) {
+		t.Fatalf("got %v; want ErrEditConflict", err)
+	}
+}
+
+func TestMemoryTokens(t *testing.T) {
+	models := NewMemoryModels(nil)
+	user := newTestUser(t, models, "alice@example.com")
+
+	valid, err := models.Tokens.New(user.ID, time.Hour, ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := models.Tokens.New(user.ID, -time.Hour, ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		scope string
+		want  error
+	}{
+		{"Valid", valid.Plaintext, ScopeAuthentication, nil},
+		{"Wrong scope", valid.Plaintext, ScopeActivation, ErrNoRecordFound},
+		{"Expired", expired.Plaintext, ScopeAuthentication, ErrNoRecordFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := models.Users.GetForToken(tt.token, tt.scope)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryMoviesGetAll(t *testing.T) {
+	models := NewMemoryModels(nil)
+
+	for _, m := range []*Movie{
+		{Title: "Black Panther", Year: 2018, Runtime: 134, Genres: []string{"action", "adventure"}},
+		{Title: "Deadpool", Year: 2016, Runtime: 108, Genres: []string{"action", "comedy"}},
+		{Title: "The Breakfast Club", Year: 1986, Runtime: 96, Genres: []string{"drama"}},
+	} {
+		if err := models.Movies.Insert(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := Filters{Page: 1, PageSize: 20, Sort: "-year", SortSafelist: []string{"id", "-year"}}
+
+	tests := []struct {
+		name   string
+		title  string
+		genres []string
+		want   []string
+	}{
+		{"All", "", nil, []string{"Black Panther", "Deadpool", "The Breakfast Club"}},
+		{"Title words", "the club", nil, []string{"The Breakfast Club"}},
+		{"Partial word", "panth", nil, nil},
+		{"Genres", "", []string{"action"}, []string{"Black Panther", "Deadpool"}},
+		{"Genres contain all", "", []string{"action", "comedy"}, []string{"Deadpool"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			movies, metadata, err := models.Movies.GetAll(tt.title, tt.genres, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(movies) != len(tt.want) || metadata.TotalRecords != len(tt.want) {
+				t.Fatalf("got %d movies; want %d", len(movies), len(tt.want))
+			}
+
+			for i := range movies {
+				if movies[i].Title != tt.want[i] {
+					t.Errorf("movie %d: got %q; want %q", i, movies[i].Title, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryRateLimits(t *testing.T) {
+	models := NewMemoryModels(nil)
+	user := newTestUser(t, models, "alice@example.com")
+
+	if err := models.RateLimits.SetTier(user.ID, "partner"); err != nil {
+		t.Fatal(err)
+	}
+
+	if tier, err := models.RateLimits.GetTier(user.ID); err != nil || tier != "partner" {
+		t.Fatalf("got %q, %v; want %q", tier, err, "partner")
+	}
+
+	if err := models.RateLimits.SetTier(user.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if tier, err := models.RateLimits.GetTier(user.ID); err != nil || tier != "" {
+		t.Fatalf("after clearing: got %q, %v", tier, err)
+	}
+
+	if err := models.RateLimits.SetTier(user.ID+1, "partner"); !errors.Is(err, ErrNoRecordFound) {
+		t.Fatalf("unknown user: got %v; want ErrNoRecordFound", err)
+	}
+}
+
+func TestMemoryTransactionKeepsConcurrentWrites(t *testing.T) {
+	models := NewMemoryModels(nil)
+
+	done := make(chan struct{})
+
+	err := models.Transaction(func(tx Models) error {
+		newTestUser(t, tx, "alice@example.com")
+
+		// another request writes while the transaction is open
+		go func() {
+			defer close(done)
+			newTestUser(t, models, "bob@example.com")
+		}()
+
+		return errors.New("rollback")
+	})
+	if err == nil {
+		t.Fatal("got no error")
+	}
+
+	<-done
+
+	if _, err := models.Users.GetByEmail("alice@example.com"); !errors.Is(err, ErrNoRecordFound) {
+		t.Errorf("rolled back user: got %v; want ErrNoRecordFound", err)
+	}
+
+	if _, err := models.Users.GetByEmail("bob@example.com"); err != nil {
+		t.Errorf("concurrent user: got %v", err)
+	}
+}
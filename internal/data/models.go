@@ -1,8 +1,10 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
 )
 
 var (
@@ -11,18 +13,195 @@ var (
 	ErrDuplicateEmail = errors.New("duplicate email")
 )
 
+// DBTX is satisfied by both *sql.DB and *sql.Tx, so the same model can run
+// on its own or as part of a transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type MovieRepository interface {
+	Insert(movie *Movie) error
+	Get(id int) (*Movie, error)
+	Update(movie *Movie) error
+	Delete(id int) error
+	GetAll(title string, genres []string, f Filters) ([]*Movie, Metadata, error)
+}
+
+type PermissionRepository interface {
+	GetAllForUser(userID int64) (Permissions, error)
+	AddForUser(userID int64, codes ...string) error
+	RemoveForUser(userID int64, codes ...string) error
+	GetAll() (Permissions, error)
+}
+
+type UserRepository interface {
+	Insert(user *User) error
+	Get(id int64) (*User, error)
+	GetByEmail(email string) (*User, error)
+	GetAll(search string, f Filters) ([]*User, Metadata, error)
+	GetForToken(tokenPlaintext, scope string) (*User, error)
+	UpdateUser(user *User) error
+	Delete(id int64) error
+}
+
+type TokenRepository interface {
+	New(userID int64, ttl time.Duration, scope string) (*Token, error)
+	NewInSession(session *Token, ttl time.Duration, scope string) (*Token, error)
+	Insert(token *Token) error
+	Touch(tokenPlaintext, ip, userAgent string) error
+	TouchFamily(family []byte, ip, userAgent string) error
+	DeleteAllForUser(userID int64, scope string) error
+	DeleteAllScopesForUser(userID int64) error
+	Delete(userID int64, tokenPlaintext string) error
+	DeleteByID(id, userID int64, scope string) ([]byte, error)
+	DeleteFamily(family []byte) error
+	Rotate(tokenPlaintext, scope string) (*Token, error)
+	GetAllForUser(userID int64, scope string) ([]*Token, error)
+}
+
+type EmailRepository interface {
+	Enqueue(email *Email) error
+	ClaimNext(lease time.Duration) (*Email, error)
+	MarkSent(id int64) error
+	MarkFailed(id int64, lastError string, retryIn time.Duration, dead bool) error
+	GetAll(status string, f Filters) ([]*Email, Metadata, error)
+	Retry(id int64) (*Email, error)
+	DeleteDead(retention time.Duration) error
+	GetAllForRecipient(recipient string) ([]*Email, error)
+}
+
+type JobRepository interface {
+	Insert(job *Job) error
+	Claim(types []string, lease time.Duration) (*Job, error)
+	Complete(id int64) error
+	Fail(id int64, lastError string, retryIn time.Duration, dead bool) error
+}
+
+type ExportRepository interface {
+	Insert(export *Export, ttl time.Duration) error
+	GetForUser(userID int64) (*Export, error)
+	DeleteAllForUser(userID int64) error
+	DeleteExpired() error
+}
+
+type LoginAttemptRepository interface {
+	Get(key string) (*LoginAttempt, error)
+	RecordFailure(key string, window time.Duration) (*LoginAttempt, error)
+	Lock(key string, d time.Duration) error
+	Reset(key string) error
+}
+
+type TwoFactorRepository interface {
+	Get(userID int64) (*TOTP, error)
+	Enroll(t *TOTP) error
+	UseStep(userID, step int64) error
+	Delete(userID int64) error
+	NewRecoveryCodes(userID int64) ([]string, error)
+	UseRecoveryCode(userID int64, code string) error
+	RecoveryCodesLeft(userID int64) (int, error)
+}
+
+type APIKeyRepository interface {
+	New(key *APIKey) error
+	GetAllForUser(userID int64) ([]*APIKey, error)
+	GetForKey(plaintext string) (*APIKey, *User, error)
+	Touch(id int64, ip string) error
+	Delete(id, userID int64) error
+}
+
+type RevocationRepository interface {
+	Insert(r *Revocation) error
+	GetAll() ([]*Revocation, error)
+}
+
+type IdentityRepository interface {
+	Insert(identity *Identity) error
+	GetUser(provider, subject string) (*User, error)
+	GetAllForUser(userID int64) ([]*Identity, error)
+	InsertState(state *OAuthState) error
+	TakeState(plaintext, provider string) (*OAuthState, error)
+}
+
+type RateLimitRepository interface {
+	GetTier(userID int64) (string, error)
+	SetTier(userID int64, tier string) error
+}
+
+type HealthRepository interface {
+	Ping(ctx context.Context) error
+	MigrationVersion(ctx context.Context) (int64, bool, error)
+}
+
 type Models struct {
-	Movies      MovieModel
-	Permissions PermissionModel
-	Users       UserModel
-	Tokens      TokensModel
+	Movies      MovieRepository
+	Permissions PermissionRepository
+	Users       UserRepository
+	Tokens      TokenRepository
+	Emails      EmailRepository
+	Jobs        JobRepository
+	Exports     ExportRepository
+	Logins      LoginAttemptRepository
+	TwoFactor   TwoFactorRepository
+	APIKeys     APIKeyRepository
+	Revocations RevocationRepository
+	Identities  IdentityRepository
+	RateLimits  RateLimitRepository
+	Health      HealthRepository
+
+	transaction func(fn func(Models) error) error
 }
 
 func NewModels(db *sql.DB) Models {
+	m := newModels(db)
+	m.Health = HealthModel{DB: db}
+
+	m.transaction = func(fn func(Models) error) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		txModels := newModels(tx)
+		txModels.Health = m.Health
+		txModels.transaction = func(fn func(Models) error) error {
+			return fn(txModels)
+		}
+
+		err = fn(txModels)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}
+
+	return m
+}
+
+func newModels(db DBTX) Models {
 	return Models{
-		MovieModel{DB: db},
-		PermissionModel{DB: db},
-		UserModel{DB: db},
-		TokensModel{DB: db},
+		Movies:      MovieModel{DB: db},
+		Permissions: PermissionModel{DB: db},
+		Users:       UserModel{DB: db},
+		Tokens:      TokensModel{DB: db},
+		Emails:      EmailModel{DB: db},
+		Jobs:        JobModel{DB: db},
+		Exports:     ExportModel{DB: db},
+		Logins:      LoginAttemptModel{DB: db},
+		TwoFactor:   TwoFactorModel{DB: db},
+		APIKeys:     APIKeyModel{DB: db},
+		Revocations: RevocationModel{DB: db},
+		Identities:  IdentityModel{DB: db},
+		RateLimits:  RateLimitModel{DB: db},
 	}
 }
+
+// Transaction runs fn with models that share a single transaction, which is
+// committed if fn returns nil and rolled back otherwise. Calling Transaction
+// on the models passed to fn reuses the same transaction.
+func (m Models) Transaction(fn func(Models) error) error {
+	return m.transaction(fn)
+}
@@ -38,7 +38,7 @@ func ValidateMovie(v *validator.Validator, m *Movie) {
 }
 
 type MovieModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 func (m MovieModel) Insert(mov *Movie) error {
@@ -2,7 +2,6 @@ package data
 
 import (
 	"context"
-	"database/sql"
 	"time"
 
 	"github.com/lib/pq"
@@ -21,7 +20,7 @@ func (p Permissions) Include(code string) bool {
 }
 
 type PermissionModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
@@ -62,6 +61,7 @@ func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
 	stmt := `
           INSERT INTO user_permissions (user_id, permission_id)
           SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+          ON CONFLICT DO NOTHING
           `
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -70,3 +70,50 @@ func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
 	_, err := m.DB.ExecContext(ctx, stmt, userID, pq.Array(codes))
 	return err
 }
+
+func (m PermissionModel) RemoveForUser(userID int64, codes ...string) error {
+	stmt := `
+          DELETE FROM user_permissions
+          USING permissions
+          WHERE permissions.id = user_permissions.permission_id
+          AND user_permissions.user_id = $1 AND permissions.code = ANY($2)
+          `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, userID, pq.Array(codes))
+	return err
+}
+
+// GetAll returns every permission code that can be granted.
+func (m PermissionModel) GetAll() (Permissions, error) {
+	stmt := `SELECT code FROM permissions ORDER BY code`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	r, err := m.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var permissions Permissions
+
+	for r.Next() {
+		var permission string
+		err := r.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	if err = r.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
@@ -0,0 +1,59 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+type RateLimitModel struct {
+	DB DBTX
+}
+
+// GetTier returns the rate limit tier assigned to the user, or "" if they
+// have none.
+func (m RateLimitModel) GetTier(userID int64) (string, error) {
+	stmt := `SELECT tier FROM rate_limit_tiers WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var tier string
+
+	err := m.DB.QueryRowContext(ctx, stmt, userID).Scan(&tier)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	return tier, nil
+}
+
+// SetTier assigns a rate limit tier to the user, or removes it if tier is "".
+func (m RateLimitModel) SetTier(userID int64, tier string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if tier == "" {
+		_, err := m.DB.ExecContext(ctx, `DELETE FROM rate_limit_tiers WHERE user_id = $1`, userID)
+		return err
+	}
+
+	stmt := `
+          INSERT INTO rate_limit_tiers (user_id, tier)
+          VALUES ($1, $2)
+          ON CONFLICT (user_id) DO UPDATE SET tier = EXCLUDED.tier`
+
+	_, err := m.DB.ExecContext(ctx, stmt, userID, tier)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `violates foreign key constraint`):
+			return ErrNoRecordFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
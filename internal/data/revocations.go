@@ -0,0 +1,74 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// Revocation withdraws JWTs before they expire. With a TokenID it revokes the
+// single token with that jti, with a Session every token naming that session,
+// otherwise every token of the user issued before RevokedAt. It only has to be
+// kept until Expiry, by which time the tokens it covers have expired anyway.
+type Revocation struct {
+	RevokedAt time.Time
+	Expiry    time.Time
+	TokenID   string
+	Session   string
+	UserID    int64
+}
+
+type RevocationModel struct {
+	DB DBTX
+}
+
+func (m RevocationModel) Insert(r *Revocation) error {
+	stmt := `
+          INSERT INTO jwt_revocations (user_id, token_id, session, revoked_at, expiry)
+          VALUES ($1, $2, $3, $4, $5)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, r.UserID, r.TokenID, r.Session, r.RevokedAt, r.Expiry)
+	return err
+}
+
+// GetAll returns every revocation that hasn't expired, deleting those that
+// have.
+func (m RevocationModel) GetAll() ([]*Revocation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	now := time.Now()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM jwt_revocations WHERE expiry <= $1`, now)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := `
+          SELECT user_id, token_id, session, revoked_at, expiry
+          FROM jwt_revocations
+          WHERE expiry > $1`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revocations := make([]*Revocation, 0)
+
+	for rows.Next() {
+		var r Revocation
+
+		err := rows.Scan(&r.UserID, &r.TokenID, &r.Session, &r.RevokedAt, &r.Expiry)
+		if err != nil {
+			return nil, err
+		}
+
+		revocations = append(revocations, &r)
+	}
+
+	return revocations, rows.Err()
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"time"
 
 	"github.com/PriyanshuSharma23/greenlight/internal/validator"
@@ -14,21 +15,48 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopeEmailChange    = "email-change"
+	ScopeExport         = "export"
+	ScopeTwoFactor      = "2fa-pending"
+	ScopeRefresh        = "refresh"
 )
 
+// ErrTokenReused is returned when rotating a token that was already rotated,
+// which means someone else has a copy of it.
+var ErrTokenReused = errors.New("token reused")
+
+// tokenTouchInterval is how often repeated use of a session from the same
+// address is written back to its tokens.
+const tokenTouchInterval = time.Minute
+
+// A Token with a Family belongs to a session: the authentication and refresh
+// tokens issued at login, and every token later rotated out of those, share
+// it so that they can be revoked together. They also share when the session
+// started, and when and from where it was last used.
 type Token struct {
-	Plaintext string    `json:"token"`
-	Expiry    time.Time `json:"expiry"`
-	Scope     string    `json:"-"`
-	Hash      []byte    `json:"-"`
-	UserID    int64     `json:"-"`
+	Plaintext  string    `json:"token"`
+	Expiry     time.Time `json:"expiry"`
+	CreatedAt  time.Time `json:"-"`
+	LastUsedAt time.Time `json:"-"`
+	Scope      string    `json:"-"`
+	IP         string    `json:"-"`
+	UserAgent  string    `json:"-"`
+	Hash       []byte    `json:"-"`
+	Family     []byte    `json:"-"`
+	ID         int64     `json:"-"`
+	UserID     int64     `json:"-"`
+	Rotated    bool      `json:"-"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
+	now := time.Now()
+
 	token := Token{
-		UserID: userID,
-		Expiry: time.Now().Add(ttl),
-		Scope:  scope,
+		UserID:     userID,
+		Expiry:     now.Add(ttl),
+		CreatedAt:  now.Truncate(time.Second),
+		LastUsedAt: now.Truncate(time.Second),
+		Scope:      scope,
 	}
 
 	randomBytes := make([]byte, 16)
@@ -46,13 +74,25 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 	return &token, nil
 }
 
+// NewTokenFamily returns a random identifier for a new token family.
+func NewTokenFamily() ([]byte, error) {
+	family := make([]byte, 16)
+
+	_, err := rand.Read(family)
+	if err != nil {
+		return nil, err
+	}
+
+	return family, nil
+}
+
 func ValidatePlaintextToken(v *validator.Validator, plaintextToken string) {
 	v.Check(plaintextToken != "", "token", "must be provided")
 	v.Check(len(plaintextToken) == 26, "token", "must be 26 bytes long")
 }
 
 type TokensModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 func (m TokensModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -65,18 +105,74 @@ func (m TokensModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+// NewInSession issues a token for session.UserID in the same session: it takes
+// the family, start time and client details of session, which needn't be a
+// stored token. A zero CreatedAt starts the session now.
+func (m TokensModel) NewInSession(session *Token, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(session.UserID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	inheritSession(token, session)
+
+	err = m.Insert(token)
+	return token, err
+}
+
+func inheritSession(token, session *Token) {
+	token.Family, token.IP, token.UserAgent = session.Family, session.IP, session.UserAgent
+
+	if !session.CreatedAt.IsZero() {
+		token.CreatedAt = session.CreatedAt
+	}
+}
+
 func (m TokensModel) Insert(token *Token) error {
 	stmt := `
-          INSERT INTO tokens (hash, user_id, expiry, scope)
-          VALUES ($1, $2, $3, $4)
-          `
+          INSERT INTO tokens (hash, user_id, expiry, scope, family, created_at, last_used_at, ip, user_agent)
+          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+          RETURNING id`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
-	_, err := m.DB.ExecContext(ctx, stmt, args...)
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.Family, token.CreatedAt, token.LastUsedAt, token.IP, token.UserAgent}
+
+	return m.DB.QueryRowContext(ctx, stmt, args...).Scan(&token.ID)
+}
 
+// Touch records that the session of the token was just used from ip. Repeated
+// use from the same address only writes once per tokenTouchInterval.
+func (m TokensModel) Touch(tokenPlaintext, ip, userAgent string) error {
+	stmt := `
+          UPDATE tokens SET last_used_at = $2, ip = $3, user_agent = $4
+          WHERE (hash = $1 OR family = (SELECT family FROM tokens WHERE hash = $1))
+            AND NOT rotated AND (last_used_at < $5 OR ip <> $3)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	now := time.Now()
+
+	_, err := m.DB.ExecContext(ctx, stmt, hash[:], now, ip, userAgent, now.Add(-tokenTouchInterval))
+	return err
+}
+
+// TouchFamily is Touch for a session known by its family, which is how the
+// sessions of JWTs are recorded as used since those aren't stored.
+func (m TokensModel) TouchFamily(family []byte, ip, userAgent string) error {
+	stmt := `
+          UPDATE tokens SET last_used_at = $2, ip = $3, user_agent = $4
+          WHERE family = $1 AND NOT rotated AND (last_used_at < $5 OR ip <> $3)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	now := time.Now()
+
+	_, err := m.DB.ExecContext(ctx, stmt, family, now, ip, userAgent, now.Add(-tokenTouchInterval))
 	return err
 }
 
@@ -94,3 +190,172 @@ func (m TokensModel) DeleteAllForUser(userID int64, scope string) error {
 
 	return err
 }
+
+// Delete removes the user's token with the given plaintext, whatever its
+// scope, together with the rest of its family.
+func (m TokensModel) Delete(userID int64, tokenPlaintext string) error {
+	stmt := `
+          DELETE FROM tokens
+          WHERE user_id = $1 AND (hash = $2 OR family = (
+            SELECT family FROM tokens WHERE user_id = $1 AND hash = $2))
+          `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	_, err := m.DB.ExecContext(ctx, stmt, userID, hash[:])
+
+	return err
+}
+
+// DeleteAllScopesForUser removes every token of the user, logging them out
+// everywhere and invalidating pending activations.
+func (m TokensModel) DeleteAllScopesForUser(userID int64) error {
+	stmt := `
+          DELETE FROM tokens
+          WHERE user_id=$1
+          `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, userID)
+
+	return err
+}
+
+// DeleteByID removes the user's unexpired token of the given scope and id,
+// together with the rest of its family, and returns the family.
+func (m TokensModel) DeleteByID(id, userID int64, scope string) ([]byte, error) {
+	stmt := `
+          WITH deleted AS (
+            SELECT id, family FROM tokens
+            WHERE id = $1 AND user_id = $2 AND scope = $3 AND expiry > $4 AND NOT rotated)
+          DELETE FROM tokens
+          WHERE id IN (SELECT id FROM deleted) OR family IN (SELECT family FROM deleted)
+          RETURNING family`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var family []byte
+
+	err := m.DB.QueryRowContext(ctx, stmt, id, userID, scope, time.Now()).Scan(&family)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	return family, nil
+}
+
+// DeleteFamily removes every token in the family.
+func (m TokensModel) DeleteFamily(family []byte) error {
+	stmt := `
+          DELETE FROM tokens
+          WHERE family = $1
+          `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, family)
+
+	return err
+}
+
+// Rotate marks an unexpired token of the given scope as used up and returns
+// it, so that a replacement can be issued in its family. A token that was
+// already rotated is returned along with ErrTokenReused.
+func (m TokensModel) Rotate(tokenPlaintext, scope string) (*Token, error) {
+	stmt := `
+          UPDATE tokens SET rotated = true
+          WHERE hash = $1 AND scope = $2 AND expiry > $3 AND NOT rotated
+          RETURNING id, user_id, expiry, family, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	token := Token{Hash: hash[:], Scope: scope}
+
+	err := m.DB.QueryRowContext(ctx, stmt, token.Hash, scope, time.Now()).Scan(&token.ID, &token.UserID, &token.Expiry, &token.Family, &token.CreatedAt)
+	if err == nil {
+		token.Rotated = true
+		return &token, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	stmt = `
+          SELECT id, user_id, expiry, family, created_at
+          FROM tokens
+          WHERE hash = $1 AND scope = $2 AND expiry > $3`
+
+	err = m.DB.QueryRowContext(ctx, stmt, token.Hash, scope, time.Now()).Scan(&token.ID, &token.UserID, &token.Expiry, &token.Family, &token.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	token.Rotated = true
+
+	return &token, ErrTokenReused
+}
+
+// GetAllForUser returns the user's unexpired tokens of the given scope, leaving
+// out rotated ones. Only the plaintext is missing, which is never stored.
+func (m TokensModel) GetAllForUser(userID int64, scope string) ([]*Token, error) {
+	stmt := `
+          SELECT id, hash, user_id, expiry, scope, family, created_at, last_used_at, ip, user_agent
+          FROM tokens
+          WHERE user_id = $1 AND scope = $2 AND expiry > $3 AND NOT rotated
+          ORDER BY expiry, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID, scope, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]*Token, 0)
+
+	for rows.Next() {
+		var token Token
+
+		err := rows.Scan(
+			&token.ID,
+			&token.Hash,
+			&token.UserID,
+			&token.Expiry,
+			&token.Scope,
+			&token.Family,
+			&token.CreatedAt,
+			&token.LastUsedAt,
+			&token.IP,
+			&token.UserAgent,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, &token)
+	}
+
+	return tokens, rows.Err()
+}
@@ -0,0 +1,240 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+// TOTP is a user's authenticator app enrollment. It only protects logins once
+// Confirmed, which happens when the user proves they can generate codes.
+// LastStep is the time step of the last accepted code, so that a code can't
+// be used twice.
+type TOTP struct {
+	UserID    int64
+	CreatedAt time.Time
+	Secret    []byte
+	Confirmed bool
+	LastStep  int64
+}
+
+// RecoveryCodeCount is how many recovery codes a user gets when two-factor
+// authentication is enabled.
+const RecoveryCodeCount = 10
+
+// generateRecoveryCode returns a code such as "ABCDE-FGHIJ" along with the
+// hash of its normalised form.
+func generateRecoveryCode() (string, []byte, error) {
+	randomBytes := make([]byte, 10)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", nil, err
+	}
+
+	code := base32.StdEncoding.EncodeToString(randomBytes)
+	code = code[:5] + "-" + code[5:10]
+
+	return code, hashRecoveryCode(code), nil
+}
+
+// hashRecoveryCode ignores case, spaces and dashes, which users tend to get
+// wrong when typing a code back in.
+func hashRecoveryCode(code string) []byte {
+	code = strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(code))
+
+	hash := sha256.Sum256([]byte(code))
+	return hash[:]
+}
+
+type TwoFactorModel struct {
+	DB DBTX
+}
+
+func (m TwoFactorModel) Get(userID int64) (*TOTP, error) {
+	stmt := `
+          SELECT user_id, created_at, secret, confirmed, last_step
+          FROM user_totp
+          WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var t TOTP
+
+	err := m.DB.QueryRowContext(ctx, stmt, userID).Scan(&t.UserID, &t.CreatedAt, &t.Secret, &t.Confirmed, &t.LastStep)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoRecordFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &t, nil
+}
+
+// Enroll stores a new unconfirmed secret for the user, replacing any earlier
+// enrollment that was never confirmed.
+func (m TwoFactorModel) Enroll(t *TOTP) error {
+	stmt := `
+          INSERT INTO user_totp (user_id, secret)
+          VALUES ($1, $2)
+          ON CONFLICT (user_id) DO UPDATE SET
+            secret = EXCLUDED.secret, created_at = NOW(), last_step = 0
+          WHERE user_totp.confirmed = false
+          RETURNING created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, t.UserID, t.Secret).Scan(&t.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	t.Confirmed, t.LastStep = false, 0
+
+	return nil
+}
+
+// UseStep records that the code for step was accepted, confirming the
+// enrollment if it isn't already. It returns ErrEditConflict when a code for
+// the same or a later step was accepted first.
+func (m TwoFactorModel) UseStep(userID, step int64) error {
+	stmt := `
+          UPDATE user_totp
+          SET last_step = $2, confirmed = true
+          WHERE user_id = $1 AND last_step < $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, userID, step)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Delete turns two-factor authentication off for the user, discarding their
+// recovery codes too.
+func (m TwoFactorModel) Delete(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRecordFound
+	}
+
+	return nil
+}
+
+// NewRecoveryCodes replaces the user's recovery codes with a fresh set and
+// returns them. Only their hashes are stored.
+func (m TwoFactorModel) NewRecoveryCodes(userID int64) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, RecoveryCodeCount)
+
+	for i := 0; i < RecoveryCodeCount; i++ {
+		code, hash, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = m.DB.ExecContext(ctx, `INSERT INTO recovery_codes (hash, user_id) VALUES ($1, $2)`, hash, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// UseRecoveryCode spends one of the user's recovery codes. It returns
+// ErrNoRecordFound if the code isn't theirs or was already used.
+func (m TwoFactorModel) UseRecoveryCode(userID int64, code string) error {
+	stmt := `
+          DELETE FROM recovery_codes
+          WHERE hash = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, stmt, hashRecoveryCode(code), userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNoRecordFound
+	}
+
+	return nil
+}
+
+// RecoveryCodesLeft counts the user's unused recovery codes.
+func (m TwoFactorModel) RecoveryCodesLeft(userID int64) (int, error) {
+	stmt := `
+          SELECT count(*)
+          FROM recovery_codes
+          WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var n int
+
+	err := m.DB.QueryRowContext(ctx, stmt, userID).Scan(&n)
+	return n, err
+}
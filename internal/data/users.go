@@ -5,7 +5,9 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/PriyanshuSharma23/greenlight/internal/validator"
@@ -16,10 +18,14 @@ type User struct {
 	CreatedAt time.Time `json:"created_at"`
 	Name      string    `json:"name"`
 	Email     string    `json:"email"`
-	Password  password  `json:"-"`
-	ID        int64     `json:"id"`
-	Version   int       `json:"-"`
-	Activated bool      `json:"activated"`
+	Locale    string    `json:"locale"`
+	// PendingEmail is an address the user asked to switch to, which becomes
+	// Email once confirmed with a ScopeEmailChange token.
+	PendingEmail string   `json:"pending_email,omitempty"`
+	Password     password `json:"-"`
+	ID           int64    `json:"id"`
+	Version      int      `json:"-"`
+	Activated    bool     `json:"activated"`
 }
 
 var AnonymousUser = new(User)
@@ -28,13 +34,42 @@ func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
+// PasswordCost is the bcrypt cost of new password hashes. Tests lower it to
+// bcrypt.MinCost, since hashing at the real cost makes them very slow.
+var PasswordCost = 12
+
+// dummyPasswordHash is a hash of a password nobody uses at the cost it was
+// made with. Comparing against it takes as long as checking a real account's
+// password, so it is made again if PasswordCost changes.
+var dummyPasswordHash struct {
+	hash []byte
+	cost int
+	mu   sync.Mutex
+}
+
+func dummyHash() []byte {
+	dummyPasswordHash.mu.Lock()
+	defer dummyPasswordHash.mu.Unlock()
+
+	if dummyPasswordHash.hash == nil || dummyPasswordHash.cost != PasswordCost {
+		hash, err := bcrypt.GenerateFromPassword([]byte("not anyone's password"), PasswordCost)
+		if err != nil {
+			panic(err)
+		}
+
+		dummyPasswordHash.hash, dummyPasswordHash.cost = hash, PasswordCost
+	}
+
+	return dummyPasswordHash.hash
+}
+
 type password struct {
 	plaintext *string
 	hash      []byte
 }
 
 func (p *password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), PasswordCost)
 	if err != nil {
 		return err
 	}
@@ -58,6 +93,12 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	return true, nil
 }
 
+// SimulatePasswordCheck does the work of Matches without an account, so that
+// requests for unknown emails can't be told apart by their response time.
+func SimulatePasswordCheck(plaintextPassword string) {
+	bcrypt.CompareHashAndPassword(dummyHash(), []byte(plaintextPassword))
+}
+
 func ValidatePasswordPlaintext(v *validator.Validator, plaintextPassword string) {
 	v.Check(validator.NotBlank(plaintextPassword), "password", "must be provided")
 	v.Check(len(plaintextPassword) >= 8, "password", "must be atleast 8 bytes long.")
@@ -74,6 +115,7 @@ func ValidateUser(v *validator.Validator, user *User) {
 	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
 
 	ValidateEmail(v, user.Email)
+	ValidateLocale(v, user.Locale)
 
 	if user.Password.plaintext != nil {
 		ValidatePasswordPlaintext(v, *user.Password.plaintext)
@@ -85,19 +127,26 @@ func ValidateUser(v *validator.Validator, user *User) {
 	}
 }
 
+// ValidateLocale checks that locale is a language tag such as "en" or "pt-BR".
+// Whether there are translations for it is up to the mailer.
+func ValidateLocale(v *validator.Validator, locale string) {
+	v.Check(validator.NotBlank(locale), "locale", "must be provided")
+	v.Check(validator.Matches(locale, validator.LocaleRx), "locale", "must be a language tag such as en or pt-BR")
+}
+
 type UserModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 func (m UserModel) Insert(user *User) error {
-	stmt := `INSERT INTO users (name, email, password_hash, activated)
-		     VALUES ($1, $2, $3, $4) 
+	stmt := `INSERT INTO users (name, email, password_hash, activated, locale)
+		     VALUES ($1, $2, $3, $4, $5) 
 			 RETURNING id, created_at, version`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
+	args := []any{user.Name, user.Email, user.Password.hash, user.Activated, user.Locale}
 	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
 	if err != nil {
 		switch {
@@ -111,8 +160,40 @@ func (m UserModel) Insert(user *User) error {
 	return nil
 }
 
+func (m UserModel) Get(id int64) (*User, error) {
+	stmt := `SELECT id, created_at, name, email, pending_email, locale, password_hash, activated, version
+	 		 FROM users
+			 WHERE id=$1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var user User
+
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.PendingEmail,
+		&user.Locale,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecordFound
+		}
+
+		return nil, err
+	}
+
+	return &user, nil
+}
+
 func (m UserModel) GetByEmail(email string) (*User, error) {
-	stmt := `SELECT id, created_at, name, email, password_hash, activated, version 
+	stmt := `SELECT id, created_at, name, email, pending_email, locale, password_hash, activated, version
 	 		 FROM users
 			 WHERE email=$1`
 
@@ -126,6 +207,8 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.CreatedAt,
 		&user.Name,
 		&user.Email,
+		&user.PendingEmail,
+		&user.Locale,
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
@@ -141,9 +224,61 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
+// GetAll returns the users whose name or email contains search, which may be
+// empty to list everyone.
+func (m UserModel) GetAll(search string, f Filters) ([]*User, Metadata, error) {
+	stmt := fmt.Sprintf(`
+          SELECT COUNT(*) OVER(), id, created_at, name, email, pending_email, locale, password_hash, activated, version
+          FROM users
+          WHERE (name ILIKE '%%' || $1 || '%%' OR email ILIKE '%%' || $1 || '%%' OR $1 = '')
+          ORDER BY %s %s, id ASC
+          LIMIT $2 OFFSET $3`, f.sortColumn(), f.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, search, f.limit(), f.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+
+	users := make([]*User, 0)
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.PendingEmail,
+			&user.Locale,
+			&user.Password.hash,
+			&user.Activated,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return users, calculateMetadata(totalRecords, f.Page, f.PageSize), nil
+}
+
 func (m UserModel) GetForToken(tokenPlaintext, scope string) (*User, error) {
 	stmt := `
-          SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version 
+          SELECT users.id, users.created_at, users.name, users.email, users.pending_email, users.locale, users.password_hash, users.activated, users.version
           FROM users
           INNER JOIN tokens
           ON users.id = tokens.user_id
@@ -160,6 +295,8 @@ func (m UserModel) GetForToken(tokenPlaintext, scope string) (*User, error) {
 		&user.CreatedAt,
 		&user.Name,
 		&user.Email,
+		&user.PendingEmail,
+		&user.Locale,
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
@@ -178,8 +315,8 @@ func (m UserModel) GetForToken(tokenPlaintext, scope string) (*User, error) {
 func (m UserModel) UpdateUser(user *User) error {
 	stmt := `
 			UPDATE users 
-			SET name=$1, email=$2, password_hash=$3, activated=$4, version=version + 1
-			WHERE id=$5 AND version=$6
+			SET name=$1, email=$2, pending_email=$3, password_hash=$4, activated=$5, locale=$6, version=version + 1
+			WHERE id=$7 AND version=$8
 			RETURNING version
 			`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -188,8 +325,10 @@ func (m UserModel) UpdateUser(user *User) error {
 	args := []any{
 		user.Name,
 		user.Email,
+		user.PendingEmail,
 		user.Password.hash,
 		user.Activated,
+		user.Locale,
 		user.ID,
 		user.Version,
 	}
@@ -197,6 +336,8 @@ func (m UserModel) UpdateUser(user *User) error {
 	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(&user.Version)
 	if err != nil {
 		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
 		case strings.Contains(err.Error(), "users_email_key"):
 			return ErrDuplicateEmail
 		default:
@@ -206,3 +347,29 @@ func (m UserModel) UpdateUser(user *User) error {
 
 	return nil
 }
+
+// Delete removes the user. Their tokens and permissions go with them through
+// the foreign key cascades.
+func (m UserModel) Delete(id int64) error {
+	stmt := `DELETE FROM users
+           WHERE id=$1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	r, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNoRecordFound
+	}
+
+	return nil
+}
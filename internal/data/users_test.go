@@ -0,0 +1,41 @@
+package data
+
+import (
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMain(m *testing.M) {
+	PasswordCost = bcrypt.MinCost
+
+	os.Exit(m.Run())
+}
+
+func TestDummyPasswordHashCost(t *testing.T) {
+	defer func(cost int) { PasswordCost = cost }(PasswordCost)
+
+	for _, cost := range []int{bcrypt.MinCost, bcrypt.MinCost + 1} {
+		PasswordCost = cost
+
+		var p password
+		if err := p.Set("pa55word"); err != nil {
+			t.Fatal(err)
+		}
+
+		want, err := bcrypt.Cost(p.hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := bcrypt.Cost(dummyHash())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != want {
+			t.Errorf("dummy hash has cost %d; want %d like a password's", got, want)
+		}
+	}
+}
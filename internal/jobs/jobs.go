@@ -0,0 +1,350 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+	"github.com/PriyanshuSharma23/greenlight/internal/jsonlogger"
+)
+
+// lease is how long a claimed durable job is hidden from other workers. A
+// job that outlives it may run twice, so timeouts should stay well below it.
+const lease = 5 * time.Minute
+
+var (
+	ErrUnknownType = errors.New("jobs: unknown job type")
+	ErrQueueFull   = errors.New("jobs: queue is full")
+	ErrStopped     = errors.New("jobs: runner is stopped")
+)
+
+// Handler runs a single job. The context is cancelled when the job's timeout
+// expires or when the runner gives up waiting during shutdown.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+type Config struct {
+	Workers      int
+	QueueSize    int
+	MaxAttempts  int
+	Timeout      time.Duration
+	PollInterval time.Duration
+	BackoffBase  time.Duration
+	BackoffMax   time.Duration
+}
+
+type jobType struct {
+	handler Handler
+	timeout time.Duration
+}
+
+// Runner executes jobs on a fixed pool of workers. Jobs added with Enqueue
+// live in a bounded in-process queue and are lost on a crash; jobs added with
+// EnqueueDurable are stored through a data.JobRepository and retried with
+// backoff until they succeed or run out of attempts.
+type Runner struct {
+	cfg     Config
+	store   data.JobRepository
+	logger  *jsonlogger.Logger
+	types   map[string]jobType
+	queue   chan *data.Job
+	wake    chan struct{}
+	stop    chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	metrics *expvar.Map
+	wg      sync.WaitGroup
+	mu      sync.RWMutex
+	stopped bool
+}
+
+// New creates a runner. store may be nil, in which case only in-process jobs
+// are available.
+func New(cfg Config, store data.JobRepository, logger *jsonlogger.Logger) *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Runner{
+		cfg:     cfg,
+		store:   store,
+		logger:  logger,
+		types:   make(map[string]jobType),
+		queue:   make(chan *data.Job, cfg.QueueSize),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+		metrics: publishedMap("jobs"),
+	}
+}
+
+// Register adds a job type. A zero timeout uses the runner's default. It must
+// be called before Start.
+func (r *Runner) Register(name string, timeout time.Duration, handler Handler) {
+	if timeout <= 0 {
+		timeout = r.cfg.Timeout
+	}
+
+	r.types[name] = jobType{handler: handler, timeout: timeout}
+}
+
+func (r *Runner) Start() {
+	for i := 0; i < r.cfg.Workers; i++ {
+		r.wg.Add(1)
+		go r.worker()
+	}
+}
+
+// Enqueue adds an in-process job, failing with ErrQueueFull rather than
+// blocking the caller when the workers are behind.
+func (r *Runner) Enqueue(name string, payload any) error {
+	job, err := r.newJob(name, payload)
+	if err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.stopped {
+		return ErrStopped
+	}
+
+	select {
+	case r.queue <- job:
+		r.metrics.Add(name+".enqueued", 1)
+		return nil
+	default:
+		r.metrics.Add(name+".dropped", 1)
+		return ErrQueueFull
+	}
+}
+
+// EnqueueDurable stores a job through store, which may be bound to the
+// caller's transaction, and wakes an idle worker.
+func (r *Runner) EnqueueDurable(store data.JobRepository, name string, payload any) error {
+	job, err := r.newJob(name, payload)
+	if err != nil {
+		return err
+	}
+
+	err = store.Insert(job)
+	if err != nil {
+		return err
+	}
+
+	r.metrics.Add(name+".enqueued", 1)
+	r.notify()
+
+	return nil
+}
+
+func (r *Runner) newJob(name string, payload any) (*data.Job, error) {
+	if _, ok := r.types[name]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, name)
+	}
+
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Job{Type: name, Payload: js}, nil
+}
+
+func (r *Runner) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Shutdown stops accepting jobs and waits for queued and running ones to
+// finish. If ctx expires first, running jobs have their contexts cancelled and
+// ctx's error is returned.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.stop)
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		r.cancel()
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		return ctx.Err()
+	}
+}
+
+func (r *Runner) worker() {
+	defer r.wg.Done()
+
+	var poll <-chan time.Time
+	if r.store != nil && r.cfg.PollInterval > 0 {
+		ticker := time.NewTicker(r.cfg.PollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-r.stop:
+			r.drain()
+			return
+		case job := <-r.queue:
+			r.run(job)
+		case <-poll:
+			for r.runDurable() {
+			}
+		case <-r.wake:
+			for r.runDurable() {
+			}
+		}
+	}
+}
+
+// drain runs whatever is left in the in-process queue. Durable jobs stay in
+// the store for the next start.
+func (r *Runner) drain() {
+	for {
+		select {
+		case job := <-r.queue:
+			r.run(job)
+		default:
+			return
+		}
+	}
+}
+
+// runDurable runs one due durable job and reports whether there was one.
+func (r *Runner) runDurable() bool {
+	select {
+	case <-r.stop:
+		return false
+	default:
+	}
+
+	names := make([]string, 0, len(r.types))
+	for name := range r.types {
+		names = append(names, name)
+	}
+
+	job, err := r.store.Claim(names, lease)
+	if err != nil {
+		if !errors.Is(err, data.ErrNoRecordFound) {
+			r.logger.PrintError(err, nil)
+		}
+		return false
+	}
+
+	err = r.run(job)
+	if err == nil {
+		err = r.store.Complete(job.ID)
+		if err != nil {
+			r.logger.PrintError(err, nil)
+		}
+		return true
+	}
+
+	dead := job.Attempts >= r.cfg.MaxAttempts
+	if dead {
+		r.metrics.Add(job.Type+".dead", 1)
+	}
+
+	err = r.store.Fail(job.ID, err.Error(), Backoff(job.Attempts, r.cfg.BackoffBase, r.cfg.BackoffMax), dead)
+	if err != nil {
+		r.logger.PrintError(err, nil)
+	}
+
+	return true
+}
+
+// run executes job with its type's timeout. A panicking handler is reported
+// as a failed job instead of taking the worker down.
+func (r *Runner) run(job *data.Job) (err error) {
+	jt := r.types[job.Type]
+
+	ctx, cancel := context.WithTimeout(r.ctx, jt.timeout)
+	defer cancel()
+
+	r.metrics.Add(job.Type+".running", 1)
+	start := time.Now()
+
+	defer func() {
+		if p := recover(); p != nil {
+			r.metrics.Add(job.Type+".panicked", 1)
+			err = fmt.Errorf("jobs: %s panicked: %v\n%s", job.Type, p, debug.Stack())
+		}
+
+		r.metrics.Add(job.Type+".running", -1)
+
+		properties := map[string]string{
+			"job":      job.Type,
+			"duration": time.Since(start).String(),
+		}
+		if job.ID != 0 {
+			properties["job_id"] = strconv.FormatInt(job.ID, 10)
+			properties["attempt"] = strconv.Itoa(job.Attempts)
+		}
+
+		if err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				r.metrics.Add(job.Type+".timed_out", 1)
+			}
+			r.metrics.Add(job.Type+".failed", 1)
+			r.logger.PrintError(err, properties)
+			return
+		}
+
+		r.metrics.Add(job.Type+".succeeded", 1)
+	}()
+
+	return jt.handler(ctx, job.Payload)
+}
+
+// Backoff doubles the delay with every attempt up to max, then picks a random
+// point in the upper half so that retries from many jobs spread out.
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	// stop doubling before the delay could pass max, or overflow
+	d := min(base, max)
+	for i := 1; i < attempt && d < max; i++ {
+		if d > max/2 {
+			d = max
+		} else {
+			d *= 2
+		}
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// publishedMap returns the expvar map called name, creating it on first use.
+// Runners can be created more than once in a process (tests do), and
+// expvar.NewMap panics on duplicates.
+func publishedMap(name string) *expvar.Map {
+	if v, ok := expvar.Get(name).(*expvar.Map); ok {
+		return v
+	}
+
+	return expvar.NewMap(name)
+}
@@ -0,0 +1,234 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/data"
+	"github.com/PriyanshuSharma23/greenlight/internal/jsonlogger"
+)
+
+func newTestRunner(store data.JobRepository) *Runner {
+	return New(Config{
+		Workers:      2,
+		QueueSize:    10,
+		MaxAttempts:  3,
+		Timeout:      time.Second,
+		PollInterval: 5 * time.Millisecond,
+		BackoffBase:  time.Millisecond,
+		BackoffMax:   time.Millisecond,
+	}, store, jsonlogger.NewLogger(io.Discard, jsonlogger.LevelOff))
+}
+
+func TestRunnerRecoversPanics(t *testing.T) {
+	r := newTestRunner(nil)
+
+	var ran atomic.Int32
+	r.Register("panics", 0, func(ctx context.Context, payload json.RawMessage) error {
+		panic("boom")
+	})
+	r.Register("counts", 0, func(ctx context.Context, payload json.RawMessage) error {
+		ran.Add(1)
+		return nil
+	})
+	r.Start()
+
+	for _, name := range []string{"panics", "counts", "panics", "counts"} {
+		if err := r.Enqueue(name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := r.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown after panics: %v", err)
+	}
+
+	if got := ran.Load(); got != 2 {
+		t.Errorf("got %d jobs run after panics; want 2", got)
+	}
+}
+
+func TestRunnerTimeout(t *testing.T) {
+	r := newTestRunner(nil)
+
+	result := make(chan error, 1)
+	r.Register("slow", 10*time.Millisecond, func(ctx context.Context, payload json.RawMessage) error {
+		<-ctx.Done()
+		result <- ctx.Err()
+		return ctx.Err()
+	})
+	r.Start()
+	defer r.Shutdown(context.Background())
+
+	if err := r.Enqueue("slow", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got %v; want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("job was not cancelled at its timeout")
+	}
+}
+
+func TestRunnerEnqueue(t *testing.T) {
+	r := newTestRunner(nil)
+	r.cfg.QueueSize = 1
+	r.queue = make(chan *data.Job, 1)
+	r.Register("noop", 0, func(ctx context.Context, payload json.RawMessage) error { return nil })
+
+	if err := r.Enqueue("missing", nil); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("unknown type: got %v; want %v", err, ErrUnknownType)
+	}
+
+	if err := r.Enqueue("noop", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Enqueue("noop", nil); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("full queue: got %v; want %v", err, ErrQueueFull)
+	}
+
+	r.Shutdown(context.Background())
+
+	if err := r.Enqueue("noop", nil); !errors.Is(err, ErrStopped) {
+		t.Errorf("after shutdown: got %v; want %v", err, ErrStopped)
+	}
+}
+
+func TestRunnerDurable(t *testing.T) {
+	store := data.NewMemoryModels(nil).Jobs
+	r := newTestRunner(store)
+
+	type payload struct {
+		N int `json:"n"`
+	}
+
+	var attempts atomic.Int32
+	done := make(chan payload, 1)
+
+	r.Register("flaky", 0, func(ctx context.Context, raw json.RawMessage) error {
+		if attempts.Add(1) < 2 {
+			return errors.New("temporary failure")
+		}
+
+		var p payload
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return err
+		}
+		done <- p
+		return nil
+	})
+	r.Register("broken", 0, func(ctx context.Context, raw json.RawMessage) error {
+		return errors.New("permanent failure")
+	})
+	r.Start()
+	defer r.Shutdown(context.Background())
+
+	if err := r.EnqueueDurable(store, "flaky", payload{N: 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case p := <-done:
+		if p.N != 7 {
+			t.Errorf("got payload %d; want 7", p.N)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("durable job was not retried")
+	}
+
+	if err := r.EnqueueDurable(store, "broken", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if r.metrics.Get("broken.dead") != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("failing job was never marked dead")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, err := store.Claim([]string{"flaky", "broken"}, time.Minute); !errors.Is(err, data.ErrNoRecordFound) {
+		t.Errorf("got %v claiming finished jobs; want %v", err, data.ErrNoRecordFound)
+	}
+}
+
+func TestRunnerShutdownDeadline(t *testing.T) {
+	r := newTestRunner(nil)
+
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	r.Register("stuck", time.Hour, func(ctx context.Context, payload json.RawMessage) error {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+	r.Start()
+
+	if err := r.Enqueue("stuck", nil); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := r.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("running job was not cancelled after the drain deadline")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		attempt int
+		base    time.Duration
+		max     time.Duration
+		want    time.Duration
+	}{
+		{"first attempt", 1, 10 * time.Second, time.Hour, 10 * time.Second},
+		{"zero attempt", 0, 10 * time.Second, time.Hour, 10 * time.Second},
+		{"negative attempt", -5, 10 * time.Second, time.Hour, 10 * time.Second},
+		{"doubled", 3, 10 * time.Second, time.Hour, 40 * time.Second},
+		{"capped", 10, 10 * time.Second, time.Hour, time.Hour},
+		{"shift would overflow", 31, 10 * time.Second, time.Hour, time.Hour},
+		{"past int64 bits", 64, 10 * time.Second, time.Hour, time.Hour},
+		{"huge attempt", math.MaxInt, 10 * time.Second, time.Hour, time.Hour},
+		{"huge max", 100, time.Second, math.MaxInt64, math.MaxInt64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				got := Backoff(tt.attempt, tt.base, tt.max)
+				if got < tt.want/2 || got > tt.want {
+					t.Fatalf("got %v; want between %v and %v", got, tt.want/2, tt.want)
+				}
+			}
+		})
+	}
+}
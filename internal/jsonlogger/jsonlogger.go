@@ -2,9 +2,11 @@ package jsonlogger
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 )
@@ -31,6 +33,21 @@ func (l Level) String() string {
 	}
 }
 
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "info":
+		return LevelInfo, nil
+	case "error":
+		return LevelError, nil
+	case "fatal":
+		return LevelFatal, nil
+	case "off":
+		return LevelOff, nil
+	default:
+		return LevelInfo, fmt.Errorf("jsonlogger: unknown level %q", s)
+	}
+}
+
 type Logger struct {
 	out      io.Writer
 	minLevel Level
@@ -45,6 +62,15 @@ func NewLogger(out io.Writer, minLevel Level) *Logger {
 	return logger
 }
 
+// SetLevel changes the minimum level of the messages written by l. It is safe
+// to call while other goroutines are logging.
+func (l *Logger) SetLevel(level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.minLevel = level
+}
+
 func (l *Logger) PrintInfo(message string, properties map[string]string) {
 	l.print(LevelInfo, message, properties)
 }
@@ -59,7 +85,11 @@ func (l *Logger) PrintFatal(err error, properties map[string]string) {
 }
 
 func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
-	if l.minLevel > level {
+	l.mu.Lock()
+	minLevel := l.minLevel
+	l.mu.Unlock()
+
+	if minLevel > level {
 		return 0, nil
 	}
 
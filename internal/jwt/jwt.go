@@ -0,0 +1,262 @@
+// Package jwt signs and verifies compact JSON Web Tokens (RFC 7519) with
+// HS256 or EdDSA (Ed25519) keys. Tokens name their key in the kid header, so
+// that keys can be rotated: a KeySet signs with one key and verifies with any
+// of them.
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HS256 = "HS256"
+	EdDSA = "EdDSA"
+)
+
+var (
+	ErrInvalid    = errors.New("jwt: invalid token")
+	ErrExpired    = errors.New("jwt: token has expired")
+	ErrUnknownKey = errors.New("jwt: unknown key")
+)
+
+var encoding = base64.RawURLEncoding
+
+// Key is a named signing key.
+type Key struct {
+	ID        string
+	Algorithm string
+	secret    []byte
+	private   ed25519.PrivateKey
+	public    ed25519.PublicKey
+}
+
+// NewHS256Key returns an HMAC-SHA256 key. RFC 7518 requires the secret to be
+// at least as long as the hash, 32 bytes.
+func NewHS256Key(id string, secret []byte) (*Key, error) {
+	if len(secret) < sha256.Size {
+		return nil, fmt.Errorf("jwt: key %q: HS256 secret must be at least %d bytes", id, sha256.Size)
+	}
+
+	return &Key{ID: id, Algorithm: HS256, secret: secret}, nil
+}
+
+// NewEd25519Key returns an Ed25519 key derived from a 32-byte seed.
+func NewEd25519Key(id string, seed []byte) (*Key, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("jwt: key %q: Ed25519 seed must be %d bytes", id, ed25519.SeedSize)
+	}
+
+	private := ed25519.NewKeyFromSeed(seed)
+
+	return &Key{ID: id, Algorithm: EdDSA, private: private, public: private.Public().(ed25519.PublicKey)}, nil
+}
+
+// ParseKey reads a key written as "id:algorithm:base64", where the base64
+// (standard or URL alphabet, padding optional) is an HS256 secret or an
+// Ed25519 seed.
+func ParseKey(spec string) (*Key, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return nil, errors.New(`jwt: key must be written as "id:algorithm:base64"`)
+	}
+
+	id, alg, encoded := parts[0], parts[1], strings.TrimRight(parts[2], "=")
+
+	raw, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		raw, err = encoding.DecodeString(encoded)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("jwt: key %q: invalid base64", id)
+	}
+
+	switch alg {
+	case HS256:
+		return NewHS256Key(id, raw)
+	case EdDSA:
+		return NewEd25519Key(id, raw)
+	default:
+		return nil, fmt.Errorf("jwt: key %q: algorithm must be %s or %s", id, HS256, EdDSA)
+	}
+}
+
+func (k *Key) sign(input []byte) []byte {
+	if k.Algorithm == EdDSA {
+		return ed25519.Sign(k.private, input)
+	}
+
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(input)
+	return mac.Sum(nil)
+}
+
+func (k *Key) verify(input, signature []byte) bool {
+	if k.Algorithm == EdDSA {
+		return ed25519.Verify(k.public, input, signature)
+	}
+
+	return hmac.Equal(k.sign(input), signature)
+}
+
+// KeySet holds the keys tokens may be verified with, one of which is used
+// to sign new tokens.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewKeySet returns a set signing with the key named signingID, or the first
+// key when signingID is empty.
+func NewKeySet(signingID string, keys ...*Key) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("jwt: no keys")
+	}
+
+	ks := &KeySet{keys: make(map[string]*Key, len(keys))}
+
+	for _, k := range keys {
+		if _, ok := ks.keys[k.ID]; ok {
+			return nil, fmt.Errorf("jwt: duplicate key %q", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+
+	if signingID == "" {
+		signingID = keys[0].ID
+	}
+
+	ks.signing = ks.keys[signingID]
+	if ks.signing == nil {
+		return nil, fmt.Errorf("jwt: signing key %q is not in the set", signingID)
+	}
+
+	return ks, nil
+}
+
+// NumericDate is a JWT time. It is written with millisecond precision, which
+// RFC 7519 allows, so that tokens issued within the same second can still be
+// ordered.
+type NumericDate struct {
+	time.Time
+}
+
+func (d NumericDate) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatFloat(float64(d.UnixMilli())/1000, 'f', -1, 64)), nil
+}
+
+func (d *NumericDate) UnmarshalJSON(b []byte) error {
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return err
+	}
+
+	d.Time = time.UnixMilli(int64(math.Round(f * 1000)))
+	return nil
+}
+
+// RegisteredClaims are the standard claims checked by Verify. Embed it in a
+// struct to add claims of your own.
+type RegisteredClaims struct {
+	Issuer   string      `json:"iss,omitempty"`
+	Subject  string      `json:"sub,omitempty"`
+	ID       string      `json:"jti,omitempty"`
+	IssuedAt NumericDate `json:"iat"`
+	Expiry   NumericDate `json:"exp"`
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid"`
+}
+
+// Sign encodes claims as a token signed with the set's signing key.
+func (ks *KeySet) Sign(claims any) (string, error) {
+	h, err := json.Marshal(header{Algorithm: ks.signing.Algorithm, Type: "JWT", KeyID: ks.signing.ID})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := encoding.EncodeToString(h) + "." + encoding.EncodeToString(payload)
+	signature := ks.signing.sign([]byte(input))
+
+	return input + "." + encoding.EncodeToString(signature), nil
+}
+
+// Verify checks the token's signature, that it was issued by issuer and that
+// it hasn't expired at now, then decodes its claims into dst.
+func (ks *KeySet) Verify(token, issuer string, now time.Time, dst any) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalid
+	}
+
+	rawHeader, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return ErrInvalid
+	}
+
+	var h header
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return ErrInvalid
+	}
+
+	key, ok := ks.keys[h.KeyID]
+	if !ok {
+		return ErrUnknownKey
+	}
+
+	// the algorithm comes from the key, never from the token
+	if h.Algorithm != key.Algorithm {
+		return ErrInvalid
+	}
+
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil || !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return ErrInvalid
+	}
+
+	payload, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return ErrInvalid
+	}
+
+	var registered RegisteredClaims
+	if err := json.Unmarshal(payload, &registered); err != nil {
+		return ErrInvalid
+	}
+
+	if registered.Issuer != issuer || registered.Expiry.IsZero() {
+		return ErrInvalid
+	}
+
+	if !now.Before(registered.Expiry.Time) {
+		return ErrExpired
+	}
+
+	if err := json.Unmarshal(payload, dst); err != nil {
+		return ErrInvalid
+	}
+
+	return nil
+}
+
+// IsToken reports whether s has the shape of a compact JWT.
+func IsToken(s string) bool {
+	return strings.Count(s, ".") == 2
+}
@@ -0,0 +1,207 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testClaims struct {
+	RegisteredClaims
+	Admin bool `json:"admin"`
+}
+
+func newTestKeys(t *testing.T) (*Key, *Key) {
+	t.Helper()
+
+	hs, err := NewHS256Key("hs-1", bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ed, err := NewEd25519Key("ed-1", bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hs, ed
+}
+
+func newClaims(now time.Time) testClaims {
+	return testClaims{
+		RegisteredClaims: RegisteredClaims{
+			Issuer:   "greenlight",
+			Subject:  "42",
+			ID:       "abc",
+			IssuedAt: NumericDate{now},
+			Expiry:   NumericDate{now.Add(time.Minute)},
+		},
+		Admin: true,
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	hs, ed := newTestKeys(t)
+	now := time.Now()
+
+	for _, key := range []*Key{hs, ed} {
+		t.Run(key.Algorithm, func(t *testing.T) {
+			ks, err := NewKeySet(key.ID, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := ks.Sign(newClaims(now))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got testClaims
+			if err := ks.Verify(token, "greenlight", now, &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Subject != "42" || !got.Admin || got.IssuedAt.UnixMilli() != now.UnixMilli() {
+				t.Errorf("got claims %+v", got)
+			}
+		})
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	hs, ed := newTestKeys(t)
+	now := time.Now()
+
+	ks, err := NewKeySet("", hs, ed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := ks.Sign(newClaims(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(token, ".")
+
+	// a token claiming to be signed with "none" under the same key id
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"hs-1"}`))
+
+	otherKey, err := NewHS256Key("hs-1", bytes.Repeat([]byte{3}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherSet, err := NewKeySet("", otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forged, err := otherSet.Sign(newClaims(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		issuer  string
+		now     time.Time
+		wantErr error
+	}{
+		{"Expired", token, "greenlight", now.Add(time.Minute), ErrExpired},
+		{"Wrong issuer", token, "someone-else", now, ErrInvalid},
+		{"Tampered payload", parts[0] + "." + parts[1] + "x." + parts[2], "greenlight", now, ErrInvalid},
+		{"Algorithm none", none + "." + parts[1] + ".", "greenlight", now, ErrInvalid},
+		{"Wrong secret", forged, "greenlight", now, ErrInvalid},
+		{"Malformed", "not-a-token", "greenlight", now, ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testClaims
+			if err := ks.Verify(tt.token, tt.issuer, tt.now, &got); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	hs, ed := newTestKeys(t)
+	now := time.Now()
+
+	before, err := NewKeySet("hs-1", hs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := before.Sign(newClaims(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the new key signs while the old one still verifies
+	during, err := NewKeySet("ed-1", hs, ed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fresh, err := during.Sign(newClaims(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims testClaims
+	for _, token := range []string{old, fresh} {
+		if err := during.Verify(token, "greenlight", now, &claims); err != nil {
+			t.Errorf("during rotation: %v", err)
+		}
+	}
+
+	after, err := NewKeySet("", ed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := after.Verify(old, "greenlight", now, &claims); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("retired key: got %v; want %v", err, ErrUnknownKey)
+	}
+
+	if err := after.Verify(fresh, "greenlight", now, &claims); err != nil {
+		t.Errorf("after rotation: %v", err)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	secret := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+
+	tests := []struct {
+		spec    string
+		wantAlg string
+	}{
+		{"k1:HS256:" + secret, HS256},
+		{"k2:EdDSA:" + base64.RawURLEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32)), EdDSA},
+		{"k3:HS256:" + base64.StdEncoding.EncodeToString([]byte("short")), ""},
+		{"k4:RS256:" + secret, ""},
+		{"k5:HS256:not base64!", ""},
+		{"HS256:" + secret, ""},
+	}
+
+	for _, tt := range tests {
+		key, err := ParseKey(tt.spec)
+		if tt.wantAlg == "" {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.spec)
+			}
+			continue
+		}
+
+		if err != nil || key.Algorithm != tt.wantAlg {
+			t.Errorf("%s: got %v, %v", tt.spec, key, err)
+		}
+	}
+}
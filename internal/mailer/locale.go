@@ -0,0 +1,114 @@
+package mailer
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale is the language of the untranslated templates, which every
+// other locale falls back to.
+const DefaultLocale = "en"
+
+// Lookup returns the path of the most specific translation of templateFile
+// for locale, along with the locale of that translation. For
+// "user_welcome.tmpl" and "pt-BR" it tries user_welcome.pt-BR.tmpl, then
+// user_welcome.pt.tmpl, then the English user_welcome.tmpl.
+func Lookup(templateFile, locale string) (string, string) {
+	name := strings.TrimSuffix(templateFile, ".tmpl")
+
+	for _, candidate := range candidates(locale) {
+		if candidate == DefaultLocale {
+			break
+		}
+
+		p := path.Join("templates", name+"."+candidate+".tmpl")
+		if _, err := fs.Stat(templateFs, p); err == nil {
+			return p, candidate
+		}
+	}
+
+	return path.Join("templates", templateFile), DefaultLocale
+}
+
+// candidates lists locale followed by its bare language, e.g. "pt-BR", "pt".
+func candidates(locale string) []string {
+	lang, _, ok := strings.Cut(locale, "-")
+	if !ok {
+		return []string{locale}
+	}
+
+	return []string{locale, lang}
+}
+
+// Locales lists the locales with translated partials, which is what makes a
+// language available to users.
+func Locales() []string {
+	locales := []string{DefaultLocale}
+
+	matches, _ := fs.Glob(templateFs, "templates/partials.*.tmpl")
+	for _, m := range matches {
+		locales = append(locales, strings.TrimSuffix(strings.TrimPrefix(path.Base(m), "partials."), ".tmpl"))
+	}
+
+	sort.Strings(locales)
+
+	return locales
+}
+
+// MatchLocale picks the available locale that best satisfies an
+// Accept-Language header, so "es-MX,es;q=0.9,en;q=0.8" gives "es" when there
+// is a Spanish translation. It returns DefaultLocale when nothing matches.
+func MatchLocale(acceptLanguage string) string {
+	type preference struct {
+		tag string
+		q   float64
+	}
+
+	var prefs []preference
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+
+		if tag == "" || tag == "*" || q <= 0 {
+			continue
+		}
+
+		prefs = append(prefs, preference{tag: canonicalLocale(tag), q: q})
+	}
+
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+
+	available := Locales()
+	for _, p := range prefs {
+		for _, candidate := range candidates(p.tag) {
+			i := sort.SearchStrings(available, candidate)
+			if i < len(available) && available[i] == candidate {
+				return candidate
+			}
+		}
+	}
+
+	return DefaultLocale
+}
+
+// canonicalLocale normalises the case of a language tag, so "PT-br" becomes
+// "pt-BR".
+func canonicalLocale(tag string) string {
+	lang, region, ok := strings.Cut(tag, "-")
+	if !ok {
+		return strings.ToLower(lang)
+	}
+
+	return strings.ToLower(lang) + "-" + strings.ToUpper(region)
+}
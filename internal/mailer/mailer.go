@@ -6,36 +6,56 @@ import (
 	"errors"
 	"html/template"
 	"time"
-
-	"github.com/go-mail/mail/v2"
 )
 
 //go:embed "templates"
 var templateFs embed.FS
 
+// Message is a rendered email ready to be handed to a Sender.
+type Message struct {
+	To        string
+	From      string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+}
+
+// Sender delivers rendered messages. SMTPSender talks to a real relay, while
+// FileSender, LogSender and MemorySender keep email local for development
+// and tests.
+type Sender interface {
+	Send(msg *Message) error
+}
+
 type Mailer struct {
-	dialer  *mail.Dialer
-	sender  string
+	sender  Sender
+	from    string
 	retries int
 }
 
-func New(host string, port int, username, password, sender string, retries int) (Mailer, error) {
-	dialer := mail.NewDialer(host, port, username, password)
-	dialer.Timeout = 5 * time.Second
-
+func New(sender Sender, from string, retries int) (Mailer, error) {
 	if retries < 1 {
 		return Mailer{}, errors.New("mailer: retries must be >= 1")
 	}
 
 	return Mailer{
-		dialer:  dialer,
 		sender:  sender,
+		from:    from,
 		retries: retries,
 	}, nil
 }
 
-func (m Mailer) Send(recipient string, templateFile string, data any) error {
-	templ, err := template.New("email").ParseFS(templateFs, "templates/"+templateFile)
+// Send renders templateFile in the given locale and delivers it. Locales
+// without a translation fall back to English; see Lookup.
+func (m Mailer) Send(recipient, templateFile, locale string, data any) error {
+	content, locale := Lookup(templateFile, locale)
+	partials, _ := Lookup("partials.tmpl", locale)
+
+	templ := template.New("email").Funcs(template.FuncMap{
+		"locale": func() string { return locale },
+	})
+
+	templ, err := templ.ParseFS(templateFs, "templates/layout.tmpl", "templates/partials.tmpl", partials, content)
 	if err != nil {
 		return err
 	}
@@ -58,21 +78,24 @@ func (m Mailer) Send(recipient string, templateFile string, data any) error {
 		return err
 	}
 
-	msg := mail.NewMessage()
-	msg.SetHeader("To", recipient)
-	msg.SetHeader("From", m.sender)
-	msg.SetHeader("Subject", subject.String())
-	msg.SetBody("text/plain", plainBody.String())
-	msg.AddAlternative("text/html", htmlBody.String())
+	msg := &Message{
+		To:        recipient,
+		From:      m.from,
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	}
 
 	for i := 0; i < m.retries; i++ {
-		err = m.dialer.DialAndSend(msg)
+		err = m.sender.Send(msg)
 
 		if nil == err {
 			return nil
 		}
 
-		time.Sleep(time.Millisecond * 500)
+		if i < m.retries-1 {
+			time.Sleep(time.Millisecond * 500)
+		}
 	}
 
 	return err
@@ -0,0 +1,142 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMailerRendersTemplate(t *testing.T) {
+	sender := NewMemorySender()
+
+	m, err := New(sender, "Greenlight <test@greenlight.local>", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("alice@example.com", "user_welcome.tmpl", "en", map[string]any{
+		"userID":          1,
+		"activationToken": "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := sender.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages; want 1", len(messages))
+	}
+
+	msg := messages[0]
+	if msg.To != "alice@example.com" || msg.Subject != "Welcome to Greenlight" {
+		t.Errorf("got to %q subject %q", msg.To, msg.Subject)
+	}
+
+	if !strings.Contains(msg.PlainBody, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") || !strings.Contains(msg.HTMLBody, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") {
+		t.Errorf("activation token missing from body")
+	}
+}
+
+func TestMailerLocalizedTemplate(t *testing.T) {
+	tests := []struct {
+		locale      string
+		wantSubject string
+		wantLang    string
+		wantSignoff string
+	}{
+		{"es", "Te damos la bienvenida a Greenlight", `lang="es"`, "El equipo de Greenlight"},
+		{"es-MX", "Te damos la bienvenida a Greenlight", `lang="es"`, "El equipo de Greenlight"},
+		{"fr", "Welcome to Greenlight", `lang="en"`, "The Greenlight Team"},
+		{"", "Welcome to Greenlight", `lang="en"`, "The Greenlight Team"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			sender := NewMemorySender()
+
+			m, err := New(sender, "Greenlight <test@greenlight.local>", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = m.Send("alice@example.com", "user_welcome.tmpl", tt.locale, map[string]any{
+				"userID":          1,
+				"activationToken": "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg := sender.Messages()[0]
+			if msg.Subject != tt.wantSubject {
+				t.Errorf("got subject %q; want %q", msg.Subject, tt.wantSubject)
+			}
+
+			if !strings.Contains(msg.HTMLBody, tt.wantLang) {
+				t.Errorf("html body missing %s", tt.wantLang)
+			}
+
+			if !strings.Contains(msg.PlainBody, tt.wantSignoff) || !strings.Contains(msg.HTMLBody, tt.wantSignoff) {
+				t.Errorf("body missing sign-off %q", tt.wantSignoff)
+			}
+		})
+	}
+}
+
+func TestMatchLocale(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"es", "es"},
+		{"ES-mx", "es"},
+		{"fr-CH, fr;q=0.9, es;q=0.8, en;q=0.7", "es"},
+		{"en;q=0.9, es", "es"},
+		{"es;q=0, en", "en"},
+		{"de, *;q=0.5", "en"},
+	}
+
+	for _, tt := range tests {
+		if got := MatchLocale(tt.header); got != tt.want {
+			t.Errorf("MatchLocale(%q) = %q; want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestFileSender(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+
+	sender, err := NewFileSender(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sender.Send(&Message{
+		To:        "alice@example.com",
+		From:      "test@greenlight.local",
+		Subject:   "Hello",
+		PlainBody: "plain body",
+		HTMLBody:  "<p>html body</p>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*alice@example.com.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("got files %v, err %v", files, err)
+	}
+
+	raw, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"Subject: Hello", "To: alice@example.com", "plain body"} {
+		if !strings.Contains(string(raw), want) {
+			t.Errorf("eml file missing %q", want)
+		}
+	}
+}
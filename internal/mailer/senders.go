@@ -0,0 +1,123 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/jsonlogger"
+	"github.com/go-mail/mail/v2"
+)
+
+func newMailMessage(msg *Message) *mail.Message {
+	m := mail.NewMessage()
+	m.SetHeader("To", msg.To)
+	m.SetHeader("From", msg.From)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.PlainBody)
+	m.AddAlternative("text/html", msg.HTMLBody)
+
+	return m
+}
+
+type SMTPSender struct {
+	dialer *mail.Dialer
+}
+
+func NewSMTPSender(host string, port int, username, password string) *SMTPSender {
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = 5 * time.Second
+
+	return &SMTPSender{dialer: dialer}
+}
+
+func (s *SMTPSender) Send(msg *Message) error {
+	return s.dialer.DialAndSend(newMailMessage(msg))
+}
+
+// FileSender writes every message as an .eml file in a directory, where it
+// can be opened with any mail client.
+type FileSender struct {
+	dir string
+}
+
+func NewFileSender(dir string) (*FileSender, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSender{dir: dir}, nil
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]+`)
+
+func (s *FileSender) Send(msg *Message) error {
+	name := fmt.Sprintf("%s-%s.eml",
+		time.Now().UTC().Format("20060102T150405.000000000"),
+		unsafeFileChars.ReplaceAllString(msg.To, "_"),
+	)
+
+	f, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	_, err = newMailMessage(msg).WriteTo(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// LogSender writes messages to the application log instead of sending them.
+type LogSender struct {
+	logger *jsonlogger.Logger
+}
+
+func NewLogSender(logger *jsonlogger.Logger) *LogSender {
+	return &LogSender{logger: logger}
+}
+
+func (s *LogSender) Send(msg *Message) error {
+	s.logger.PrintInfo("email not sent, logged instead", map[string]string{
+		"to":      msg.To,
+		"from":    msg.From,
+		"subject": msg.Subject,
+		"body":    msg.PlainBody,
+	})
+
+	return nil
+}
+
+// MemorySender keeps every message in memory for later inspection.
+type MemorySender struct {
+	messages []Message
+	mu       sync.Mutex
+}
+
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+func (s *MemorySender) Send(msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, *msg)
+
+	return nil
+}
+
+// Messages returns a copy of the messages sent so far, oldest first.
+func (s *MemorySender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
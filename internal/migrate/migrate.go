@@ -0,0 +1,343 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/jsonlogger"
+)
+
+// lockID is the key of the Postgres advisory lock held while migrating, so
+// that several instances started together don't race each other.
+const lockID = 7_351_204_923
+
+var (
+	ErrDirty          = errors.New("migrate: database is dirty, fix the failed migration and force a version")
+	ErrUnknownVersion = errors.New("migrate: unknown migration version")
+)
+
+var fileRx = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Name    string
+	up      string
+	down    string
+	Version int64
+}
+
+type Status struct {
+	Migration
+	Applied bool
+}
+
+type Migrator struct {
+	db         *sql.DB
+	fsys       fs.FS
+	logger     *jsonlogger.Logger
+	migrations []Migration
+}
+
+// New reads the migration files at the root of fsys. Files are named
+// {version}_{name}.up.sql and {version}_{name}.down.sql, as created by
+// `migrate create -seq`.
+func New(db *sql.DB, fsys fs.FS, logger *jsonlogger.Logger) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+
+	for _, entry := range entries {
+		match := fileRx.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migrate: invalid version in %s", entry.Name())
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+
+		if match[3] == "up" {
+			m.up = entry.Name()
+		} else {
+			m.down = entry.Name()
+		}
+	}
+
+	migrator := &Migrator{db: db, fsys: fsys, logger: logger}
+
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migrate: version %d must have both an up and a down file", m.Version)
+		}
+		migrator.migrations = append(migrator.migrations, *m)
+	}
+
+	sort.Slice(migrator.migrations, func(i, j int) bool {
+		return migrator.migrations[i].Version < migrator.migrations[j].Version
+	})
+
+	return migrator, nil
+}
+
+// Latest returns the highest version known to the migrator, or 0 if there
+// are no migrations.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every migration newer than the current version.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		return m.migrateTo(ctx, conn, m.Latest())
+	})
+}
+
+// Down rolls back the given number of applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		current, dirty, err := readVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return ErrDirty
+		}
+
+		target := current
+		for i := 0; i < steps && target > 0; i++ {
+			target = m.previous(target)
+		}
+
+		return m.migrateTo(ctx, conn, target)
+	})
+}
+
+// Goto migrates up or down until version is the current version. Version 0
+// rolls back every migration.
+func (m *Migrator) Goto(ctx context.Context, version int64) error {
+	if version != 0 && m.index(version) < 0 {
+		return ErrUnknownVersion
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		return m.migrateTo(ctx, conn, version)
+	})
+}
+
+// Force records version as the current, clean version without running any
+// migrations. It is used to recover after a migration failed half-way.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	if version < 0 {
+		return ErrUnknownVersion
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		return writeVersion(ctx, conn, version, false)
+	})
+}
+
+// Status reports the current version and whether each known migration has
+// been applied.
+func (m *Migrator) Status(ctx context.Context) (int64, bool, []Status, error) {
+	var (
+		current  int64
+		dirty    bool
+		statuses []Status
+	)
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		var err error
+		current, dirty, err = readVersion(ctx, conn)
+		return err
+	})
+	if err != nil {
+		return 0, false, nil, err
+	}
+
+	for _, migration := range m.migrations {
+		statuses = append(statuses, Status{
+			Migration: migration,
+			Applied:   migration.Version <= current,
+		})
+	}
+
+	return current, dirty, statuses, nil
+}
+
+func (m *Migrator) migrateTo(ctx context.Context, conn *sql.Conn, target int64) error {
+	current, dirty, err := readVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return ErrDirty
+	}
+
+	if current != 0 && m.index(current) < 0 {
+		return fmt.Errorf("%w: database is at version %d", ErrUnknownVersion, current)
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version <= current || migration.Version > target {
+			continue
+		}
+
+		err = m.run(ctx, conn, migration.up, migration.Version, migration.Version, "up")
+		if err != nil {
+			return err
+		}
+	}
+
+	for current > target {
+		migration := m.migrations[m.index(current)]
+		previous := m.previous(current)
+
+		err = m.run(ctx, conn, migration.down, migration.Version, previous, "down")
+		if err != nil {
+			return err
+		}
+
+		current = previous
+	}
+
+	return nil
+}
+
+// run executes a single migration file. The version is marked dirty while the
+// file runs, so a failure leaves a record that needs manual attention.
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, file string, version, next int64, direction string) error {
+	stmt, err := fs.ReadFile(m.fsys, file)
+	if err != nil {
+		return err
+	}
+
+	err = writeVersion(ctx, conn, next, true)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, string(stmt))
+	if err != nil {
+		return fmt.Errorf("migrate: %s: %w", file, err)
+	}
+
+	err = writeVersion(ctx, conn, next, false)
+	if err != nil {
+		return err
+	}
+
+	if m.logger != nil {
+		m.logger.PrintInfo("applied migration", map[string]string{
+			"version":   strconv.FormatInt(version, 10),
+			"name":      m.migrations[m.index(version)].Name,
+			"direction": direction,
+		})
+	}
+
+	return nil
+}
+
+func (m *Migrator) index(version int64) int {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (m *Migrator) previous(version int64) int64 {
+	i := m.index(version)
+	if i <= 0 {
+		return 0
+	}
+
+	return m.migrations[i-1].Version
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+
+	_, err = conn.ExecContext(ctx, `
+          CREATE TABLE IF NOT EXISTS schema_migrations (
+            version bigint NOT NULL PRIMARY KEY,
+            dirty boolean NOT NULL
+          )`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// readVersion returns 0 when no migration has been applied yet.
+func readVersion(ctx context.Context, conn *sql.Conn) (int64, bool, error) {
+	var (
+		version int64
+		dirty   bool
+	)
+
+	err := conn.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	return version, dirty, nil
+}
+
+// writeVersion keeps the single-row layout used by golang-migrate so that
+// databases migrated by the external tool continue to work.
+func writeVersion(ctx context.Context, conn *sql.Conn, version int64, dirty bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+
+	if version > 0 {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)`, version, dirty)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,261 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+var testMigrations = fstest.MapFS{
+	"000001_create_a.up.sql":   {Data: []byte(`CREATE TABLE a (id int)`)},
+	"000001_create_a.down.sql": {Data: []byte(`DROP TABLE a`)},
+	"000002_create_b.up.sql":   {Data: []byte(`CREATE TABLE b (id int)`)},
+	"000002_create_b.down.sql": {Data: []byte(`DROP TABLE b`)},
+}
+
+// newTestDB returns a connection to a schema of its own in the database at
+// GREENLIGHT_TEST_DB_DSN, skipping the test if that isn't set.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("GREENLIGHT_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("GREENLIGHT_TEST_DB_DSN is not set")
+	}
+
+	schema := fmt.Sprintf("test_migrate_%d", time.Now().UnixNano())
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		dsn = u.String()
+	} else {
+		dsn += " search_path='" + schema + "'"
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	return db
+}
+
+func newTestMigrator(t *testing.T, db *sql.DB, fsys fstest.MapFS) *Migrator {
+	t.Helper()
+
+	m, err := New(db, fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func assertVersion(t *testing.T, m *Migrator, version int64, dirty bool) {
+	t.Helper()
+
+	gotVersion, gotDirty, _, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gotVersion != version || gotDirty != dirty {
+		t.Fatalf("got version %d dirty %t; want version %d dirty %t", gotVersion, gotDirty, version, dirty)
+	}
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+
+	var exists bool
+
+	err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return exists
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{"Missing down", fstest.MapFS{"000001_a.up.sql": {}}},
+		{"Missing up", fstest.MapFS{"000001_a.down.sql": {}}},
+		{"Zero version", fstest.MapFS{"000000_a.up.sql": {}, "000000_a.down.sql": {}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(nil, tt.fsys, nil); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+func TestGotoUnknownVersion(t *testing.T) {
+	m := newTestMigrator(t, nil, testMigrations)
+
+	if got := m.Latest(); got != 2 {
+		t.Errorf("got latest version %d; want 2", got)
+	}
+
+	if err := m.Goto(context.Background(), 3); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("got error %v; want %v", err, ErrUnknownVersion)
+	}
+}
+
+func TestUpDownUp(t *testing.T) {
+	db := newTestDB(t)
+	m := newTestMigrator(t, db, testMigrations)
+	ctx := context.Background()
+
+	assertVersion(t, m, 0, false)
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	assertVersion(t, m, 2, false)
+	if !tableExists(t, db, "a") || !tableExists(t, db, "b") {
+		t.Fatal("tables missing after up")
+	}
+
+	if err := m.Down(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	assertVersion(t, m, 1, false)
+	if !tableExists(t, db, "a") || tableExists(t, db, "b") {
+		t.Fatal("down 1 didn't roll back only the last migration")
+	}
+
+	// more steps than there are migrations rolls back everything
+	if err := m.Down(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	assertVersion(t, m, 0, false)
+	if tableExists(t, db, "a") {
+		t.Fatal("table a left after rolling back everything")
+	}
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	assertVersion(t, m, 2, false)
+
+	if err := m.Goto(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	assertVersion(t, m, 1, false)
+}
+
+func TestFailedMigrationIsDirty(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	fsys := fstest.MapFS{
+		"000003_broken.up.sql":   {Data: []byte(`CREATE TABLE c (id int); SELEC 1`)},
+		"000003_broken.down.sql": {Data: []byte(`DROP TABLE c`)},
+	}
+	for name, file := range testMigrations {
+		fsys[name] = file
+	}
+
+	m := newTestMigrator(t, db, fsys)
+
+	if err := m.Up(ctx); err == nil {
+		t.Fatal("got no error from a broken migration")
+	}
+
+	// the migrations before it stay applied, and its version needs attention
+	assertVersion(t, m, 3, true)
+	if !tableExists(t, db, "b") {
+		t.Fatal("migrations before the broken one were rolled back")
+	}
+
+	if err := m.Up(ctx); !errors.Is(err, ErrDirty) {
+		t.Fatalf("up while dirty: got error %v; want %v", err, ErrDirty)
+	}
+
+	if err := m.Down(ctx, 1); !errors.Is(err, ErrDirty) {
+		t.Fatalf("down while dirty: got error %v; want %v", err, ErrDirty)
+	}
+
+	if err := m.Force(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	assertVersion(t, m, 2, false)
+
+	if err := m.Down(ctx, 1); err != nil {
+		t.Fatalf("down after force: %v", err)
+	}
+
+	assertVersion(t, m, 1, false)
+}
+
+func TestConcurrentUp(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	// the migrations fail if they run twice, which the lock prevents
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			m, err := New(db, testMigrations, nil)
+			if err == nil {
+				err = m.Up(ctx)
+			}
+			errs[i] = err
+		}(i)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assertVersion(t, newTestMigrator(t, db, testMigrations), 2, false)
+}
@@ -0,0 +1,197 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// ID tokens are verified here rather than with the jwt package, which only
+// deals with this API's own tokens and keys.
+
+var (
+	errInvalidToken = errors.New("oidc: invalid id_token")
+	errUnknownKey   = errors.New("oidc: id_token signed with an unknown key")
+)
+
+var encoding = base64.RawURLEncoding
+
+type publicKey struct {
+	algorithm string
+	rsa       *rsa.PublicKey
+	ed25519   ed25519.PublicKey
+}
+
+func (k publicKey) verify(input, signature []byte) bool {
+	if k.algorithm == "EdDSA" {
+		return ed25519.Verify(k.ed25519, input, signature)
+	}
+
+	digest := sha256.Sum256(input)
+	return rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, digest[:], signature) == nil
+}
+
+// keySet is a provider's signing keys by key id.
+type keySet map[string]publicKey
+
+type jwk struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+// parseJWKS reads the RS256 and Ed25519 signing keys of a JSON Web Key Set
+// (RFC 7517). Keys of other types or for encryption are skipped.
+func parseJWKS(b []byte) (keySet, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("oidc: invalid key set: %w", err)
+	}
+
+	keys := make(keySet)
+
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		switch {
+		case k.KeyType == "RSA" && (k.Algorithm == "" || k.Algorithm == "RS256"):
+			n, err := encoding.DecodeString(k.N)
+			if err != nil {
+				return nil, fmt.Errorf("oidc: key %q: invalid modulus", k.KeyID)
+			}
+
+			e, err := encoding.DecodeString(k.E)
+			if err != nil || len(e) == 0 || len(e) > 4 {
+				return nil, fmt.Errorf("oidc: key %q: invalid exponent", k.KeyID)
+			}
+
+			public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+			if public.N.BitLen() < 2048 {
+				return nil, fmt.Errorf("oidc: key %q: RSA keys must be at least 2048 bits", k.KeyID)
+			}
+
+			keys[k.KeyID] = publicKey{algorithm: "RS256", rsa: public}
+
+		case k.KeyType == "OKP" && k.Curve == "Ed25519":
+			x, err := encoding.DecodeString(k.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("oidc: key %q: invalid public key", k.KeyID)
+			}
+
+			keys[k.KeyID] = publicKey{algorithm: "EdDSA", ed25519: x}
+		}
+	}
+
+	return keys, nil
+}
+
+// audience is the aud claim, which may be a single string or an array.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+func (a audience) contains(aud string) bool {
+	for _, s := range a {
+		if s == aud {
+			return true
+		}
+	}
+
+	return false
+}
+
+type idClaims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	Expiry        float64  `json:"exp"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+}
+
+// verify checks the token's signature, that it was issued by issuer and that
+// it hasn't expired at now, and returns its claims. The audience and nonce
+// are left to the caller.
+func (ks keySet) verify(token, issuer string, now time.Time) (*idClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidToken
+	}
+
+	rawHeader, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	var h struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return nil, errInvalidToken
+	}
+
+	key, ok := ks[h.KeyID]
+	if !ok {
+		return nil, errUnknownKey
+	}
+
+	// the algorithm comes from the key, never from the token
+	if h.Algorithm != key.algorithm {
+		return nil, errInvalidToken
+	}
+
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil || !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, errInvalidToken
+	}
+
+	payload, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	var claims idClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errInvalidToken
+	}
+
+	if claims.Issuer != issuer || claims.Expiry == 0 {
+		return nil, errInvalidToken
+	}
+
+	if !now.Before(time.Unix(int64(claims.Expiry), 0)) {
+		return nil, fmt.Errorf("%w: expired", errInvalidToken)
+	}
+
+	return &claims, nil
+}
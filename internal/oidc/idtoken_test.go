@@ -0,0 +1,100 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newTestToken(t *testing.T, alg, kid string, claims map[string]any, sign func([]byte) []byte) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid})
+	payload, _ := json.Marshal(claims)
+
+	input := encoding.EncodeToString(header) + "." + encoding.EncodeToString(payload)
+	return input + "." + encoding.EncodeToString(sign([]byte(input)))
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	public, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rs-1", "alg": "RS256", "n": encoding.EncodeToString(private.N.Bytes()), "e": encoding.EncodeToString(big.NewInt(int64(private.E)).Bytes())},
+		{"kty": "OKP", "kid": "ed-1", "crv": "Ed25519", "x": encoding.EncodeToString(public)},
+		{"kty": "RSA", "kid": "enc-1", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}})
+
+	keys, err := parseJWKS(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 2 {
+		t.Fatalf("got %d keys; want 2", len(keys))
+	}
+
+	signRSA := func(input []byte) []byte {
+		digest := sha256.Sum256(input)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signature
+	}
+
+	signEd := func(input []byte) []byte {
+		return ed25519.Sign(edPrivate, input)
+	}
+
+	now := time.Now()
+	claims := map[string]any{"iss": "https://issuer.example", "sub": "u-1", "aud": []string{"a", "b"}, "exp": now.Add(time.Minute).Unix()}
+
+	for _, token := range []string{newTestToken(t, "RS256", "rs-1", claims, signRSA), newTestToken(t, "EdDSA", "ed-1", claims, signEd)} {
+		got, err := keys.verify(token, "https://issuer.example", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.Subject != "u-1" || !got.Audience.contains("b") {
+			t.Errorf("got claims %+v", got)
+		}
+	}
+
+	expired := map[string]any{"iss": "https://issuer.example", "sub": "u-1", "aud": "a", "exp": now.Add(-time.Minute).Unix()}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"Unknown key", newTestToken(t, "RS256", "rs-2", claims, signRSA), errUnknownKey},
+		{"Algorithm of another key", newTestToken(t, "EdDSA", "rs-1", claims, signEd), errInvalidToken},
+		{"Wrong issuer", newTestToken(t, "RS256", "rs-1", map[string]any{"iss": "https://other.example", "exp": claims["exp"]}, signRSA), errInvalidToken},
+		{"Expired", newTestToken(t, "RS256", "rs-1", expired, signRSA), errInvalidToken},
+		{"Malformed", "not.a-token", errInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := keys.verify(tt.token, "https://issuer.example", now); !errors.Is(err, tt.want) {
+				t.Errorf("got %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+// Package oidc signs users in with an OpenID Connect provider, using the
+// authorization code flow with PKCE (RFC 7636). The provider's endpoints and
+// signing keys are discovered from its issuer URL.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRejected is returned when the provider refuses to redeem an authorization
+// code or its ID token doesn't check out, as opposed to it being unreachable.
+var ErrRejected = errors.New("oidc: rejected by provider")
+
+// keysRefreshInterval limits how often an unknown key id makes the provider's
+// key set be fetched again.
+const keysRefreshInterval = time.Minute
+
+const maxResponseBytes = 1_048_576
+
+// Config describes a client registered with a provider.
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Identity is who the provider says signed in.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is a configured identity provider. Its metadata is fetched on first
+// use and kept; its keys are fetched again when a token names one it hasn't
+// seen, so that the provider can rotate them.
+type Provider struct {
+	cfg           Config
+	client        *http.Client
+	meta          *metadata
+	keys          keySet
+	keysFetchedAt time.Time
+	mu            sync.Mutex
+}
+
+func New(cfg Config, client *http.Client) *Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	return &Provider{cfg: cfg, client: client}
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// RandomString returns 32 random bytes encoded as base64url, suitable for a
+// state, nonce or PKCE code verifier.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge derives the S256 code challenge sent in place of verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthURL returns where to send the user to sign in. The provider sends them
+// back to the redirect URL with state and a code for Exchange.
+func (p *Provider) AuthURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the identity in the ID
+// token, once its signature, issuer, audience, expiry and nonce are checked.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	var res struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	status, err := p.do(req, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case status >= 400 && status < 500:
+		return nil, fmt.Errorf("%w: %s %s", ErrRejected, res.Error, res.ErrorDescription)
+	case status != http.StatusOK:
+		return nil, fmt.Errorf("oidc: token endpoint returned status %d", status)
+	case res.IDToken == "":
+		return nil, fmt.Errorf("%w: no id_token in response", ErrRejected)
+	}
+
+	claims, err := p.verify(ctx, res.IDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Nonce != nonce || claims.Subject == "" || !claims.Audience.contains(p.cfg.ClientID) {
+		return nil, fmt.Errorf("%w: id_token is not for this sign-in", ErrRejected)
+	}
+
+	return &Identity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	}, nil
+}
+
+func (p *Provider) verify(ctx context.Context, token string) (*idClaims, error) {
+	keys, err := p.keySet(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := keys.verify(token, p.cfg.Issuer, time.Now())
+	if errors.Is(err, errUnknownKey) {
+		keys, err = p.keySet(ctx, true)
+		if err != nil {
+			return nil, err
+		}
+
+		claims, err = keys.verify(token, p.cfg.Issuer, time.Now())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+
+	return claims, nil
+}
+
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta metadata
+
+	status, err := p.do(req, &meta)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: %s: discovery returned status %d", p.cfg.Name, status)
+	}
+
+	// the issuer identifies the provider, so it must be exactly as configured
+	if meta.Issuer != p.cfg.Issuer || meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc: %s: incomplete or mismatched discovery document", p.cfg.Name)
+	}
+
+	p.meta = &meta
+
+	return p.meta, nil
+}
+
+// keySet returns the provider's keys, fetching them when there are none yet
+// or, if refresh is set, when they haven't been fetched recently.
+func (p *Provider) keySet(ctx context.Context, refresh bool) (keySet, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil && (!refresh || time.Since(p.keysFetchedAt) < keysRefreshInterval) {
+		return p.keys, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw json.RawMessage
+
+	status, err := p.do(req, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: %s: key set returned status %d", p.cfg.Name, status)
+	}
+
+	keys, err := parseJWKS(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("oidc: %s: no usable signing keys", p.cfg.Name)
+	}
+
+	p.keys = keys
+
+	p.keysFetchedAt = time.Now()
+
+	return p.keys, nil
+}
+
+// do sends req and decodes a JSON response into dst, returning the status.
+func (p *Provider) do(req *http.Request, dst any) (int, error) {
+	res, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxResponseBytes))
+	if err != nil {
+		return 0, err
+	}
+
+	if len(body) > 0 {
+		err = json.Unmarshal(body, dst)
+		if err != nil && res.StatusCode == http.StatusOK {
+			return 0, fmt.Errorf("oidc: %s: invalid response from %s: %w", p.cfg.Name, req.URL.Path, err)
+		}
+	}
+
+	return res.StatusCode, nil
+}
@@ -0,0 +1,147 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/PriyanshuSharma23/greenlight/internal/oidc"
+	"github.com/PriyanshuSharma23/greenlight/internal/oidc/oidctest"
+)
+
+const redirectURL = "http://localhost:4000/v1/oauth/stub/callback"
+
+func newTestProvider(t *testing.T) (*oidctest.Server, *oidc.Provider) {
+	t.Helper()
+
+	srv, err := oidctest.NewServer("greenlight", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+
+	srv.SetIdentity(oidc.Identity{Subject: "u-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"})
+
+	return srv, oidc.New(srv.Config("stub", redirectURL), srv.Client())
+}
+
+// authorize follows the sign-in URL to the stub's redirect and returns the
+// code and state it sends back.
+func authorize(t *testing.T, srv *oidctest.Server, authURL string) (string, string) {
+	t.Helper()
+
+	client := srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: got status %d", res.StatusCode)
+	}
+
+	loc, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func TestExchange(t *testing.T) {
+	srv, p := newTestProvider(t)
+	ctx := context.Background()
+
+	authURL, err := p.AuthURL(ctx, "state-1", "nonce-1", "verifier-verifier-verifier-verifier-verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state := authorize(t, srv, authURL)
+	if state != "state-1" {
+		t.Errorf("got state %q; want %q", state, "state-1")
+	}
+
+	identity, err := p.Exchange(ctx, code, "verifier-verifier-verifier-verifier-verifier", "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := oidc.Identity{Subject: "u-1", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+	if *identity != want {
+		t.Errorf("got %+v; want %+v", *identity, want)
+	}
+
+	// codes can only be redeemed once
+	if _, err := p.Exchange(ctx, code, "verifier-verifier-verifier-verifier-verifier", "nonce-1"); !errors.Is(err, oidc.ErrRejected) {
+		t.Errorf("reused code: got %v; want %v", err, oidc.ErrRejected)
+	}
+}
+
+func TestExchangeRejects(t *testing.T) {
+	const verifier = "verifier-verifier-verifier-verifier-verifier"
+
+	tests := []struct {
+		name     string
+		verifier string
+		nonce    string
+	}{
+		{"Wrong verifier", "another-verifier-another-verifier-another", "nonce-1"},
+		{"Wrong nonce", verifier, "nonce-2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, p := newTestProvider(t)
+			ctx := context.Background()
+
+			authURL, err := p.AuthURL(ctx, "state-1", "nonce-1", verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			code, _ := authorize(t, srv, authURL)
+
+			if _, err := p.Exchange(ctx, code, tt.verifier, tt.nonce); !errors.Is(err, oidc.ErrRejected) {
+				t.Errorf("got %v; want %v", err, oidc.ErrRejected)
+			}
+		})
+	}
+}
+
+func TestWrongClientSecret(t *testing.T) {
+	srv, _ := newTestProvider(t)
+	ctx := context.Background()
+
+	cfg := srv.Config("stub", redirectURL)
+	cfg.ClientSecret = "wrong"
+	p := oidc.New(cfg, srv.Client())
+
+	authURL, err := p.AuthURL(ctx, "state-1", "nonce-1", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _ := authorize(t, srv, authURL)
+
+	if _, err := p.Exchange(ctx, code, "verifier", "nonce-1"); !errors.Is(err, oidc.ErrRejected) {
+		t.Errorf("got %v; want %v", err, oidc.ErrRejected)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	srv, _ := newTestProvider(t)
+
+	cfg := srv.Config("stub", redirectURL)
+	cfg.Issuer += "/other"
+	p := oidc.New(cfg, srv.Client())
+
+	if _, err := p.AuthURL(context.Background(), "state", "nonce", "verifier"); err == nil || errors.Is(err, oidc.ErrRejected) {
+		t.Errorf("got %v; want a discovery error", err)
+	}
+}
@@ -0,0 +1,86 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// secret is the shared secret used by the test vectors in RFC 4226 and 6238.
+var secret = []byte("12345678901234567890")
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226, appendix D
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	for counter, code := range want {
+		if got := hotp(secret, uint64(counter)); got != code {
+			t.Errorf("counter %d: got %s; want %s", counter, got, code)
+		}
+	}
+}
+
+func TestCode(t *testing.T) {
+	// the last six digits of the SHA1 vectors in RFC 6238, appendix B
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		if got := Code(secret, time.Unix(tt.unix, 0)); got != tt.want {
+			t.Errorf("%d: got %s; want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"Current", Code(secret, now), 0, current, true},
+		{"Previous period", Code(secret, now.Add(-Period)), 0, current - 1, true},
+		{"Next period", Code(secret, now.Add(Period)), 0, current + 1, true},
+		{"Too old", Code(secret, now.Add(-2*Period)), 0, 0, false},
+		{"Already used", Code(secret, now), current, 0, false},
+		{"Wrong", "000000", 0, 0, false},
+		{"Too short", "12345", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(secret, tt.code, now, tt.lastStep)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("got (%d, %t); want (%d, %t)", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("Greenlight", "alice@example.com", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Greenlight:alice@example.com" {
+		t.Errorf("got %s", u)
+	}
+
+	if got := u.Query().Get("secret"); got != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" {
+		t.Errorf("got secret %s", got)
+	}
+}
@@ -7,6 +7,9 @@ import (
 
 var EmailRx = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+// LocaleRx matches a language tag with an optional region, e.g. "en" or "pt-BR".
+var LocaleRx = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
 type Validator struct {
 	Errors map[string]string
 }
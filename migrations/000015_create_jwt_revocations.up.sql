@@ -0,0 +1,11 @@
+-- user_id deliberately has no foreign key, so that revoking the tokens of a
+-- deleted account outlives the account.
+CREATE TABLE IF NOT EXISTS jwt_revocations (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL,
+  token_id text NOT NULL DEFAULT '',
+  revoked_at timestamp with time zone NOT NULL,
+  expiry timestamp with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS jwt_revocations_expiry_idx ON jwt_revocations (expiry);
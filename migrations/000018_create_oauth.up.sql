@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+  provider text NOT NULL,
+  subject text NOT NULL,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  email citext NOT NULL DEFAULT '',
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities (user_id);
+
+CREATE TABLE IF NOT EXISTS oauth_states (
+  hash bytea PRIMARY KEY,
+  provider text NOT NULL,
+  verifier text NOT NULL,
+  nonce text NOT NULL,
+  expiry timestamp(0) with time zone NOT NULL
+);
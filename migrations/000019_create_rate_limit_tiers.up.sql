@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS rate_limit_tiers (
+  user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+  tier text NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE jwt_revocations DROP COLUMN IF EXISTS session;
@@ -0,0 +1 @@
+ALTER TABLE jwt_revocations ADD COLUMN IF NOT EXISTS session text NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+// Package migrations embeds the SQL migration files so that the api binary can
+// apply them itself. init.sql is not included; it bootstraps the database and
+// extensions and is run by the Postgres container on first start.
+package migrations
+
+import "embed"
+
+//go:embed *.up.sql *.down.sql
+var FS embed.FS